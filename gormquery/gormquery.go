@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"reflect"
 	"strings"
 
 	"github.com/levav-enspiren/common-go/skmap"
@@ -103,7 +104,7 @@ Apply filter query
 
 fields: field array
 
-queryObject: primitive or primitive array
+queryObject: primitive, primitive array, or operator map (ref: gormquery.FilterOperators)
 
 # Output
 
@@ -116,7 +117,9 @@ query factory itself for fluent interface pattern
 	// query with simple primitive (e.g. WHERE fieldA = 'stringValue')
 	qf.ApplyQuery("fieldA", "stringValue")
 	// query with array (e.g. WHERE fieldA in (values...))
-	qf.ApplyQuery("fieldB", []string{"stringValue1", "stringValue2"})
+	qf.ApplyQuery("fieldB", []any{"stringValue1", "stringValue2"})
+	// query with operators (e.g. WHERE fieldC >= 1 AND fieldC < 10)
+	qf.ApplyQuery("fieldC", map[string]any{"gte": 1, "lt": 10})
 */
 func (qf *QueryFactory) ApplyQuery(field string, queryObject any) *QueryFactory {
 	if queryObject == nil || field == "" {
@@ -129,14 +132,28 @@ func (qf *QueryFactory) ApplyQuery(field string, queryObject any) *QueryFactory
 		qf.applyQueryPrimitive(field, queryObject)
 	case float64:
 		qf.applyQueryPrimitive(field, queryObject)
-	case int:
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32:
 		qf.applyQueryPrimitive(field, queryObject)
 	// included in
 	case []any:
 		qf.applyQueryIncludedIn(field, queryObject)
-	// TODO: operator
+	// operator
+	case map[string]any:
+		qf.applyQueryOperators(field, queryObject)
+	case skmap.Map:
+		qf.applyQueryOperators(field, queryObject)
+	// typed values, e.g. time.Time, UUID or decimal, and typed arrays
 	default:
-		fmt.Printf("unknown qf object type of %s", queryObject)
+		value := reflect.ValueOf(queryObject)
+		if value.Kind() != reflect.Slice || value.Type().Elem().Kind() == reflect.Uint8 {
+			qf.applyQueryPrimitive(field, queryObject)
+			break
+		}
+		values := make([]any, value.Len())
+		for i := range values {
+			values[i] = value.Index(i).Interface()
+		}
+		qf.applyQueryIncludedIn(field, values)
 	}
 	return qf
 }
@@ -152,6 +169,100 @@ func (qf *QueryFactory) applyQueryIncludedIn(field string, values []any) *QueryF
 	return qf
 }
 
+/*
+Operators of filter query, as keys of operator map
+
+	eq, ne, gt, gte, lt, lte : comparison with primitive
+	in, nin : included / not included in primitive array
+	like : SQL LIKE pattern
+	null : IS NULL if true, IS NOT NULL if false
+*/
+var FilterOperators = map[string]string{
+	"eq":   "%s = ?",
+	"ne":   "%s <> ?",
+	"gt":   "%s > ?",
+	"gte":  "%s >= ?",
+	"lt":   "%s < ?",
+	"lte":  "%s <= ?",
+	"in":   "%s in ?",
+	"nin":  "%s not in ?",
+	"like": "%s like ?",
+	"null": "%s IS NULL",
+}
+
+func (qf *QueryFactory) applyQueryOperators(field string, operators map[string]any) *QueryFactory {
+	for operator, value := range operators {
+		queryTemplate, ok := FilterOperators[operator]
+		if !ok {
+			log.Printf("[gormquery] unknown filter operator. key: %s, operator: %s \n", field, operator)
+			continue
+		}
+		if operator == "null" {
+			if isNull, _ := value.(bool); !isNull {
+				queryTemplate = "%s IS NOT NULL"
+			}
+			qf.Query = qf.Query.Where(fmt.Sprintf(queryTemplate, field))
+			continue
+		}
+		qf.Query = qf.Query.Where(fmt.Sprintf(queryTemplate, field), value)
+	}
+	return qf
+}
+
+/*
+Validate operator maps and "$or" groups of filter
+
+A filter with unknown operator is rejected rather than partially applied, as it would widen Update / Delete.
+*/
+func ValidateFilter(filter map[string]any) error {
+	for field, value := range filter {
+		if field == FilterOr {
+			alternatives, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("%s requires an array of filters", FilterOr)
+			}
+			for _, alternative := range alternatives {
+				alternativeFilter, ok := alternative.(map[string]any)
+				if !ok {
+					return fmt.Errorf("%s requires an array of filters", FilterOr)
+				}
+				if err := ValidateFilter(alternativeFilter); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		operators, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+		for operator, operand := range operators {
+			if _, ok := FilterOperators[operator]; !ok {
+				return fmt.Errorf("unknown filter operator %s of %s", operator, field)
+			}
+			switch operator {
+			case "in", "nin":
+				if _, ok := operand.([]any); !ok {
+					return fmt.Errorf("filter operator %s of %s requires an array", operator, field)
+				}
+			case "null":
+				if _, ok := operand.(bool); !ok {
+					return fmt.Errorf("filter operator %s of %s requires a boolean", operator, field)
+				}
+			default:
+				switch operand.(type) {
+				case []any, map[string]any, nil:
+					return fmt.Errorf("filter operator %s of %s requires a primitive", operator, field)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Filter key of alternative filters, e.g. {"$or": [{"name": "a"}, {"price": {"lt": 10}}]}
+const FilterOr = "$or"
+
 // Deprecated: ExtractSimpleJsonQuery is deprecated.
 func ExtractSimpleJsonQuery(keyValuePairs []string) (queryMap map[string]string) {
 	queryMap = make(map[string]string)
@@ -0,0 +1,228 @@
+package gormquery
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ------------ helpers
+
+func expectEqual[CT any](t *testing.T, expression string, expectedValue CT, actualValue CT) {
+	t.Helper()
+	if !reflect.DeepEqual(expectedValue, actualValue) {
+		t.Fatalf("%s should be equals to %v, but got %v", expression, expectedValue, actualValue)
+	}
+}
+
+func expect(t *testing.T, description string, condition bool) {
+	t.Helper()
+	if !condition {
+		t.Fatal(description)
+	}
+}
+
+func expectNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func expectCode(t *testing.T, expression string, expectedCode codes.Code, err error) {
+	t.Helper()
+	if status.Code(err) != expectedCode {
+		t.Fatalf("%s should fail with %s, but got %v", expression, expectedCode, err)
+	}
+}
+
+// ------------ test config
+
+var testCtx = context.Background()
+
+type testCategory struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type testItem struct {
+	ID         uint          `json:"id"`
+	Name       string        `json:"name"`
+	Price      int           `json:"price"`
+	CategoryID uint          `json:"category_id"`
+	Category   *testCategory `json:"category,omitempty"`
+	Comments   []testComment `gorm:"foreignKey:ItemID" json:"comments,omitempty"`
+}
+
+type testComment struct {
+	ID     uint   `json:"id"`
+	ItemID uint   `json:"item_id"`
+	Body   string `json:"body"`
+	Score  int    `json:"score"`
+}
+
+// SQLite database in a temporary directory, with items "a" (1), "b" (2) of category "x" and "c" (3) of category "y"
+func newTestDb(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	expectNoError(t, err)
+	expectNoError(t, db.AutoMigrate(&testCategory{}, &testItem{}, &testComment{}))
+	categories := []testCategory{{Name: "x"}, {Name: "y"}}
+	expectNoError(t, db.Create(&categories).Error)
+	items := []testItem{
+		{Name: "a", Price: 1, CategoryID: categories[0].ID, Comments: []testComment{{Body: "good", Score: 5}, {Body: "bad", Score: 1}}},
+		{Name: "b", Price: 2, CategoryID: categories[0].ID, Comments: []testComment{{Body: "fine", Score: 3}}},
+		{Name: "c", Price: 3, CategoryID: categories[1].ID},
+	}
+	expectNoError(t, db.Create(&items).Error)
+	return db
+}
+
+// server of model class "item" with all permissions. Fields id, name, price and category_id are whitelisted by default
+func newTestServer(db *gorm.DB, modelClass ModelClass) *QueryServiceServer {
+	if modelClass.Model == nil {
+		modelClass.Model = testItem{}
+	}
+	modelClass.CanGet, modelClass.CanCreate, modelClass.CanUpdate, modelClass.CanDelete = true, true, true, true
+	if modelClass.WhitelistedFields == nil {
+		modelClass.WhitelistedFields = skmap.Map{"id": true, "name": true, "price": true, "category_id": true}
+	}
+	return &QueryServiceServer{
+		ModelClasses:      map[string]ModelClass{"item": modelClass},
+		DefaultModelClass: "item",
+		DefaultDb:         db,
+	}
+}
+
+// client model of the server, over an in-memory gRPC listener
+func newTestModel(t *testing.T, server queryService.QueryServiceServer) *QueryServiceModel {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	queryService.RegisterQueryServiceServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	expectNoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &QueryServiceModel{GrpcClient: queryService.NewQueryServiceClient(conn), RequestTimeout: 5 * time.Second}
+}
+
+func optionRequest(options skmap.Map) *queryService.OptionRequest {
+	optionsBytes, _ := json.Marshal(options)
+	return &queryService.OptionRequest{Options: optionsBytes}
+}
+
+func decodeResults[T any](t *testing.T, resultsBytes []byte) (results []T) {
+	t.Helper()
+	expectNoError(t, json.Unmarshal(resultsBytes, &results))
+	return
+}
+
+// names of items of Get with options, sorted by id
+func testItemNames(t *testing.T, server *QueryServiceServer, options skmap.Map) (names []string) {
+	t.Helper()
+	if options["sort"] == nil {
+		options["sort"] = skmap.Map{"id": "ASC"}
+	}
+	response, err := server.Get(testCtx, optionRequest(options))
+	expectNoError(t, err)
+	names = []string{}
+	for _, item := range decodeResults[testItem](t, response.Results) {
+		names = append(names, item.Name)
+	}
+	return
+}
+
+func testItemPrice(t *testing.T, db *gorm.DB, name string) int {
+	t.Helper()
+	item := testItem{}
+	expectNoError(t, db.Where("name = ?", name).Take(&item).Error)
+	return item.Price
+}
+
+func TestApplyQuery(t *testing.T) {
+	db := newTestDb(t)
+	count := func(field string, queryObject any) int64 {
+		qf := QueryFactory{Query: db.Model(&testItem{})}
+		qf.ApplyQuery(field, queryObject)
+		var count int64
+		expectNoError(t, qf.Query.Count(&count).Error)
+		return count
+	}
+	expectEqual(t, "count of primitive", int64(1), count("name", "a"))
+	expectEqual(t, "count of array", int64(2), count("name", []any{"a", "c"}))
+	expectEqual(t, "count of nil", int64(3), count("name", nil))
+}
+
+func TestApplyQueryOperators(t *testing.T) {
+	db := newTestDb(t)
+	names := func(operators map[string]any) (names []string) {
+		qf := QueryFactory{Query: db.Model(&testItem{}).Order("id")}
+		qf.ApplyQuery("price", operators)
+		expectNoError(t, qf.Query.Pluck("name", &names).Error)
+		return
+	}
+	expectEqual(t, "eq", []string{"b"}, names(map[string]any{"eq": 2}))
+	expectEqual(t, "ne", []string{"a", "c"}, names(map[string]any{"ne": 2}))
+	expectEqual(t, "gt and lte", []string{"b", "c"}, names(map[string]any{"gt": 1, "lte": 3}))
+	expectEqual(t, "gte and lt", []string{"a", "b"}, names(map[string]any{"gte": 1, "lt": 3}))
+	expectEqual(t, "in", []string{"a", "c"}, names(map[string]any{"in": []any{1, 3}}))
+	expectEqual(t, "nin", []string{"b"}, names(map[string]any{"nin": []any{1, 3}}))
+	expectEqual(t, "null", 0, len(names(map[string]any{"null": true})))
+	expectEqual(t, "not null", []string{"a", "b", "c"}, names(map[string]any{"null": false}))
+	// unknown operators are skipped by ApplyQuery, and rejected by ValidateFilter
+	expectEqual(t, "unknown operator", []string{"a", "b", "c"}, names(map[string]any{"between": 1}))
+
+	qf := QueryFactory{Query: db.Model(&testItem{})}
+	qf.ApplyQuery("name", skmap.Map{"like": "%b%"})
+	var count int64
+	expectNoError(t, qf.Query.Count(&count).Error)
+	expectEqual(t, "count of like", int64(1), count)
+}
+
+func TestValidateFilter(t *testing.T) {
+	expectNoError(t, ValidateFilter(map[string]any{
+		"name":  "a",
+		"price": map[string]any{"gte": 1, "in": []any{1, 2}, "null": false},
+		FilterOr: []any{
+			map[string]any{"name": "b"},
+			map[string]any{"price": map[string]any{"lt": 10}},
+		},
+	}))
+	invalidFilters := map[string]map[string]any{
+		"unknown operator":      {"price": map[string]any{"between": 1}},
+		"in without array":      {"price": map[string]any{"in": 1}},
+		"null without boolean":  {"price": map[string]any{"null": "yes"}},
+		"comparison with array": {"price": map[string]any{"gt": []any{1}}},
+		"comparison with nil":   {"price": map[string]any{"lt": nil}},
+		"$or without array":     {FilterOr: map[string]any{"name": "a"}},
+		"$or of non-filter":     {FilterOr: []any{"a"}},
+		"nested invalid $or":    {FilterOr: []any{map[string]any{"price": map[string]any{"between": 1}}}},
+	}
+	for description, filter := range invalidFilters {
+		expect(t, description, ValidateFilter(filter) != nil)
+	}
+}
@@ -0,0 +1,29 @@
+module github.com/levav-enspiren/common-go/gormquery/gormquerygraphql
+
+go 1.18
+
+require (
+	github.com/graphql-go/graphql v0.8.1
+	github.com/levav-enspiren/common-go/gormquery v0.0.0-00010101000000-000000000000
+	github.com/levav-enspiren/common-go/gormquery/gormquerytest v0.0.0-00010101000000-000000000000
+	github.com/levav-enspiren/common-go/skmap v1.3.1
+	google.golang.org/grpc v1.52.3
+	gorm.io/gorm v1.24.5
+)
+
+require (
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/mattn/go-sqlite3 v1.14.15 // indirect
+	golang.org/x/net v0.4.0 // indirect
+	golang.org/x/sys v0.3.0 // indirect
+	golang.org/x/text v0.5.0 // indirect
+	google.golang.org/genproto v0.0.0-20221118155620-16455021b5e6 // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+	gorm.io/driver/sqlite v1.4.4 // indirect
+)
+
+replace github.com/levav-enspiren/common-go/gormquery => ../
+
+replace github.com/levav-enspiren/common-go/gormquery/gormquerytest => ../gormquerytest
@@ -0,0 +1,156 @@
+package gormquerygraphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/levav-enspiren/common-go/gormquery"
+	"google.golang.org/grpc/metadata"
+)
+
+/*
+GraphQL HTTP handler of QueryServiceServer
+
+The schema is derived from ModelClasses with CanGet. Each model class is a query field, e.g. "item",
+returning a page of records:
+
+	query {
+		item(filter: {price: {gte: 10}}, sort: {price: "DESC"}, limit: 20) {
+			results { id name cat { id name } }
+			totalCount
+			nextCursor
+		}
+		cat(page: 1, limit: 10) { results { id } }
+	}
+
+Arguments are the options of QueryServiceServer.Get: filter, sort, relations (JSON), page, limit, cursor, keyword
+and facets, whose counts are returned in "facets" of the page.
+Selected fields of results are passed as "fields", including relation sub-fields, e.g. "cat.name".
+Each field is resolved by QueryServiceServer.Get, so its permissions and QueryLimits apply.
+Since every model class field, aliases included, is a Get of its own, a query of more than MaxRootFields
+of them is rejected.
+
+Example
+
+	handler, err := gormquerygraphql.NewHandler(queryServiceServer)
+	router.POST("/graphql", gin.WrapH(handler))
+*/
+type Handler struct {
+	Server *gormquery.QueryServiceServer
+	Schema graphql.Schema
+	// incoming gRPC metadata of a request as key-value pairs, e.g. caller of rate limits with TrustActorMetadata
+	Metadata func(r *http.Request) []string
+	// number of model class fields of a query, aliases included. 0 for no limit
+	MaxRootFields int
+}
+
+const DefaultMaxRootFields = 10
+
+func NewHandler(server *gormquery.QueryServiceServer) (handler *Handler, err error) {
+	handler = &Handler{Server: server, MaxRootFields: DefaultMaxRootFields}
+	handler.Schema, err = newSchema(server)
+	if err != nil {
+		handler = nil
+	}
+	return
+}
+
+// body of POST, or query parameters of GET
+type request struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid variables")
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid body")
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, "missing query")
+		return
+	}
+	if h.MaxRootFields > 0 && rootFieldCount(req.Query, req.OperationName) > h.MaxRootFields {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("more than %d fields in query", h.MaxRootFields))
+		return
+	}
+	ctx := r.Context()
+	if h.Metadata != nil {
+		if pairs := h.Metadata(r); len(pairs) > 0 {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(pairs...))
+		}
+	}
+	result := graphql.Do(graphql.Params{
+		Schema:         h.Schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+	writeJSON(w, http.StatusOK, result)
+}
+
+/*
+Number of root fields of the operation, excluding introspection fields
+
+All operations are counted if operationName is not provided. A query that cannot be parsed is counted as 0,
+and its error is left to graphql.Do.
+*/
+func rootFieldCount(query string, operationName string) (count int) {
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return
+	}
+	fragments := map[string]ast.Definition{}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok || (operationName != "" && (operation.Name == nil || operation.Name.Value != operationName)) {
+			continue
+		}
+		for _, field := range flattenSelections(operation.SelectionSet, fragments) {
+			if !strings.HasPrefix(field.Name.Value, "__") {
+				count++
+			}
+		}
+	}
+	return
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]any{
+		"errors": []map[string]any{{"message": message}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
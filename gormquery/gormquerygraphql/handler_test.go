@@ -0,0 +1,146 @@
+package gormquerygraphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/gormquery"
+	"github.com/levav-enspiren/common-go/gormquery/gormquerytest"
+	"github.com/levav-enspiren/common-go/skmap"
+)
+
+type testCategory struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type testItem struct {
+	ID         uint          `json:"id"`
+	Name       string        `json:"name"`
+	Price      int           `json:"price"`
+	CategoryID uint          `json:"category_id"`
+	Category   *testCategory `json:"category,omitempty"`
+}
+
+func newTestHandler(t *testing.T) *Handler {
+	h := gormquerytest.New(t, gormquerytest.Config{
+		Models: []any{&testCategory{}, &testItem{}},
+		Fixtures: []any{
+			&[]testCategory{{Name: "x"}, {Name: "y"}},
+			&[]testItem{{Name: "a", Price: 1, CategoryID: 1}, {Name: "b", Price: 2, CategoryID: 1}, {Name: "c", Price: 3, CategoryID: 2}},
+		},
+		ModelClasses: map[string]gormquery.ModelClass{
+			"item": {
+				Model:             testItem{},
+				CanGet:            true,
+				WhitelistedFields: skmap.Map{"id": true, "name": true, "price": true, "category_id": true},
+				FieldAliases:      map[string]string{"title": "name"},
+				Relations: map[string]gormquery.ModelRelation{
+					"cat": {Association: "Category", Dependencies: []string{"category_id"}, QueryComplusoryFields: []string{"id"}},
+				},
+			},
+			"category": {Model: testCategory{}, WhitelistedFields: skmap.Map{"id": true, "name": true}},
+		},
+	})
+	handler, err := NewHandler(h.Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+type testResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// response of a POST of query with variables
+func testQuery(t *testing.T, handler *Handler, query string, variables map[string]any) (statusCode int, response testResponse) {
+	t.Helper()
+	body, _ := json.Marshal(request{Query: query, Variables: variables})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %s: %v", recorder.Body.String(), err)
+	}
+	return recorder.Code, response
+}
+
+func expectEqual[CT any](t *testing.T, description string, expected CT, actual CT) {
+	t.Helper()
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("%s should be %v, but got %v", description, expected, actual)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	handler := newTestHandler(t)
+	_, response := testQuery(t, handler, `{
+		item(filter: {price: {gte: 2}}, sort: {price: "DESC"}) { results { title price cat { name } } totalCount }
+	}`, nil)
+	expectEqual(t, "errors", 0, len(response.Errors))
+	expectEqual[any](t, "page", map[string]any{
+		"results": []any{
+			map[string]any{"title": "c", "price": float64(3), "cat": map[string]any{"name": "y"}},
+			map[string]any{"title": "b", "price": float64(2), "cat": map[string]any{"name": "x"}},
+		},
+		"totalCount": float64(2),
+	}, response.Data["item"])
+
+	// aliases of root fields are resolved separately
+	_, response = testQuery(t, handler, `{ first: item(limit: 1, sort: {id: "ASC"}) { results { id } } all: item { totalCount } }`, nil)
+	expectEqual[any](t, "page of first", map[string]any{"results": []any{map[string]any{"id": float64(1)}}}, response.Data["first"])
+	expectEqual[any](t, "page of all", map[string]any{"totalCount": float64(3)}, response.Data["all"])
+
+	// model classes without CanGet are not in the schema
+	_, response = testQuery(t, handler, `{ category { totalCount } }`, nil)
+	expectEqual(t, "errors of category", 1, len(response.Errors))
+
+	_, response = testQuery(t, handler, `{ item(filter: {price: {between: 1}}) { totalCount } }`, nil)
+	expectEqual(t, "errors of unknown operator", 1, len(response.Errors))
+	expectEqual[any](t, "code of error", "InvalidArgument", response.Errors[0].Extensions["code"])
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(`{ item { totalCount } }`), nil))
+	expectEqual(t, "status of GET", http.StatusOK, recorder.Code)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/graphql", nil))
+	expectEqual(t, "status of PUT", http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestHandlerVariables(t *testing.T) {
+	handler := newTestHandler(t)
+	query := `query ($filter: JSON, $minPrice: JSON, $names: JSON) {
+		byFilter: item(filter: $filter) { totalCount }
+		byPrice: item(filter: {price: {gte: $minPrice}}) { totalCount }
+		byNames: item(filter: {name: {in: [$names, "c"]}}) { totalCount }
+	}`
+	_, response := testQuery(t, handler, query, map[string]any{"filter": map[string]any{"name": "a"}, "minPrice": 2, "names": "a"})
+	expectEqual(t, "errors", 0, len(response.Errors))
+	expectEqual[any](t, "page of filter variable", map[string]any{"totalCount": float64(1)}, response.Data["byFilter"])
+	expectEqual[any](t, "page of variable in object", map[string]any{"totalCount": float64(2)}, response.Data["byPrice"])
+	expectEqual[any](t, "page of variable in list", map[string]any{"totalCount": float64(2)}, response.Data["byNames"])
+}
+
+func TestHandlerMaxRootFields(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.MaxRootFields = 2
+	statusCode, _ := testQuery(t, handler, `{ a: item { totalCount } b: item { totalCount } __typename }`, nil)
+	expectEqual(t, "status of 2 fields", http.StatusOK, statusCode)
+	statusCode, response := testQuery(t, handler, `{ a: item { totalCount } ...more } fragment more on Query { b: item { totalCount } c: item { totalCount } }`, nil)
+	expectEqual(t, "status of 3 fields", http.StatusBadRequest, statusCode)
+	expectEqual(t, "error", "more than 2 fields in query", response.Errors[0].Message)
+
+	// only the selected operation is counted
+	statusCode, _ = testQuery(t, handler, `query one { a: item { totalCount } } query three { a: item { totalCount } b: item { totalCount } c: item { totalCount } }`, nil)
+	expectEqual(t, "status of all operations", http.StatusBadRequest, statusCode)
+	expectEqual(t, "root fields of selected operation", 1, rootFieldCount(`query one { a: item { totalCount } } query three { a: item { totalCount } b: item { totalCount } c: item { totalCount } }`, "one"))
+}
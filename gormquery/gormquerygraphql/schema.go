@@ -0,0 +1,420 @@
+package gormquerygraphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/levav-enspiren/common-go/gormquery"
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Any JSON value, for filter / sort arguments and columns without a GraphQL scalar type
+var JSON = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "Any JSON value",
+	Serialize: func(value any) any {
+		return value
+	},
+	ParseValue: func(value any) any {
+		return value
+	},
+	ParseLiteral: literalValue,
+})
+
+// variable inside an object or list literal, replaced by its value when the field is resolved
+type variableRef struct {
+	name string
+}
+
+func literalValue(valueAST ast.Value) any {
+	switch valueAST := valueAST.(type) {
+	case *ast.Variable:
+		return variableRef{name: valueAST.Name.Value}
+	case *ast.StringValue:
+		return valueAST.Value
+	case *ast.BooleanValue:
+		return valueAST.Value
+	case *ast.EnumValue:
+		return valueAST.Value
+	case *ast.IntValue:
+		if intValue, err := strconv.ParseInt(valueAST.Value, 10, 64); err == nil {
+			return intValue
+		}
+		floatValue, _ := strconv.ParseFloat(valueAST.Value, 64)
+		return floatValue
+	case *ast.FloatValue:
+		floatValue, _ := strconv.ParseFloat(valueAST.Value, 64)
+		return floatValue
+	case *ast.ListValue:
+		values := []any{}
+		for _, value := range valueAST.Values {
+			values = append(values, literalValue(value))
+		}
+		return values
+	case *ast.ObjectValue:
+		values := map[string]any{}
+		for _, field := range valueAST.Fields {
+			values[field.Name.Value] = literalValue(field.Value)
+		}
+		return values
+	}
+	return nil
+}
+
+// value with variables of literals replaced by values of the request
+func withVariables(value any, variables map[string]any) any {
+	switch value := value.(type) {
+	case variableRef:
+		return variables[value.name]
+	case []any:
+		values := []any{}
+		for _, subValue := range value {
+			values = append(values, withVariables(subValue, variables))
+		}
+		return values
+	case map[string]any:
+		values := map[string]any{}
+		for key, subValue := range value {
+			values[key] = withVariables(subValue, variables)
+		}
+		return values
+	}
+	return value
+}
+
+// error of QueryServiceServer, with the gRPC code in extensions
+type resolveError struct {
+	status *status.Status
+}
+
+func (err *resolveError) Error() string {
+	return err.status.Message()
+}
+
+func (err *resolveError) Extensions() map[string]any {
+	return map[string]any{"code": err.status.Code().String()}
+}
+
+/*
+Fields of a record type
+
+The field name is the name of "fields" option, and the key is the key of the JSON encoded record.
+*/
+type recordField struct {
+	name     string
+	key      string
+	relation *relationField
+}
+
+type relationField struct {
+	fields map[string]bool
+}
+
+type schemaBuilder struct {
+	server *gormquery.QueryServiceServer
+}
+
+func newSchema(server *gormquery.QueryServiceServer) (graphqlSchema graphql.Schema, err error) {
+	b := &schemaBuilder{server: server}
+	names := []string{}
+	for name, modelClass := range server.ModelClasses {
+		if modelClass.CanGet {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	queryFields := graphql.Fields{}
+	for _, name := range names {
+		queryFields[name], err = b.modelClassField(name, server.ModelClasses[name])
+		if err != nil {
+			return
+		}
+	}
+	if len(queryFields) == 0 {
+		err = fmt.Errorf("no model class with CanGet")
+		return
+	}
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: queryFields}),
+	})
+}
+
+// gORM schema of model, with naming strategy of db if it is provided
+func parseSchema(db *gorm.DB, model any) (*schema.Schema, error) {
+	if db == nil {
+		return schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+	}
+	stmt := &gorm.Statement{DB: db}
+	err := stmt.Parse(model)
+	return stmt.Schema, err
+}
+
+// e.g. "itemTag" to "ItemTag"
+func typeName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// key of the field in JSON encoded model, or "" if it is not marshalled
+func jsonKeyOf(field *schema.Field) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func outputType(t reflect.Type) graphql.Output {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return graphql.String
+	}
+	if t.Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()) || reflect.PointerTo(t).Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()) {
+		return JSON
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return graphql.Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return graphql.Int
+	case reflect.Float32, reflect.Float64:
+		return graphql.Float
+	case reflect.String:
+		return graphql.String
+	}
+	return JSON
+}
+
+// resolve field by key of the source record
+func keyResolver(key string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		record, _ := p.Source.(map[string]any)
+		return record[key], nil
+	}
+}
+
+// column fields of model schema, named by column. Only columns in whitelist are included if it is not empty
+func columnFields(modelSchema *schema.Schema, whitelist skmap.Map, apiField func(column string) string) (fields graphql.Fields) {
+	fields = graphql.Fields{}
+	for _, field := range modelSchema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		if _, ok := whitelist[field.DBName]; len(whitelist) > 0 && !ok {
+			continue
+		}
+		key := jsonKeyOf(field)
+		if key == "" {
+			continue
+		}
+		name := apiField(field.DBName)
+		// results are keyed by JSON names, renamed to API fields for aliased columns
+		if name != field.DBName {
+			key = name
+		}
+		fields[name] = &graphql.Field{
+			Type:    outputType(field.FieldType),
+			Resolve: keyResolver(key),
+		}
+	}
+	return
+}
+
+func (b *schemaBuilder) modelClassField(name string, modelClass gormquery.ModelClass) (field *graphql.Field, err error) {
+	db := modelClass.Db
+	if db == nil {
+		db = b.server.DefaultDb
+	}
+	modelSchema, err := parseSchema(db, modelClass.Model)
+	if err != nil {
+		return
+	}
+	apiFields := map[string]string{}
+	for apiField, column := range modelClass.FieldAliases {
+		apiFields[column] = apiField
+	}
+	apiField := func(column string) string {
+		if apiField, ok := apiFields[column]; ok {
+			return apiField
+		}
+		return column
+	}
+	recordFields := columnFields(modelSchema, nil, apiField)
+	relations := map[string]bool{}
+	for relationName, relation := range modelClass.Relations {
+		association := relation.Association
+		if association == "" {
+			association = relationName
+		}
+		relationship, ok := modelSchema.Relationships.Relations[association]
+		if !ok {
+			continue
+		}
+		key := jsonKeyOf(relationship.Field)
+		if key == "" {
+			continue
+		}
+		var relationType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+			Name:   typeName(name) + typeName(relationName),
+			Fields: columnFields(relationship.FieldSchema, relation.WhitelistedFields, func(column string) string { return column }),
+		})
+		if relationship.Type == schema.HasMany || relationship.Type == schema.Many2Many {
+			relationType = graphql.NewList(relationType)
+		}
+		relations[relationName] = true
+		recordFields[relationName] = &graphql.Field{
+			Type:    relationType,
+			Resolve: keyResolver(key),
+		}
+	}
+	for virtualName := range modelClass.VirtualFields {
+		recordFields[virtualName] = &graphql.Field{
+			Type:    JSON,
+			Resolve: keyResolver(virtualName),
+		}
+	}
+	recordType := graphql.NewObject(graphql.ObjectConfig{
+		Name:   typeName(name) + "Record",
+		Fields: recordFields,
+	})
+	pageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: typeName(name) + "Page",
+		Fields: graphql.Fields{
+			"results":    &graphql.Field{Type: graphql.NewList(recordType)},
+			"totalCount": &graphql.Field{Type: graphql.Int},
+			"nextCursor": &graphql.Field{Type: graphql.String},
+			"facets":     &graphql.Field{Type: JSON},
+		},
+	})
+	field = &graphql.Field{
+		Type: pageType,
+		Args: graphql.FieldConfigArgument{
+			"filter":    &graphql.ArgumentConfig{Type: JSON},
+			"sort":      &graphql.ArgumentConfig{Type: JSON},
+			"page":      &graphql.ArgumentConfig{Type: graphql.Int},
+			"limit":     &graphql.ArgumentConfig{Type: graphql.Int},
+			"cursor":    &graphql.ArgumentConfig{Type: graphql.String},
+			"keyword":   &graphql.ArgumentConfig{Type: graphql.String},
+			"relations": &graphql.ArgumentConfig{Type: JSON},
+			"facets":    &graphql.ArgumentConfig{Type: graphql.NewList(graphql.String)},
+		},
+		Resolve: func(p graphql.ResolveParams) (result any, err error) {
+			options := skmap.Map{"modelClass": name}
+			for key, value := range p.Args {
+				options[key] = withVariables(value, p.Info.VariableValues)
+			}
+			if fields := selectedFields(p.Info, relations); len(fields) > 0 {
+				options["fields"] = fields
+			}
+			return b.get(p, options)
+		},
+	}
+	return
+}
+
+func (b *schemaBuilder) get(p graphql.ResolveParams, options skmap.Map) (page map[string]any, err error) {
+	optionsBytes, err := json.Marshal(options)
+	if err != nil {
+		return
+	}
+	response, err := b.server.Get(p.Context, &queryService.OptionRequest{Options: optionsBytes})
+	if err != nil {
+		err = &resolveError{status: status.Convert(err)}
+		return
+	}
+	var results []map[string]any
+	err = json.Unmarshal(response.Results, &results)
+	if err != nil {
+		return
+	}
+	page = map[string]any{
+		"results":    results,
+		"totalCount": response.TotalCount,
+		"nextCursor": response.NextCursor,
+	}
+	if len(response.Facets) > 0 {
+		var facets map[string]any
+		err = json.Unmarshal(response.Facets, &facets)
+		if err != nil {
+			return
+		}
+		page["facets"] = facets
+	}
+	return
+}
+
+/*
+"fields" option of selection set of the page
+
+A relation without selected sub-fields (e.g. only "__typename") is selected with all fields.
+*/
+func selectedFields(info graphql.ResolveInfo, relations map[string]bool) (fields []string) {
+	for _, pageAST := range info.FieldASTs {
+		for _, resultsAST := range flattenSelections(pageAST.SelectionSet, info.Fragments) {
+			if resultsAST.Name.Value != "results" {
+				continue
+			}
+			for _, fieldAST := range flattenSelections(resultsAST.SelectionSet, info.Fragments) {
+				name := fieldAST.Name.Value
+				if strings.HasPrefix(name, "__") {
+					continue
+				}
+				if !relations[name] {
+					fields = append(fields, name)
+					continue
+				}
+				subFields := []string{}
+				for _, subFieldAST := range flattenSelections(fieldAST.SelectionSet, info.Fragments) {
+					if !strings.HasPrefix(subFieldAST.Name.Value, "__") {
+						subFields = append(subFields, fmt.Sprintf("%s.%s", name, subFieldAST.Name.Value))
+					}
+				}
+				if len(subFields) == 0 {
+					subFields = []string{name}
+				}
+				fields = append(fields, subFields...)
+			}
+		}
+	}
+	return
+}
+
+// fields of selection set, including those of fragments
+func flattenSelections(selectionSet *ast.SelectionSet, fragments map[string]ast.Definition) (fields []*ast.Field) {
+	if selectionSet == nil {
+		return
+	}
+	for _, selection := range selectionSet.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			fields = append(fields, selection)
+		case *ast.InlineFragment:
+			fields = append(fields, flattenSelections(selection.SelectionSet, fragments)...)
+		case *ast.FragmentSpread:
+			if fragment, ok := fragments[selection.Name.Value].(*ast.FragmentDefinition); ok {
+				fields = append(fields, flattenSelections(fragment.SelectionSet, fragments)...)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,31 @@
+package gormquerygraphql
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestLiteralValue(t *testing.T) {
+	valueAST, err := parser.ParseValue(parser.ParseParams{Source: `{price: {gte: 1.5, lt: 10}, name: {in: ["a", $name]}, tag: $tag, ok: true, kind: RED}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := literalValue(valueAST.(ast.Value))
+	expectEqual[any](t, "value", map[string]any{
+		"price": map[string]any{"gte": 1.5, "lt": int64(10)},
+		"name":  map[string]any{"in": []any{"a", variableRef{name: "name"}}},
+		"tag":   variableRef{name: "tag"},
+		"ok":    true,
+		"kind":  "RED",
+	}, value)
+	// variables without values are null
+	expectEqual[any](t, "value with variables", map[string]any{
+		"price": map[string]any{"gte": 1.5, "lt": int64(10)},
+		"name":  map[string]any{"in": []any{"a", "b"}},
+		"tag":   nil,
+		"ok":    true,
+		"kind":  "RED",
+	}, withVariables(value, map[string]any{"name": "b"}))
+}
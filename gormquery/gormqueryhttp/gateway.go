@@ -0,0 +1,355 @@
+package gormqueryhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/levav-enspiren/common-go/errorfactoryhttp"
+	"github.com/levav-enspiren/common-go/gormquery"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// header of idempotency key of POST and PATCH, forwarded as gormquery.IdempotencyKeyMetadataKey
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// path of the OpenAPI document, relative to the router group
+const OpenAPIPath = "/openapi.json"
+
+/*
+REST gateway of QueryServiceServer / QueryServiceModel
+
+Routes, relative to the router group:
+  - GET    /:modelClass : Get, with query parameters of ExtractQueryOption.
+    Response: {"results": [...], "totalCount": 0, "nextCursor": "", "facets": {...}}
+  - POST   /:modelClass : Create, with record data as body. Response: the created record
+  - PATCH  /:modelClass : Update records of "filter" query parameter, with partial data as body
+  - DELETE /:modelClass : Delete records of "filter" query parameter
+  - GET    /openapi.json : OpenAPI 3 document of the routes, if Document is provided
+
+Errors are rendered by errorfactoryhttp.StandardErrorHandling, with HTTP status of gRPC codes (ref: gormqueryhttp.GrpcHttpCodes).
+
+Example
+
+	gateway := gormqueryhttp.NewServerGateway(queryServiceServer)
+	gateway.Metadata = func(ctx *gin.Context) []string {
+		return []string{gormquery.ActorMetadataKey, ctx.GetString("userId")}
+	}
+	gateway.Register(router.Group("/query"))
+*/
+type Gateway struct {
+	Model *gormquery.QueryServiceModel
+	// exposed model classes, all model classes of the backend if it is not provided
+	ModelClasses []string
+	// outgoing gRPC metadata of a request as key-value pairs, e.g. actor of the audit log
+	Metadata func(ctx *gin.Context) []string
+	// OpenAPI document of the gateway at serverUrl (ref: gormquery.QueryServiceServer.OpenAPI)
+	Document func(serverUrl string) (document skmap.Map, err error)
+}
+
+// Gateway of a remote QueryServiceServer
+func NewGateway(model *gormquery.QueryServiceModel) *Gateway {
+	return &Gateway{Model: model}
+}
+
+// Gateway of an in-process QueryServiceServer, exposing all its model classes with the OpenAPI document
+func NewServerGateway(server *gormquery.QueryServiceServer) *Gateway {
+	modelClasses := []string{}
+	for name := range server.ModelClasses {
+		modelClasses = append(modelClasses, name)
+	}
+	sort.Strings(modelClasses)
+	g := &Gateway{
+		Model:        &gormquery.QueryServiceModel{GrpcClient: NewServerClient(server)},
+		ModelClasses: modelClasses,
+	}
+	g.Document = func(serverUrl string) (skmap.Map, error) {
+		return server.OpenAPI(gormquery.OpenAPIConfig{
+			ServerUrl:    serverUrl,
+			ModelClasses: g.ModelClasses,
+		})
+	}
+	return g
+}
+
+func (g *Gateway) Register(router gin.IRouter) {
+	if g.Document != nil {
+		serverUrl := ""
+		if group, ok := router.(interface{ BasePath() string }); ok {
+			serverUrl = group.BasePath()
+		}
+		router.GET(OpenAPIPath, func(ctx *gin.Context) {
+			document, err := g.Document(serverUrl)
+			if err != nil {
+				handleError(ctx, err)
+				return
+			}
+			ctx.JSON(http.StatusOK, document)
+		})
+	}
+	router.GET("/:modelClass", g.get)
+	router.POST("/:modelClass", g.create)
+	router.PATCH("/:modelClass", g.update)
+	router.DELETE("/:modelClass", g.delete)
+}
+
+/*
+Extract options of Get from query parameters
+
+  - field : selected fields, comma-separated, e.g. "id,name,item.item_name"
+  - page, limit : page number (from 0) and page size
+  - cursor : keyset pagination instead of page, "" for the first page
+  - keyword : keyword to search
+  - facets : fields to count records by distinct values, comma-separated, e.g. "status,category"
+  - sort : JSON of sort definition, e.g. {"price":"DESC"}, or "sorter" as the former name
+  - filter : JSON of filter, e.g. {"price":{"gte":10},"tags":["a","b"]}
+  - relations : JSON of limit, sort and filter of relations, e.g. {"comments":{"limit":5,"sort":{"id":"DESC"}}}
+*/
+func ExtractQueryOption(ctx *gin.Context) (options skmap.Map, err error) {
+	options = skmap.Map{}
+	if fieldStr := ctx.Query("field"); fieldStr != "" {
+		options["fields"] = strings.Split(fieldStr, ",")
+	}
+	if facetStr := ctx.Query("facets"); facetStr != "" {
+		options["facets"] = strings.Split(facetStr, ",")
+	}
+	for _, key := range []string{"page", "limit"} {
+		valueStr, ok := ctx.GetQuery(key)
+		if !ok {
+			continue
+		}
+		var value int
+		value, err = strconv.Atoi(valueStr)
+		if err != nil || value < 0 {
+			err = badRequest("invalid %s", key)
+			return
+		}
+		options[key] = value
+	}
+	if cursor, ok := ctx.GetQuery("cursor"); ok {
+		options["cursor"] = cursor
+	}
+	if keyword := ctx.Query("keyword"); keyword != "" {
+		options["keyword"] = keyword
+	}
+	for _, key := range []string{"sort", "filter", "relations"} {
+		value := ctx.Query(key)
+		if key == "sort" && value == "" {
+			// parameter name of the former extractor
+			value = ctx.Query("sorter")
+		}
+		if value == "" {
+			continue
+		}
+		var mapValue skmap.Map
+		err = json.Unmarshal([]byte(value), &mapValue)
+		if err != nil || mapValue == nil {
+			err = badRequest("invalid %s", key)
+			return
+		}
+		options[key] = mapValue
+	}
+	return
+}
+
+/*
+HTTP status of gRPC codes, which errorfactoryhttp.StandardErrorHandling would render as 500
+
+Other codes are rendered by errorfactoryhttp.StandardErrorHandling as is.
+*/
+var GrpcHttpCodes = map[codes.Code]int{
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusConflict,
+	codes.Aborted:            http.StatusConflict,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+}
+
+// render error with HTTP status of GrpcHttpCodes, and Retry-After of rate limits
+func handleError(ctx *gin.Context, err error) {
+	grpcStatus, ok := status.FromError(err)
+	if !ok {
+		errorfactoryhttp.StandardErrorHandling(ctx, err)
+		return
+	}
+	httpCode, ok := GrpcHttpCodes[grpcStatus.Code()]
+	if !ok {
+		errorfactoryhttp.StandardErrorHandling(ctx, err)
+		return
+	}
+	for _, detail := range grpcStatus.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok {
+			retryAfter := math.Ceil(retryInfo.RetryDelay.AsDuration().Seconds())
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Max(retryAfter, 1))))
+		}
+	}
+	errorfactoryhttp.StandardErrorHandling(ctx, &errorfactoryhttp.Error{
+		Code:    httpCode,
+		Message: grpcStatus.Message(),
+	})
+}
+
+func badRequest(format string, args ...any) error {
+	return &errorfactoryhttp.Error{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// model class of the path, and call options of the request
+func (g *Gateway) modelClass(ctx *gin.Context) (modelClass string, callOptions []gormquery.CallOption, err error) {
+	modelClass = ctx.Param("modelClass")
+	if len(g.ModelClasses) > 0 {
+		found := false
+		for _, name := range g.ModelClasses {
+			if name == modelClass {
+				found = true
+				break
+			}
+		}
+		if !found {
+			err = &errorfactoryhttp.Error{Code: http.StatusNotFound, Message: "invalid model class"}
+			return
+		}
+	}
+	if g.Metadata != nil {
+		if pairs := g.Metadata(ctx); len(pairs) > 0 {
+			callOptions = append(callOptions, gormquery.WithMetadata(pairs...))
+		}
+	}
+	return
+}
+
+// record data of body, which must be a JSON object
+func bindData(ctx *gin.Context) (data skmap.Map, err error) {
+	err = json.NewDecoder(ctx.Request.Body).Decode(&data)
+	if err != nil || data == nil {
+		err = badRequest("invalid body")
+	}
+	return
+}
+
+// filter of query parameter, which is required by PATCH and DELETE
+func extractFilter(ctx *gin.Context) (filter skmap.Map, err error) {
+	options, err := ExtractQueryOption(ctx)
+	if err != nil {
+		return
+	}
+	filter = options.GetMapDefault("filter", nil)
+	if len(filter) == 0 {
+		err = badRequest("missing filter")
+	}
+	return
+}
+
+func (g *Gateway) get(ctx *gin.Context) {
+	modelClass, callOptions, err := g.modelClass(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	options, err := ExtractQueryOption(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	options["modelClass"] = modelClass
+	page, err := g.Model.GetPage(ctx.Request.Context(), options, callOptions...)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, page)
+}
+
+// forward the Idempotency-Key header of the request, if any
+func withIdempotencyKey(ctx *gin.Context, callOptions []gormquery.CallOption) []gormquery.CallOption {
+	if idempotencyKey := ctx.GetHeader(IdempotencyKeyHeader); idempotencyKey != "" {
+		callOptions = append(callOptions, gormquery.WithMetadata(gormquery.IdempotencyKeyMetadataKey, idempotencyKey))
+	}
+	return callOptions
+}
+
+func (g *Gateway) create(ctx *gin.Context) {
+	modelClass, callOptions, err := g.modelClass(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	data, err := bindData(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	callOptions = withIdempotencyKey(ctx, callOptions)
+	result, err := g.Model.Create(ctx.Request.Context(), skmap.Map{
+		"modelClass": modelClass,
+		"data":       data,
+	}, callOptions...)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, result)
+}
+
+func (g *Gateway) update(ctx *gin.Context) {
+	modelClass, callOptions, err := g.modelClass(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	filter, err := extractFilter(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	data, err := bindData(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	callOptions = withIdempotencyKey(ctx, callOptions)
+	err = g.Model.Update(ctx.Request.Context(), skmap.Map{
+		"modelClass": modelClass,
+		"filter":     filter,
+		"data":       data,
+	}, callOptions...)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	errorfactoryhttp.SimpleResponse(ctx, http.StatusOK)
+}
+
+func (g *Gateway) delete(ctx *gin.Context) {
+	modelClass, callOptions, err := g.modelClass(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	filter, err := extractFilter(ctx)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	err = g.Model.Delete(ctx.Request.Context(), skmap.Map{
+		"modelClass": modelClass,
+		"filter":     filter,
+	}, callOptions...)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	errorfactoryhttp.SimpleResponse(ctx, http.StatusOK)
+}
@@ -0,0 +1,168 @@
+package gormqueryhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/levav-enspiren/common-go/gormquery"
+	"github.com/levav-enspiren/common-go/gormquery/gormquerytest"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type testItem struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+}
+
+func newTestRouter(t *testing.T, modelClass gormquery.ModelClass, server *gormquery.QueryServiceServer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	modelClass.Model = testItem{}
+	modelClass.CanGet, modelClass.CanCreate, modelClass.CanUpdate, modelClass.CanDelete = true, true, true, true
+	modelClass.WhitelistedFields = skmap.Map{"id": true, "name": true, "price": true}
+	h := gormquerytest.New(t, gormquerytest.Config{
+		Models:       []any{&testItem{}, &gormquery.IdempotencyRecord{}},
+		Fixtures:     []any{&[]testItem{{Name: "a", Price: 1}, {Name: "b", Price: 2}}},
+		ModelClasses: map[string]gormquery.ModelClass{"item": modelClass},
+		Server:       server,
+	})
+	router := gin.New()
+	NewServerGateway(h.Server).Register(router.Group("/query"))
+	return router
+}
+
+func serve(router *gin.Engine, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func expectStatus(t *testing.T, description string, expectedCode int, recorder *httptest.ResponseRecorder) {
+	t.Helper()
+	if recorder.Code != expectedCode {
+		t.Fatalf("%s should respond %d, but got %d: %s", description, expectedCode, recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestGateway(t *testing.T) {
+	router := newTestRouter(t, gormquery.ModelClass{}, nil)
+	recorder := serve(router, http.MethodGet, "/query/item?sort="+url.QueryEscape(`{"id":"ASC"}`)+"&limit=1", "")
+	expectStatus(t, "GET", http.StatusOK, recorder)
+	page := struct {
+		Results    []testItem `json:"results"`
+		TotalCount uint64     `json:"totalCount"`
+	}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil || page.TotalCount != 2 || len(page.Results) != 1 || page.Results[0].Name != "a" {
+		t.Fatalf("unexpected page %s", recorder.Body.String())
+	}
+	expectStatus(t, "POST", http.StatusCreated, serve(router, http.MethodPost, "/query/item", `{"name":"c","price":3}`))
+	filter := "?filter=" + url.QueryEscape(`{"name":"c"}`)
+	expectStatus(t, "PATCH", http.StatusOK, serve(router, http.MethodPatch, "/query/item"+filter, `{"price":30}`))
+	expectStatus(t, "DELETE", http.StatusOK, serve(router, http.MethodDelete, "/query/item"+filter, ""))
+	expectStatus(t, "GET of OpenAPI", http.StatusOK, serve(router, http.MethodGet, "/query/openapi.json", ""))
+
+	expectStatus(t, "GET of unknown model class", http.StatusNotFound, serve(router, http.MethodGet, "/query/unknown", ""))
+	expectStatus(t, "GET of invalid filter", http.StatusBadRequest, serve(router, http.MethodGet, "/query/item?filter=x", ""))
+	expectStatus(t, "PATCH without filter", http.StatusBadRequest, serve(router, http.MethodPatch, "/query/item", `{"price":30}`))
+	expectStatus(t, "POST of invalid body", http.StatusBadRequest, serve(router, http.MethodPost, "/query/item", `[]`))
+}
+
+func TestGatewayIdempotency(t *testing.T) {
+	server := &gormquery.QueryServiceServer{Idempotency: &gormquery.IdempotencyConfig{Table: "idempotency_records"}}
+	router := newTestRouter(t, gormquery.ModelClass{}, server)
+	serveKey := func(method string, path string, body string, idempotencyKey string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	price := func(name string) int {
+		recorder := serve(router, http.MethodGet, "/query/item?filter="+url.QueryEscape(`{"name":"`+name+`"}`), "")
+		page := struct {
+			Results []testItem `json:"results"`
+		}{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil || len(page.Results) != 1 {
+			t.Fatalf("unexpected page %s", recorder.Body.String())
+		}
+		return page.Results[0].Price
+	}
+
+	expectStatus(t, "POST with key", http.StatusCreated, serveKey(http.MethodPost, "/query/item", `{"name":"c","price":3}`, "k1"))
+	expectStatus(t, "replayed POST", http.StatusCreated, serveKey(http.MethodPost, "/query/item", `{"name":"c","price":3}`, "k1"))
+	expectStatus(t, "POST reusing key", http.StatusBadRequest, serveKey(http.MethodPost, "/query/item", `{"name":"d"}`, "k1"))
+
+	filter := "?filter=" + url.QueryEscape(`{"name":"a"}`)
+	expectStatus(t, "PATCH with key", http.StatusOK, serveKey(http.MethodPatch, "/query/item"+filter, `{"price":10}`, "k2"))
+	expectStatus(t, "PATCH without key", http.StatusOK, serve(router, http.MethodPatch, "/query/item"+filter, `{"price":5}`))
+	// the recorded response is replayed, without updating again
+	expectStatus(t, "replayed PATCH", http.StatusOK, serveKey(http.MethodPatch, "/query/item"+filter, `{"price":10}`, "k2"))
+	if price("a") != 5 {
+		t.Fatalf("replayed PATCH should not update, but got price %d", price("a"))
+	}
+	expectStatus(t, "PATCH reusing key", http.StatusBadRequest, serveKey(http.MethodPatch, "/query/item"+filter, `{"price":20}`, "k2"))
+}
+
+func TestGatewayErrors(t *testing.T) {
+	router := newTestRouter(t, gormquery.ModelClass{
+		ValidateData: func(data skmap.Map) error {
+			return errors.New("name is required")
+		},
+		RateLimits: map[string]gormquery.RateLimit{gormquery.OperationGet: {Rate: 0.001, Burst: 1}},
+	}, &gormquery.QueryServiceServer{RateLimiter: gormquery.NewMemoryRateLimiter()})
+	expectStatus(t, "POST of invalid data", http.StatusBadRequest, serve(router, http.MethodPost, "/query/item", `{"price":3}`))
+	expectStatus(t, "GET", http.StatusOK, serve(router, http.MethodGet, "/query/item", ""))
+	recorder := serve(router, http.MethodGet, "/query/item", "")
+	expectStatus(t, "GET of rate limit", http.StatusTooManyRequests, recorder)
+	if recorder.Header().Get("Retry-After") == "" {
+		t.Fatal("missing Retry-After")
+	}
+}
+
+func TestHandleError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handle := func(err error) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		handleError(ctx, err)
+		return recorder
+	}
+	expectedCodes := map[codes.Code]int{
+		codes.InvalidArgument:    http.StatusBadRequest,
+		codes.NotFound:           http.StatusNotFound,
+		codes.PermissionDenied:   http.StatusForbidden,
+		codes.FailedPrecondition: http.StatusConflict,
+		codes.Aborted:            http.StatusConflict,
+		codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+		codes.Unimplemented:      http.StatusNotImplemented,
+		codes.Unavailable:        http.StatusServiceUnavailable,
+		codes.Internal:           http.StatusInternalServerError,
+	}
+	for code, httpCode := range expectedCodes {
+		expectStatus(t, code.String(), httpCode, handle(status.Error(code, "error")))
+	}
+	expectStatus(t, "error without status", http.StatusInternalServerError, handle(errors.New("error")))
+
+	st, _ := status.New(codes.ResourceExhausted, "rate limit exceeded").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)})
+	recorder := handle(st.Err())
+	expectStatus(t, "ResourceExhausted", http.StatusTooManyRequests, recorder)
+	if recorder.Header().Get("Retry-After") != "2" {
+		t.Fatalf("Retry-After should be 2, but got %q", recorder.Header().Get("Retry-After"))
+	}
+	body := map[string]any{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body["message"] != "rate limit exceeded" {
+		t.Fatalf("unexpected body %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,45 @@
+module github.com/levav-enspiren/common-go/gormquery/gormqueryhttp
+
+go 1.18
+
+require (
+	github.com/gin-gonic/gin v1.8.2
+	github.com/levav-enspiren/common-go/errorfactoryhttp v1.0.0
+	github.com/levav-enspiren/common-go/gormquery v0.0.0-00010101000000-000000000000
+	github.com/levav-enspiren/common-go/gormquery/gormquerytest v0.0.0-00010101000000-000000000000
+	github.com/levav-enspiren/common-go/skmap v1.3.1
+	google.golang.org/genproto v0.0.0-20221118155620-16455021b5e6
+	google.golang.org/grpc v1.52.3
+	google.golang.org/protobuf v1.28.1
+)
+
+require (
+	github.com/gin-contrib/sse v0.1.0 // indirect
+	github.com/go-playground/locales v0.14.0 // indirect
+	github.com/go-playground/universal-translator v0.18.0 // indirect
+	github.com/go-playground/validator/v10 v10.11.1 // indirect
+	github.com/goccy/go-json v0.9.11 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/leodido/go-urn v1.2.1 // indirect
+	github.com/levav-enspiren/common-go/errorhandling v1.0.0 // indirect
+	github.com/mattn/go-isatty v0.0.16 // indirect
+	github.com/mattn/go-sqlite3 v1.14.15 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/pelletier/go-toml/v2 v2.0.6 // indirect
+	github.com/ugorji/go/codec v1.2.7 // indirect
+	golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3 // indirect
+	golang.org/x/net v0.4.0 // indirect
+	golang.org/x/sys v0.3.0 // indirect
+	golang.org/x/text v0.5.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gorm.io/driver/sqlite v1.4.4 // indirect
+	gorm.io/gorm v1.24.5 // indirect
+)
+
+replace github.com/levav-enspiren/common-go/gormquery => ../
+
+replace github.com/levav-enspiren/common-go/gormquery/gormquerytest => ../gormquerytest
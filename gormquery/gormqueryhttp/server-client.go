@@ -0,0 +1,61 @@
+package gormqueryhttp
+
+import (
+	"context"
+
+	"github.com/levav-enspiren/common-go/gormquery"
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+/*
+Client of an in-process QueryServiceServer, calling it without gRPC transport
+
+Outgoing metadata is passed to the server as incoming metadata. Import and Export streams are not supported.
+*/
+func NewServerClient(server *gormquery.QueryServiceServer) queryService.QueryServiceClient {
+	return &serverClient{server: server}
+}
+
+type serverClient struct {
+	server *gormquery.QueryServiceServer
+}
+
+func incomingContext(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+func (c *serverClient) Get(ctx context.Context, in *queryService.OptionRequest, opts ...grpc.CallOption) (*queryService.QueryResponse, error) {
+	return c.server.Get(incomingContext(ctx), in)
+}
+
+func (c *serverClient) GetOne(ctx context.Context, in *queryService.OptionRequest, opts ...grpc.CallOption) (*queryService.GetOneResponse, error) {
+	return c.server.GetOne(incomingContext(ctx), in)
+}
+
+func (c *serverClient) Create(ctx context.Context, in *queryService.OptionRequest, opts ...grpc.CallOption) (*queryService.CreateResponse, error) {
+	return c.server.Create(incomingContext(ctx), in)
+}
+
+func (c *serverClient) Update(ctx context.Context, in *queryService.OptionRequest, opts ...grpc.CallOption) (*queryService.WriteResponse, error) {
+	return c.server.Update(incomingContext(ctx), in)
+}
+
+func (c *serverClient) Delete(ctx context.Context, in *queryService.OptionRequest, opts ...grpc.CallOption) (*queryService.WriteResponse, error) {
+	return c.server.Delete(incomingContext(ctx), in)
+}
+
+func (c *serverClient) Import(ctx context.Context, opts ...grpc.CallOption) (queryService.QueryService_ImportClient, error) {
+	return nil, status.Error(codes.Unimplemented, "import is not supported in-process")
+}
+
+func (c *serverClient) Export(ctx context.Context, in *queryService.OptionRequest, opts ...grpc.CallOption) (queryService.QueryService_ExportClient, error) {
+	return nil, status.Error(codes.Unimplemented, "export is not supported in-process")
+}
@@ -0,0 +1,299 @@
+package gormquerytest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/gormquery"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Model of the conformance suite
+type ConformanceItem struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	Name     string `json:"name"`
+	Price    int    `json:"price"`
+	Category string `json:"category"`
+	// not whitelisted, so it is not filterable
+	Secret string `json:"secret"`
+}
+
+// model classes of the conformance suite
+const (
+	ConformanceModelClass         = "conformanceItem"
+	ConformanceReadOnlyModelClass = "conformanceItemReadOnly"
+	ConformanceDeniedModelClass   = "conformanceItemDenied"
+)
+
+var conformanceFixtures = []ConformanceItem{
+	{Name: "a", Price: 10, Category: "x"},
+	{Name: "b", Price: 20, Category: "x"},
+	{Name: "c", Price: 30, Category: "y"},
+	{Name: "d", Price: 40, Category: "y"},
+	{Name: "e", Price: 50, Category: "z"},
+	{Name: "f", Price: 60, Category: "z", Secret: "s"},
+}
+
+/*
+Run the conformance suite of filters, sorting, pagination and permissions
+
+The suite adds ConformanceItem and its model classes to config, so a customized server
+(e.g. config.Server, config.ServerOptions or config.Dialector of another database) could be verified.
+Existing rows of ConformanceItem are deleted.
+
+Example
+
+	func TestConformance(t *testing.T) {
+		gormquerytest.RunConformance(t, gormquerytest.Config{
+			ServerOptions: []grpc.ServerOption{grpc.UnaryInterceptor(authInterceptor)},
+		})
+	}
+*/
+func RunConformance(t *testing.T, config Config) {
+	whitelistedFields := skmap.Map{"id": true, "name": true, "price": true, "category": true}
+	config.Models = append(append([]any{}, config.Models...), &ConformanceItem{})
+	modelClasses := map[string]gormquery.ModelClass{}
+	for name, modelClass := range config.ModelClasses {
+		modelClasses[name] = modelClass
+	}
+	conformanceModelClasses := map[string]gormquery.ModelClass{
+		ConformanceModelClass: {
+			Model:             ConformanceItem{},
+			CanGet:            true,
+			CanCreate:         true,
+			CanUpdate:         true,
+			CanDelete:         true,
+			WhitelistedFields: whitelistedFields,
+		},
+		ConformanceReadOnlyModelClass: {
+			Model:             ConformanceItem{},
+			CanGet:            true,
+			WhitelistedFields: whitelistedFields,
+		},
+		ConformanceDeniedModelClass: {
+			Model:             ConformanceItem{},
+			WhitelistedFields: whitelistedFields,
+		},
+	}
+	for name, modelClass := range conformanceModelClasses {
+		modelClasses[name] = modelClass
+	}
+	config.ModelClasses = modelClasses
+	h := New(t, config)
+	err := h.Db.Where("1 = 1").Delete(&ConformanceItem{}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures := append([]ConformanceItem{}, conformanceFixtures...)
+	err = h.Db.Create(&fixtures).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &conformanceSuite{model: h.Model}
+	t.Run("Filter", s.testFilter)
+	t.Run("Sort", s.testSort)
+	t.Run("Pagination", s.testPagination)
+	t.Run("Cursor", s.testCursor)
+	t.Run("GetOne", s.testGetOne)
+	t.Run("Fields", s.testFields)
+	t.Run("Permission", s.testPermission)
+	t.Run("Write", s.testWrite)
+}
+
+type conformanceSuite struct {
+	model *gormquery.QueryServiceModel
+}
+
+// names of results of options on ConformanceModelClass
+func (s *conformanceSuite) names(t *testing.T, options skmap.Map) (names []string, totalCount uint64) {
+	t.Helper()
+	options["modelClass"] = ConformanceModelClass
+	results, totalCount, err := s.model.Get(context.Background(), options)
+	if err != nil {
+		t.Fatalf("get %v: %v", options, err)
+	}
+	for _, result := range results {
+		names = append(names, result.GetStringDefault("name", ""))
+	}
+	return
+}
+
+func (s *conformanceSuite) expectNames(t *testing.T, options skmap.Map, expected string, expectedTotalCount uint64) {
+	t.Helper()
+	names, totalCount := s.names(t, options)
+	if strings.Join(names, ",") != expected || totalCount != expectedTotalCount {
+		t.Errorf("options %v: expected %q of %d, got %q of %d", options, expected, expectedTotalCount, strings.Join(names, ","), totalCount)
+	}
+}
+
+func (s *conformanceSuite) testFilter(t *testing.T) {
+	byPrice := skmap.Map{"price": "ASC"}
+	s.expectNames(t, skmap.Map{"sort": byPrice, "filter": skmap.Map{"category": "x"}}, "a,b", 2)
+	s.expectNames(t, skmap.Map{"sort": byPrice, "filter": skmap.Map{"category": []string{"x", "z"}}}, "a,b,e,f", 4)
+	s.expectNames(t, skmap.Map{"sort": byPrice, "filter": skmap.Map{"price": skmap.Map{"gte": 20, "lt": 50}}}, "b,c,d", 3)
+	s.expectNames(t, skmap.Map{"sort": byPrice, "filter": skmap.Map{"price": skmap.Map{"in": []int{10, 60}}}}, "a,f", 2)
+	s.expectNames(t, skmap.Map{"sort": byPrice, "filter": skmap.Map{"name": skmap.Map{"like": "%"}, "category": skmap.Map{"ne": "y"}}}, "a,b,e,f", 4)
+	s.expectNames(t, skmap.Map{"sort": byPrice, "filter": skmap.Map{
+		"category":         "x",
+		gormquery.FilterOr: []skmap.Map{{"name": "a"}, {"price": skmap.Map{"gt": 50}}},
+	}}, "a", 1)
+	s.expectNames(t, skmap.Map{"sort": byPrice, "filter": skmap.Map{
+		gormquery.FilterOr: []skmap.Map{{"name": "a"}, {"price": skmap.Map{"gt": 50}}},
+	}}, "a,f", 2)
+	// not whitelisted
+	s.expectNames(t, skmap.Map{"sort": byPrice, "filter": skmap.Map{"secret": "s"}}, "a,b,c,d,e,f", 6)
+	_, _, err := s.model.Get(context.Background(), skmap.Map{
+		"modelClass": ConformanceModelClass,
+		"filter":     skmap.Map{"price": skmap.Map{"between": []int{1, 2}}},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unknown operator: expected InvalidArgument, got %v", err)
+	}
+}
+
+func (s *conformanceSuite) testSort(t *testing.T) {
+	s.expectNames(t, skmap.Map{"sort": skmap.Map{"price": "ASC"}}, "a,b,c,d,e,f", 6)
+	s.expectNames(t, skmap.Map{"sort": skmap.Map{"price": "DESC"}}, "f,e,d,c,b,a", 6)
+	s.expectNames(t, skmap.Map{"sort": skmap.Map{"name": "DESC"}, "filter": skmap.Map{"category": "y"}}, "d,c", 2)
+}
+
+func (s *conformanceSuite) testPagination(t *testing.T) {
+	byPrice := skmap.Map{"price": "ASC"}
+	s.expectNames(t, skmap.Map{"sort": byPrice, "limit": 4}, "a,b,c,d", 6)
+	s.expectNames(t, skmap.Map{"sort": byPrice, "limit": 4, "page": 1}, "e,f", 6)
+	s.expectNames(t, skmap.Map{"sort": byPrice, "limit": 2, "page": 1}, "c,d", 6)
+	s.expectNames(t, skmap.Map{"sort": byPrice, "limit": 2, "page": 3}, "", 6)
+	s.expectNames(t, skmap.Map{"sort": byPrice, "limit": 2, "filter": skmap.Map{"category": "z"}}, "e,f", 2)
+}
+
+func (s *conformanceSuite) testCursor(t *testing.T) {
+	it := s.model.Iterate(context.Background(), skmap.Map{
+		"modelClass": ConformanceModelClass,
+		"sort":       skmap.Map{"price": "DESC"},
+		"limit":      4,
+		"cursor":     "",
+	})
+	defer it.Close()
+	names := []string{}
+	for it.Next() {
+		names = append(names, it.Record().GetStringDefault("name", ""))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "f,e,d,c,b,a" {
+		t.Errorf("cursor: expected %q, got %q", "f,e,d,c,b,a", strings.Join(names, ","))
+	}
+}
+
+func (s *conformanceSuite) testGetOne(t *testing.T) {
+	ctx := context.Background()
+	result, err := s.model.GetOne(ctx, skmap.Map{
+		"modelClass": ConformanceModelClass,
+		"filter":     skmap.Map{"name": "c"},
+	})
+	if err != nil || result.GetIntDefault("price", 0) != 30 {
+		t.Errorf("get one: expected price 30, got %v, %v", result, err)
+	}
+	_, err = s.model.GetOne(ctx, skmap.Map{
+		"modelClass": ConformanceModelClass,
+		"filter":     skmap.Map{"name": "none"},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("get one: expected NotFound, got %v", err)
+	}
+	_, err = s.model.GetOne(ctx, skmap.Map{
+		"modelClass": ConformanceModelClass,
+		"filter":     skmap.Map{"category": "x"},
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("get one: expected FailedPrecondition, got %v", err)
+	}
+}
+
+func (s *conformanceSuite) testFields(t *testing.T) {
+	results, _, err := s.model.Get(context.Background(), skmap.Map{
+		"modelClass": ConformanceModelClass,
+		"fields":     []string{"name"},
+		"filter":     skmap.Map{"name": "f"},
+	})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("fields: expected 1 result, got %v, %v", results, err)
+	}
+	if results[0].GetStringDefault("name", "") != "f" || results[0].GetIntDefault("price", 0) != 0 || results[0].GetStringDefault("secret", "") != "" {
+		t.Errorf("fields: expected name only, got %v", results[0])
+	}
+}
+
+func (s *conformanceSuite) testPermission(t *testing.T) {
+	ctx := context.Background()
+	expectDenied := func(operation string, err error) {
+		t.Helper()
+		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+			t.Errorf("%s: expected permission denied, got %v", operation, err)
+		}
+	}
+	_, _, err := s.model.Get(ctx, skmap.Map{"modelClass": ConformanceDeniedModelClass})
+	expectDenied("get", err)
+	_, err = s.model.GetOne(ctx, skmap.Map{"modelClass": ConformanceDeniedModelClass, "filter": skmap.Map{"name": "a"}})
+	expectDenied("get one", err)
+	_, err = s.model.Create(ctx, skmap.Map{"modelClass": ConformanceReadOnlyModelClass, "data": skmap.Map{"name": "g"}})
+	expectDenied("create", err)
+	err = s.model.Update(ctx, skmap.Map{
+		"modelClass": ConformanceReadOnlyModelClass,
+		"filter":     skmap.Map{"name": "a"},
+		"data":       skmap.Map{"price": 0},
+	})
+	expectDenied("update", err)
+	err = s.model.Delete(ctx, skmap.Map{"modelClass": ConformanceReadOnlyModelClass, "filter": skmap.Map{"name": "a"}})
+	expectDenied("delete", err)
+	_, _, err = s.model.Get(ctx, skmap.Map{"modelClass": "conformanceItemUnknown"})
+	if err == nil {
+		t.Error("unknown model class: expected error")
+	}
+	// nothing is changed
+	s.expectNames(t, skmap.Map{"sort": skmap.Map{"price": "ASC"}, "filter": skmap.Map{"price": skmap.Map{"gt": 0}}}, "a,b,c,d,e,f", 6)
+}
+
+func (s *conformanceSuite) testWrite(t *testing.T) {
+	ctx := context.Background()
+	created, err := s.model.Create(ctx, skmap.Map{
+		"modelClass": ConformanceModelClass,
+		"data":       skmap.Map{"name": "g", "price": 70, "category": "w"},
+	})
+	if err != nil || created.GetIntDefault("id", 0) == 0 {
+		t.Fatalf("create: expected id, got %v, %v", created, err)
+	}
+	err = s.model.Update(ctx, skmap.Map{
+		"modelClass": ConformanceModelClass,
+		"filter":     skmap.Map{"name": "g"},
+		"data":       skmap.Map{"price": 71},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.expectNames(t, skmap.Map{"filter": skmap.Map{"price": 71}}, "g", 1)
+	// filters without whitelisted fields would update or delete every record, which is rejected
+	for _, filter := range []skmap.Map{{}, {"secret": "s"}} {
+		err = s.model.Update(ctx, skmap.Map{
+			"modelClass": ConformanceModelClass,
+			"filter":     filter,
+			"data":       skmap.Map{"price": 0},
+		})
+		if err == nil {
+			t.Errorf("update: expected missing filter of %v", filter)
+		}
+		err = s.model.Delete(ctx, skmap.Map{"modelClass": ConformanceModelClass, "filter": filter})
+		if err == nil {
+			t.Errorf("delete: expected missing filter of %v", filter)
+		}
+	}
+	err = s.model.Delete(ctx, skmap.Map{"modelClass": ConformanceModelClass, "filter": skmap.Map{"name": "g"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.expectNames(t, skmap.Map{"sort": skmap.Map{"price": "ASC"}}, "a,b,c,d,e,f", 6)
+}
@@ -0,0 +1,7 @@
+package gormquerytest
+
+import "testing"
+
+func TestConformance(t *testing.T) {
+	RunConformance(t, Config{})
+}
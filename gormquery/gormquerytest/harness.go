@@ -0,0 +1,184 @@
+package gormquerytest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/levav-enspiren/common-go/gormquery"
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// buffer size of the in-memory listener
+const bufferSize = 1 << 20
+
+type Config struct {
+	// database of the server, a SQLite database in a temporary directory if it is not provided
+	Dialector gorm.Dialector
+	// models to auto-migrate, e.g. &Item{}
+	Models []any
+	// records created in order after migration, e.g. &Item{Name: "a"} or &[]Item{...}
+	Fixtures []any
+	// model classes of the server, merged into those of Server
+	ModelClasses      map[string]gormquery.ModelClass
+	DefaultModelClass string
+	// template of the server, e.g. with Cache or RateLimiter. DefaultDb is set to the database if it is nil
+	Server *gormquery.QueryServiceServer
+	// gRPC server options, e.g. interceptors
+	ServerOptions []grpc.ServerOption
+	// timeout of each client call, 10s by default
+	RequestTimeout time.Duration
+}
+
+/*
+In-process QueryServiceServer over an in-memory gRPC listener
+
+Example
+
+	func TestItem(t *testing.T) {
+		h := gormquerytest.New(t, gormquerytest.Config{
+			Models:   []any{&Item{}},
+			Fixtures: []any{&[]Item{{Name: "a"}, {Name: "b"}}},
+			ModelClasses: map[string]gormquery.ModelClass{
+				"item": {Model: Item{}, CanGet: true, WhitelistedFields: skmap.Map{"id": true, "name": true}},
+			},
+			DefaultModelClass: "item",
+		})
+		results, totalCount, err := h.Model.Get(ctx, skmap.Map{"filter": skmap.Map{"name": "a"}})
+	}
+*/
+type Harness struct {
+	Db     *gorm.DB
+	Server *gormquery.QueryServiceServer
+	// client of the server, ready to use
+	Model *gormquery.QueryServiceModel
+	Conn  *grpc.ClientConn
+
+	grpcServer *grpc.Server
+	listener   *bufconn.Listener
+	tempDir    string
+}
+
+// Start a harness with t, which is closed on cleanup of t
+func New(t testing.TB, config Config) *Harness {
+	t.Helper()
+	h, err := Start(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+// Start a harness, which should be closed by Close
+func Start(config Config) (h *Harness, err error) {
+	h = &Harness{}
+	defer func() {
+		if err != nil {
+			h.Close()
+			h = nil
+		}
+	}()
+	dialector := config.Dialector
+	if dialector == nil {
+		h.tempDir, err = os.MkdirTemp("", "gormquerytest")
+		if err != nil {
+			return
+		}
+		dialector = sqlite.Open(fmt.Sprintf("file:%s?_busy_timeout=5000", filepath.Join(h.tempDir, "test.db")))
+	}
+	h.Db, err = gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return
+	}
+	if len(config.Models) > 0 {
+		err = h.Db.AutoMigrate(config.Models...)
+		if err != nil {
+			return
+		}
+	}
+	for _, fixture := range config.Fixtures {
+		err = h.Db.Create(fixture).Error
+		if err != nil {
+			err = fmt.Errorf("fixture %T: %w", fixture, err)
+			return
+		}
+	}
+	h.Server = newServer(h.Db, config)
+	// serve
+	h.listener = bufconn.Listen(bufferSize)
+	h.grpcServer = grpc.NewServer(config.ServerOptions...)
+	queryService.RegisterQueryServiceServer(h.grpcServer, h.Server)
+	go h.grpcServer.Serve(h.listener)
+	// dial
+	h.Conn, err = grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return h.listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return
+	}
+	requestTimeout := config.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = 10 * time.Second
+	}
+	h.Model = &gormquery.QueryServiceModel{
+		GrpcClient:     queryService.NewQueryServiceClient(h.Conn),
+		RequestTimeout: requestTimeout,
+	}
+	return
+}
+
+// copy of the template server with model classes of config
+func newServer(db *gorm.DB, config Config) *gormquery.QueryServiceServer {
+	server := &gormquery.QueryServiceServer{}
+	if config.Server != nil {
+		*server = *config.Server
+	}
+	modelClasses := map[string]gormquery.ModelClass{}
+	for name, modelClass := range server.ModelClasses {
+		modelClasses[name] = modelClass
+	}
+	for name, modelClass := range config.ModelClasses {
+		modelClasses[name] = modelClass
+	}
+	server.ModelClasses = modelClasses
+	if config.DefaultModelClass != "" {
+		server.DefaultModelClass = config.DefaultModelClass
+	}
+	if server.DefaultDb == nil {
+		server.DefaultDb = db
+	}
+	return server
+}
+
+// Stop the server and release the database
+func (h *Harness) Close() {
+	if h.Conn != nil {
+		h.Conn.Close()
+	}
+	if h.grpcServer != nil {
+		h.grpcServer.Stop()
+	}
+	if h.tempDir != "" {
+		// the database is owned by the harness only if it is the temporary one
+		if h.Db != nil {
+			if sqlDb, err := h.Db.DB(); err == nil {
+				sqlDb.Close()
+			}
+		}
+		os.RemoveAll(h.tempDir)
+	}
+}
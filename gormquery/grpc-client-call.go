@@ -0,0 +1,265 @@
+package gormquery
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Error of calls rejected by an open CircuitBreaker, with gRPC status Unavailable
+var ErrCircuitOpen = status.Error(codes.Unavailable, "circuit breaker is open")
+
+/*
+Retry policy of idempotent QueryServiceModel calls
+
+Get, GetOne, Update, Delete and Explain are idempotent. Create, and Update with option "jsonMerge"
+(a merge patch such as "$append" is applied again by each attempt), are idempotent only with an
+idempotency key (option "idempotencyKey" or metadata "x-idempotency-key"). Import and Export
+streams are never retried.
+*/
+type RetryPolicy struct {
+	// attempts including the first one, 3 by default
+	MaxAttempts int
+	// backoff before the first retry, 100ms by default
+	InitialBackoff time.Duration
+	// upper bound of backoff, 5s by default
+	MaxBackoff time.Duration
+	// backoff growth per retry, 2 by default
+	Multiplier float64
+	// retryable gRPC codes, Unavailable and DeadlineExceeded by default
+	Codes []codes.Code
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil {
+		return 1
+	}
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	retryCodes := p.Codes
+	if len(retryCodes) == 0 {
+		retryCodes = []codes.Code{codes.Unavailable, codes.DeadlineExceeded}
+	}
+	code := status.Code(err)
+	for _, retryCode := range retryCodes {
+		if code == retryCode {
+			return true
+		}
+	}
+	return false
+}
+
+// exponential backoff with jitter, within [backoff / 2, backoff)
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	initialBackoff, maxBackoff, multiplier := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+	if initialBackoff <= 0 {
+		initialBackoff = 100 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Second
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	backoff := float64(initialBackoff) * math.Pow(multiplier, float64(retry))
+	if backoff > float64(maxBackoff) {
+		backoff = float64(maxBackoff)
+	}
+	return time.Duration(backoff/2 + rand.Float64()*backoff/2)
+}
+
+/*
+Circuit breaker of QueryServiceModel calls
+
+After FailureThreshold consecutive failures (Unavailable / DeadlineExceeded), calls fail fast
+with ErrCircuitOpen for Cooldown. Then a single trial call is let through, which closes the
+circuit on success or opens it again on failure.
+
+Example
+
+	QueryServiceModel = gormquery.QueryServiceModel{
+		GrpcClient:     queryServiceClient,
+		RequestTimeout: 5 * time.Second,
+		RetryPolicy:    &gormquery.RetryPolicy{MaxAttempts: 3},
+		CircuitBreaker: &gormquery.CircuitBreaker{FailureThreshold: 5, Cooldown: 10 * time.Second},
+	}
+*/
+type CircuitBreaker struct {
+	// consecutive failures to open the circuit, 5 by default
+	FailureThreshold int
+	// duration of open circuit before a trial call, 10s by default
+	Cooldown time.Duration
+
+	mutex    sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func (b *CircuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	cooldown := b.Cooldown
+	if cooldown <= 0 {
+		cooldown = 10 * time.Second
+	}
+	if b.trial || time.Since(b.openedAt) < cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *CircuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.trial = false
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+	case codes.Canceled:
+		// cancelled by the caller, which tells nothing about the server
+		return
+	default:
+		// the server is healthy, even if the call is rejected
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return
+	}
+	b.failures++
+	threshold := b.FailureThreshold
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if b.failures >= threshold || !b.openedAt.IsZero() {
+		b.openedAt = time.Now()
+	}
+}
+
+// Per-call option of QueryServiceModel
+type CallOption func(config *callConfig)
+
+type callConfig struct {
+	timeout     time.Duration
+	metadata    []string
+	retryPolicy *RetryPolicy
+}
+
+// timeout of each attempt, instead of QueryServiceModel.RequestTimeout
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(config *callConfig) {
+		config.timeout = timeout
+	}
+}
+
+// outgoing gRPC metadata, as key-value pairs
+func WithMetadata(pairs ...string) CallOption {
+	return func(config *callConfig) {
+		config.metadata = append(config.metadata, pairs...)
+	}
+}
+
+// retry policy instead of QueryServiceModel.RetryPolicy, nil to disable retry
+func WithRetryPolicy(retryPolicy *RetryPolicy) CallOption {
+	return func(config *callConfig) {
+		config.retryPolicy = retryPolicy
+	}
+}
+
+const (
+	// a single attempt
+	callOnce = iota
+	// retried by retry policy
+	callIdempotent
+	// a stream, bounded by ctx only
+	callStream
+)
+
+/*
+Invoke call with timeout, metadata, retry and circuit breaker
+
+The call is retried with backoff if mode is callIdempotent and the error is retryable,
+until the attempts run out or ctx is done.
+*/
+func (m *QueryServiceModel) invoke(ctx context.Context, mode int, callOptions []CallOption, call func(ctx context.Context) error) (err error) {
+	config := &callConfig{
+		timeout:     m.RequestTimeout,
+		retryPolicy: m.RetryPolicy,
+	}
+	for _, callOption := range callOptions {
+		callOption(config)
+	}
+	if len(config.metadata) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, config.metadata...)
+	}
+	attempts := 1
+	if mode == callIdempotent {
+		attempts = config.retryPolicy.maxAttempts()
+	}
+	for attempt := 1; ; attempt++ {
+		if !m.CircuitBreaker.allow() {
+			return ErrCircuitOpen
+		}
+		err = m.attempt(ctx, mode, config.timeout, call)
+		m.CircuitBreaker.record(err)
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !config.retryPolicy.retryable(err) {
+			return
+		}
+		timer := time.NewTimer(config.retryPolicy.backoff(attempt - 1))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (m *QueryServiceModel) attempt(ctx context.Context, mode int, timeout time.Duration, call func(ctx context.Context) error) error {
+	if mode != callStream && timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return call(ctx)
+}
+
+// idempotency key of options, ctx or call options, which makes Create and merge patch Update idempotent
+func hasIdempotencyKey(ctx context.Context, options map[string]any, callOptions []CallOption) bool {
+	if key, _ := options["idempotencyKey"].(string); key != "" {
+		return true
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(IdempotencyKeyMetadataKey)) > 0 {
+		return true
+	}
+	config := &callConfig{}
+	for _, callOption := range callOptions {
+		callOption(config)
+	}
+	for i := 0; i+1 < len(config.metadata); i += 2 {
+		if strings.ToLower(config.metadata[i]) == IdempotencyKeyMetadataKey {
+			return true
+		}
+	}
+	return false
+}
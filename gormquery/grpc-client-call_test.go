@@ -0,0 +1,180 @@
+package gormquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// client failing with errs in order before success, recording the calls
+type testFlakyClient struct {
+	queryService.QueryServiceClient
+	errs  []error
+	calls []context.Context
+}
+
+func (c *testFlakyClient) call(ctx context.Context) error {
+	c.calls = append(c.calls, ctx)
+	if len(c.errs) == 0 {
+		return nil
+	}
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	return err
+}
+
+func (c *testFlakyClient) Get(ctx context.Context, in *queryService.OptionRequest, opts ...grpc.CallOption) (*queryService.QueryResponse, error) {
+	return &queryService.QueryResponse{Results: []byte("[]")}, c.call(ctx)
+}
+
+func (c *testFlakyClient) Create(ctx context.Context, in *queryService.OptionRequest, opts ...grpc.CallOption) (*queryService.CreateResponse, error) {
+	return &queryService.CreateResponse{Result: []byte("{}")}, c.call(ctx)
+}
+
+func (c *testFlakyClient) Update(ctx context.Context, in *queryService.OptionRequest, opts ...grpc.CallOption) (*queryService.WriteResponse, error) {
+	return &queryService.WriteResponse{}, c.call(ctx)
+}
+
+var testUnavailable = status.Error(codes.Unavailable, "unavailable")
+
+func newTestFlakyModel(errs ...error) (*QueryServiceModel, *testFlakyClient) {
+	client := &testFlakyClient{errs: errs}
+	return &QueryServiceModel{
+		GrpcClient:  client,
+		RetryPolicy: &RetryPolicy{InitialBackoff: time.Millisecond},
+	}, client
+}
+
+func TestRetry(t *testing.T) {
+	model, client := newTestFlakyModel(testUnavailable, status.Error(codes.DeadlineExceeded, "deadline"))
+	_, _, err := model.Get(testCtx, skmap.Map{})
+	expectNoError(t, err)
+	expectEqual(t, "attempts of retryable errors", 3, len(client.calls))
+
+	model, client = newTestFlakyModel(testUnavailable, testUnavailable, testUnavailable)
+	_, _, err = model.Get(testCtx, skmap.Map{})
+	expectCode(t, "Get out of attempts", codes.Unavailable, err)
+	expectEqual(t, "attempts", 3, len(client.calls))
+
+	model, client = newTestFlakyModel(status.Error(codes.InvalidArgument, "invalid"))
+	_, _, err = model.Get(testCtx, skmap.Map{})
+	expectCode(t, "Get of non-retryable error", codes.InvalidArgument, err)
+	expectEqual(t, "attempts of non-retryable error", 1, len(client.calls))
+
+	model, client = newTestFlakyModel(testUnavailable)
+	_, _, err = model.Get(testCtx, skmap.Map{}, WithRetryPolicy(nil))
+	expectCode(t, "Get without retry policy", codes.Unavailable, err)
+	expectEqual(t, "attempts without retry policy", 1, len(client.calls))
+}
+
+func TestRetryCreate(t *testing.T) {
+	model, client := newTestFlakyModel(testUnavailable)
+	_, err := model.Create(testCtx, skmap.Map{})
+	expectCode(t, "Create without idempotency key", codes.Unavailable, err)
+	expectEqual(t, "attempts without idempotency key", 1, len(client.calls))
+
+	idempotentCalls := map[string]func(model *QueryServiceModel) error{
+		"option": func(model *QueryServiceModel) error {
+			_, err := model.Create(testCtx, skmap.Map{"idempotencyKey": "k1"})
+			return err
+		},
+		"context": func(model *QueryServiceModel) error {
+			_, err := model.Create(ContextWithIdempotencyKey(testCtx, "k1"), skmap.Map{})
+			return err
+		},
+		"call option": func(model *QueryServiceModel) error {
+			_, err := model.Create(testCtx, skmap.Map{}, WithMetadata("X-Idempotency-Key", "k1"))
+			return err
+		},
+	}
+	for description, call := range idempotentCalls {
+		model, client = newTestFlakyModel(testUnavailable)
+		expectNoError(t, call(model))
+		expectEqual(t, "attempts with idempotency key of "+description, 2, len(client.calls))
+	}
+}
+
+func TestRetryUpdate(t *testing.T) {
+	model, client := newTestFlakyModel(testUnavailable)
+	expectNoError(t, model.Update(testCtx, skmap.Map{"data": skmap.Map{"price": 1}}))
+	expectEqual(t, "attempts of Update", 2, len(client.calls))
+
+	// a merge patch is applied again by each attempt
+	model, client = newTestFlakyModel(testUnavailable)
+	err := model.Update(testCtx, skmap.Map{"jsonMerge": true})
+	expectCode(t, "Update of jsonMerge without idempotency key", codes.Unavailable, err)
+	expectEqual(t, "attempts of jsonMerge without idempotency key", 1, len(client.calls))
+
+	model, client = newTestFlakyModel(testUnavailable)
+	expectNoError(t, model.Update(ContextWithIdempotencyKey(testCtx, "k1"), skmap.Map{"jsonMerge": true}))
+	expectEqual(t, "attempts of jsonMerge with idempotency key", 2, len(client.calls))
+}
+
+func TestCallOptions(t *testing.T) {
+	model, client := newTestFlakyModel()
+	model.RequestTimeout = time.Minute
+	_, _, err := model.Get(testCtx, skmap.Map{}, WithTimeout(time.Second), WithMetadata("x-a", "1"))
+	expectNoError(t, err)
+	deadline, ok := client.calls[0].Deadline()
+	expect(t, "deadline of WithTimeout", ok && time.Until(deadline) <= time.Second)
+	md, _ := metadata.FromOutgoingContext(client.calls[0])
+	expectEqual(t, "metadata", []string{"1"}, md.Get("x-a"))
+
+	ctx, cancel := context.WithCancel(testCtx)
+	cancel()
+	model, client = newTestFlakyModel(testUnavailable)
+	model.RetryPolicy.InitialBackoff = time.Minute
+	_, _, err = model.Get(ctx, skmap.Map{})
+	expectCode(t, "Get of cancelled context", codes.Unavailable, err)
+	expectEqual(t, "attempts of cancelled context", 1, len(client.calls))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	for i := 0; i < 10; i++ {
+		backoff := policy.backoff(1)
+		expect(t, "backoff within [150ms, 300ms)", backoff >= 150*time.Millisecond && backoff < 300*time.Millisecond)
+		backoff = policy.backoff(5)
+		expect(t, "backoff bounded by MaxBackoff", backoff >= 500*time.Millisecond && backoff < time.Second)
+	}
+	expectEqual(t, "attempts of nil policy", 1, (*RetryPolicy)(nil).maxAttempts())
+	expectEqual(t, "attempts by default", 3, (&RetryPolicy{}).maxAttempts())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	model, client := newTestFlakyModel(testUnavailable, testUnavailable, testUnavailable)
+	model.RetryPolicy = nil
+	model.CircuitBreaker = &CircuitBreaker{FailureThreshold: 2, Cooldown: 20 * time.Millisecond}
+	get := func() error {
+		_, _, err := model.Get(testCtx, skmap.Map{})
+		return err
+	}
+	expectCode(t, "first failure", codes.Unavailable, get())
+	expectCode(t, "second failure", codes.Unavailable, get())
+	expect(t, "open circuit", get() == ErrCircuitOpen)
+	expectEqual(t, "calls", 2, len(client.calls))
+
+	// a failed trial opens the circuit again
+	time.Sleep(30 * time.Millisecond)
+	expectCode(t, "failed trial", codes.Unavailable, get())
+	expect(t, "reopened circuit", get() == ErrCircuitOpen)
+	time.Sleep(30 * time.Millisecond)
+	expectNoError(t, get())
+	expectNoError(t, get())
+	expectEqual(t, "calls after recovery", 5, len(client.calls))
+
+	// rejected calls tell the server is healthy
+	breaker := &CircuitBreaker{FailureThreshold: 2}
+	breaker.record(testUnavailable)
+	breaker.record(status.Error(codes.NotFound, "not found"))
+	breaker.record(testUnavailable)
+	breaker.record(status.Error(codes.Canceled, "canceled"))
+	expect(t, "closed circuit", breaker.allow())
+}
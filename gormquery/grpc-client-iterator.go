@@ -0,0 +1,217 @@
+package gormquery
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/levav-enspiren/common-go/skmap"
+)
+
+// page size of iterators if "limit" is not provided
+const defaultIteratorPageSize = 100
+
+/*
+Iterator over all records of Get, fetching pages lazily
+
+Pages are read by keyset pagination if "cursor" is in options (e.g. "" from QueryBuilder.Cursor),
+or by page offset otherwise. The next page is prefetched while the current one is consumed.
+Records inserted or deleted during an offset iteration may shift pages, so cursor mode is
+preferred for large or changing tables.
+
+Example
+
+	it := QueryServiceModel.Iterate(ctx, options)
+	defer it.Close()
+	for it.Next() {
+		record := it.Record()
+	}
+	err := it.Err()
+
+	// range-over-func, since go 1.23
+	for record, err := range QueryServiceModel.Iterate(ctx, options).All() {
+	}
+*/
+type QueryIterator[T any] struct {
+	// total count of the filter, available after the first Next
+	TotalCount uint64
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	fetch      func(ctx context.Context, options skmap.Map) queryPage[T]
+	options    skmap.Map
+	cursorMode bool
+	page       int
+	fetched    uint64
+	pending    chan queryPage[T]
+	records    []T
+	index      int
+	record     T
+	err        error
+	closed     bool
+}
+
+type queryPage[T any] struct {
+	records    []T
+	totalCount uint64
+	nextCursor string
+	err        error
+}
+
+// Iterate all records of options, ref: gormquery.QueryIterator
+func (m *QueryServiceModel) Iterate(ctx context.Context, options skmap.Map, callOptions ...CallOption) *QueryIterator[skmap.Map] {
+	return newQueryIterator[skmap.Map](ctx, m, options, callOptions)
+}
+
+// Iterate all records of options, ref: gormquery.QueryIterator
+func (m *TypedQueryServiceModel[T]) Iterate(ctx context.Context, options skmap.Map, callOptions ...CallOption) *QueryIterator[T] {
+	return newQueryIterator[T](ctx, &m.QueryServiceModel, m.options(options, true), callOptions)
+}
+
+func newQueryIterator[T any](ctx context.Context, m *QueryServiceModel, options skmap.Map, callOptions []CallOption) *QueryIterator[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	it := &QueryIterator[T]{
+		ctx:     ctx,
+		cancel:  cancel,
+		options: skmap.Map{},
+		fetch: func(ctx context.Context, options skmap.Map) (page queryPage[T]) {
+			response, err := m.get(ctx, options, callOptions)
+			if err != nil {
+				page.err = err
+				return
+			}
+			page.err = json.Unmarshal(response.Results, &page.records)
+			page.totalCount = response.TotalCount
+			page.nextCursor = response.NextCursor
+			return
+		},
+	}
+	for key, value := range options {
+		it.options[key] = value
+	}
+	if it.options.GetIntDefault("limit", 0) <= 0 {
+		it.options["limit"] = defaultIteratorPageSize
+	}
+	_, it.cursorMode = it.options.GetDefault("cursor", nil).(string)
+	if !it.cursorMode {
+		it.page = it.options.GetIntDefault("page", 0)
+		it.options["page"] = it.page
+	}
+	it.pending = it.prefetch(it.options)
+	return it
+}
+
+// fetch page in background. The channel is buffered, so the fetch never blocks after Close
+func (it *QueryIterator[T]) prefetch(options skmap.Map) chan queryPage[T] {
+	pending := make(chan queryPage[T], 1)
+	go func() {
+		pending <- it.fetch(it.ctx, options)
+	}()
+	return pending
+}
+
+// options of the page after current one, or nil if it is the last page
+func (it *QueryIterator[T]) nextOptions(page queryPage[T]) skmap.Map {
+	if len(page.records) == 0 {
+		return nil
+	}
+	options := skmap.Map{}
+	for key, value := range it.options {
+		options[key] = value
+	}
+	if it.cursorMode {
+		if page.nextCursor == "" {
+			return nil
+		}
+		options["cursor"] = page.nextCursor
+		return options
+	}
+	if it.fetched >= it.TotalCount {
+		return nil
+	}
+	it.page++
+	options["page"] = it.page
+	return options
+}
+
+// Advance to the next record. It returns false at the end, on error, or when ctx is done
+func (it *QueryIterator[T]) Next() bool {
+	if it.closed {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.fail(err)
+		return false
+	}
+	for it.index >= len(it.records) {
+		if it.pending == nil {
+			return false
+		}
+		var page queryPage[T]
+		select {
+		case page = <-it.pending:
+		case <-it.ctx.Done():
+			it.fail(it.ctx.Err())
+			return false
+		}
+		if page.err != nil {
+			it.fail(page.err)
+			return false
+		}
+		it.TotalCount = page.totalCount
+		it.fetched += uint64(len(page.records))
+		it.records = page.records
+		it.index = 0
+		it.pending = nil
+		if options := it.nextOptions(page); options != nil {
+			it.pending = it.prefetch(options)
+		}
+	}
+	it.record = it.records[it.index]
+	it.index++
+	return true
+}
+
+// current record
+func (it *QueryIterator[T]) Record() T {
+	return it.record
+}
+
+// error which stopped the iteration
+func (it *QueryIterator[T]) Err() error {
+	return it.err
+}
+
+// stop the iteration, cancelling the prefetch
+func (it *QueryIterator[T]) Close() {
+	it.closed = true
+	it.cancel()
+	it.pending = nil
+	it.records = nil
+}
+
+func (it *QueryIterator[T]) fail(err error) {
+	if it.err == nil {
+		it.err = err
+	}
+	it.Close()
+}
+
+/*
+Sequence of records, in the form of iter.Seq2 for range-over-func
+
+An error is yielded with zero record as the last element. The iterator is closed when the loop ends.
+*/
+func (it *QueryIterator[T]) All() func(yield func(record T, err error) bool) {
+	return func(yield func(record T, err error) bool) {
+		defer it.Close()
+		for it.Next() {
+			if !yield(it.Record(), nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package gormquery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+)
+
+// names of all records of the iterator
+func testIteratorNames(t *testing.T, it *QueryIterator[skmap.Map]) (names []string) {
+	t.Helper()
+	defer it.Close()
+	for it.Next() {
+		names = append(names, it.Record().GetStringDefault("name", ""))
+	}
+	expectNoError(t, it.Err())
+	return
+}
+
+func TestQueryIterator(t *testing.T) {
+	db := newTestDb(t)
+	expectNoError(t, db.Create(&[]testItem{{Name: "d", Price: 2}, {Name: "e", Price: 1}}).Error)
+	model := newTestModel(t, newTestServer(db, ModelClass{}))
+
+	it := model.Iterate(testCtx, skmap.Map{"limit": 2, "sort": skmap.Map{"id": "ASC"}})
+	expectEqual(t, "names of pages", []string{"a", "b", "c", "d", "e"}, testIteratorNames(t, it))
+	expectEqual(t, "total count", uint64(5), it.TotalCount)
+	it = model.Iterate(testCtx, skmap.Map{"limit": 2, "page": 1, "sort": skmap.Map{"id": "ASC"}})
+	expectEqual(t, "names from page 1", []string{"c", "d", "e"}, testIteratorNames(t, it))
+	it = model.Iterate(testCtx, skmap.Map{"limit": 2, "cursor": "", "sort": skmap.Map{"price": "DESC"}})
+	expectEqual(t, "names of cursor", []string{"c", "d", "b", "e", "a"}, testIteratorNames(t, it))
+	it = model.Iterate(testCtx, skmap.Map{"filter": skmap.Map{"name": "z"}})
+	expectEqual(t, "names of no results", []string(nil), testIteratorNames(t, it))
+
+	typedModel := NewTypedQueryServiceModel[testItem](*model, "item")
+	names := []string{}
+	// range-over-func is not available in go 1.18
+	typedModel.Iterate(testCtx, skmap.Map{"limit": 2, "filter": skmap.Map{"price": 2}}).All()(func(item testItem, err error) bool {
+		expectNoError(t, err)
+		names = append(names, item.Name)
+		return true
+	})
+	expectEqual(t, "names of All", []string{"b", "d"}, names)
+}
+
+func TestQueryIteratorErrors(t *testing.T) {
+	db := newTestDb(t)
+	model := newTestModel(t, newTestServer(db, ModelClass{}))
+	it := model.Iterate(testCtx, skmap.Map{"modelClass": "unknown"})
+	expect(t, "Next of error", !it.Next())
+	expectCode(t, "Err", codes.InvalidArgument, it.Err())
+	var allErr error
+	model.Iterate(testCtx, skmap.Map{"modelClass": "unknown"}).All()(func(_ skmap.Map, err error) bool {
+		allErr = err
+		return true
+	})
+	expectCode(t, "error of All", codes.InvalidArgument, allErr)
+
+	ctx, cancel := context.WithCancel(testCtx)
+	it = model.Iterate(ctx, skmap.Map{"limit": 1})
+	expect(t, "Next before cancel", it.Next())
+	cancel()
+	expect(t, "Next after cancel", !it.Next())
+	expect(t, "Err after cancel", it.Err() == context.Canceled)
+
+	it = model.Iterate(testCtx, skmap.Map{"limit": 1})
+	it.Close()
+	expect(t, "Next after Close", !it.Next())
+	expectNoError(t, it.Err())
+}
@@ -3,83 +3,337 @@ package gormquery
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/levav-enspiren/common-go/gormquery/queryService"
 	"github.com/levav-enspiren/common-go/skmap"
 )
 
+/*
+Client model of QueryServiceServer
+
+Each call could take CallOption, e.g. gormquery.WithTimeout, gormquery.WithMetadata and gormquery.WithRetryPolicy.
+*/
 type QueryServiceModel struct {
-	GrpcClient     queryService.QueryServiceClient
+	GrpcClient queryService.QueryServiceClient
+	// timeout of each attempt of unary calls, no timeout if it is not provided
 	RequestTimeout time.Duration
+	// retry policy of idempotent calls, no retry if it is not provided
+	RetryPolicy *RetryPolicy
+	// circuit breaker shared by calls of the model, disabled if it is not provided
+	CircuitBreaker *CircuitBreaker
+}
+
+func (m *QueryServiceModel) Get(ctx context.Context, options skmap.Map, callOptions ...CallOption) (results []skmap.Map, totalCount uint64, err error) {
+	response, err := m.get(ctx, options, callOptions)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response.Results, &results)
+	if err != nil {
+		return
+	}
+	totalCount = response.TotalCount
+	return
 }
 
-func (m *QueryServiceModel) Get(ctx context.Context, options skmap.Map) (results []skmap.Map, totalCount uint64, err error) {
-	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(m.RequestTimeout))
-	defer cancel()
+// Page of Get, with results in raw JSON
+type QueryPage struct {
+	Results    json.RawMessage `json:"results"`
+	TotalCount uint64          `json:"totalCount"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+	// counts of option "facets", facet field to []FacetValue
+	Facets json.RawMessage `json:"facets,omitempty"`
+}
+
+// Get a page without decoding results, e.g. to be relayed as is
+func (m *QueryServiceModel) GetPage(ctx context.Context, options skmap.Map, callOptions ...CallOption) (page QueryPage, err error) {
+	response, err := m.get(ctx, options, callOptions)
+	if err != nil {
+		return
+	}
+	page = QueryPage{
+		Results:    response.Results,
+		TotalCount: response.TotalCount,
+		NextCursor: response.NextCursor,
+		Facets:     response.Facets,
+	}
+	return
+}
+
+func (m *QueryServiceModel) get(ctx context.Context, options skmap.Map, callOptions []CallOption) (response *queryService.QueryResponse, err error) {
 	optionsBytes, err := json.Marshal(options)
 	if err != nil {
 		return
 	}
-	response, err := m.GrpcClient.Get(ctx, &queryService.OptionRequest{
-		Options: optionsBytes,
+	err = m.invoke(ctx, callIdempotent, callOptions, func(ctx context.Context) (err error) {
+		response, err = m.GrpcClient.Get(ctx, &queryService.OptionRequest{
+			Options: optionsBytes,
+		})
+		return
 	})
+	return
+}
+
+func (m *QueryServiceModel) GetOne(ctx context.Context, options skmap.Map, callOptions ...CallOption) (result skmap.Map, err error) {
+	resultBytes, err := m.getOne(ctx, options, callOptions)
 	if err != nil {
 		return
 	}
-	err = json.Unmarshal(response.Results, &results)
+	err = json.Unmarshal(resultBytes, &result)
+	return
+}
+
+func (m *QueryServiceModel) getOne(ctx context.Context, options skmap.Map, callOptions []CallOption) (result []byte, err error) {
+	optionsBytes, err := json.Marshal(options)
 	if err != nil {
 		return
 	}
-	totalCount = response.TotalCount
+	err = m.invoke(ctx, callIdempotent, callOptions, func(ctx context.Context) error {
+		response, err := m.GrpcClient.GetOne(ctx, &queryService.OptionRequest{
+			Options: optionsBytes,
+		})
+		if err != nil {
+			return err
+		}
+		result = response.Result
+		return nil
+	})
 	return
 }
 
-func (m *QueryServiceModel) Create(ctx context.Context, options skmap.Map) (result skmap.Map, err error) {
-	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(m.RequestTimeout))
-	defer cancel()
+/*
+Create a record
+
+It is retried by RetryPolicy only with an idempotency key, e.g. gormquery.ContextWithIdempotencyKey.
+*/
+func (m *QueryServiceModel) Create(ctx context.Context, options skmap.Map, callOptions ...CallOption) (result skmap.Map, err error) {
+	resultBytes, err := m.create(ctx, options, callOptions)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(resultBytes, &result)
+	return
+}
+
+func (m *QueryServiceModel) create(ctx context.Context, options skmap.Map, callOptions []CallOption) (result []byte, err error) {
 	optionsBytes, err := json.Marshal(options)
 	if err != nil {
 		return
 	}
-	response, err := m.GrpcClient.Create(ctx, &queryService.OptionRequest{
-		Options: optionsBytes,
+	mode := callOnce
+	if hasIdempotencyKey(ctx, options, callOptions) {
+		mode = callIdempotent
+	}
+	err = m.invoke(ctx, mode, callOptions, func(ctx context.Context) error {
+		response, err := m.GrpcClient.Create(ctx, &queryService.OptionRequest{
+			Options: optionsBytes,
+		})
+		if err != nil {
+			return err
+		}
+		result = response.Result
+		return nil
 	})
+	return
+}
+
+/*
+Update records of filter with data
+
+It is retried by RetryPolicy, except with option "jsonMerge" which is retried only with an idempotency key.
+*/
+func (m *QueryServiceModel) Update(ctx context.Context, options skmap.Map, callOptions ...CallOption) (err error) {
+	optionsBytes, err := json.Marshal(options)
 	if err != nil {
 		return
 	}
-	err = json.Unmarshal(response.Result, &result)
-	return
+	mode := callIdempotent
+	if options.GetBoolDefault("jsonMerge", false) && !hasIdempotencyKey(ctx, options, callOptions) {
+		mode = callOnce
+	}
+	return m.invoke(ctx, mode, callOptions, func(ctx context.Context) error {
+		_, err := m.GrpcClient.Update(ctx, &queryService.OptionRequest{
+			Options: optionsBytes,
+		})
+		return err
+	})
 }
 
-func (m *QueryServiceModel) Update(ctx context.Context, options skmap.Map) (err error) {
-	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(m.RequestTimeout))
-	defer cancel()
+func (m *QueryServiceModel) Delete(ctx context.Context, options skmap.Map, callOptions ...CallOption) (err error) {
 	optionsBytes, err := json.Marshal(options)
 	if err != nil {
 		return
 	}
-	_, err = m.GrpcClient.Update(ctx, &queryService.OptionRequest{
+	return m.invoke(ctx, callIdempotent, callOptions, func(ctx context.Context) error {
+		_, err := m.GrpcClient.Delete(ctx, &queryService.OptionRequest{
+			Options: optionsBytes,
+		})
+		return err
+	})
+}
+
+/*
+Explain "get", "update" or "delete" operation without executing it
+
+Set "explainPlan" in options to include the database EXPLAIN plan.
+*/
+func (m *QueryServiceModel) Explain(ctx context.Context, operation string, options skmap.Map, callOptions ...CallOption) (explain Explain, err error) {
+	explainOptions := skmap.Map{}
+	for key, value := range options {
+		explainOptions[key] = value
+	}
+	explainOptions["explain"] = true
+	optionsBytes, err := json.Marshal(explainOptions)
+	if err != nil {
+		return
+	}
+	request := &queryService.OptionRequest{
 		Options: optionsBytes,
+	}
+	var explainBytes []byte
+	err = m.invoke(ctx, callIdempotent, callOptions, func(ctx context.Context) (err error) {
+		switch operation {
+		case "get":
+			var response *queryService.QueryResponse
+			response, err = m.GrpcClient.Get(ctx, request)
+			if err == nil {
+				explainBytes = response.Explain
+			}
+		case "update":
+			var response *queryService.WriteResponse
+			response, err = m.GrpcClient.Update(ctx, request)
+			if err == nil {
+				explainBytes = response.Explain
+			}
+		case "delete":
+			var response *queryService.WriteResponse
+			response, err = m.GrpcClient.Delete(ctx, request)
+			if err == nil {
+				explainBytes = response.Explain
+			}
+		default:
+			err = fmt.Errorf("unknown operation %s", operation)
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(explainBytes, &explain)
+	return
+}
+
+// chunk size of Import stream
+const importChunkSize = 64 * 1024
+
+type ImportResult struct {
+	TotalCount    uint64
+	ImportedCount uint64
+	Errors        []ImportRowError
+}
+
+/*
+Import records from CSV / NDJSON reader
+
+The file is streamed in chunks, so ctx should allow the whole upload rather than a single request.
+Options are the same as QueryServiceServer.Import (modelClass, format, batchSize, atomic).
+*/
+func (m *QueryServiceModel) Import(ctx context.Context, options skmap.Map, reader io.Reader, callOptions ...CallOption) (result ImportResult, err error) {
+	err = m.invoke(ctx, callStream, callOptions, func(ctx context.Context) (err error) {
+		result, err = m.importStream(ctx, options, reader)
+		return
 	})
+	return
+}
+
+func (m *QueryServiceModel) importStream(ctx context.Context, options skmap.Map, reader io.Reader) (result ImportResult, err error) {
+	optionsBytes, err := json.Marshal(options)
+	if err != nil {
+		return
+	}
+	stream, err := m.GrpcClient.Import(ctx)
 	if err != nil {
 		return
 	}
+	request := &queryService.ImportRequest{Options: optionsBytes}
+	buffer := make([]byte, importChunkSize)
+	for {
+		n, readErr := reader.Read(buffer)
+		if n > 0 {
+			request.Data = buffer[:n]
+			err = stream.Send(request)
+			if err != nil {
+				return
+			}
+			request = &queryService.ImportRequest{}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			err = readErr
+			return
+		}
+	}
+	// options must be sent even if the file is empty
+	if len(request.Options) > 0 {
+		err = stream.Send(request)
+		if err != nil {
+			return
+		}
+	}
+	response, err := stream.CloseAndRecv()
+	if err != nil {
+		return
+	}
+	result.TotalCount = response.TotalCount
+	result.ImportedCount = response.ImportedCount
+	err = json.Unmarshal(response.Errors, &result.Errors)
 	return
 }
 
-func (m *QueryServiceModel) Delete(ctx context.Context, options skmap.Map) (err error) {
-	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(m.RequestTimeout))
-	defer cancel()
+/*
+Export records to writer, in the format of options "format" ("json", "ndjson" or "csv")
+
+Records are streamed page by page, so ctx should allow the whole download rather than a single request.
+*/
+func (m *QueryServiceModel) Export(ctx context.Context, options skmap.Map, writer io.Writer, callOptions ...CallOption) (totalCount uint64, err error) {
+	err = m.invoke(ctx, callStream, callOptions, func(ctx context.Context) (err error) {
+		totalCount, err = m.exportStream(ctx, options, writer)
+		return
+	})
+	return
+}
+
+func (m *QueryServiceModel) exportStream(ctx context.Context, options skmap.Map, writer io.Writer) (totalCount uint64, err error) {
 	optionsBytes, err := json.Marshal(options)
 	if err != nil {
 		return
 	}
-	_, err = m.GrpcClient.Delete(ctx, &queryService.OptionRequest{
+	stream, err := m.GrpcClient.Export(ctx, &queryService.OptionRequest{
 		Options: optionsBytes,
 	})
 	if err != nil {
 		return
 	}
-	return
+	for {
+		var chunk *queryService.ExportChunk
+		chunk, err = stream.Recv()
+		if err == io.EOF {
+			return totalCount, nil
+		}
+		if err != nil {
+			return
+		}
+		if chunk.TotalCount > 0 {
+			totalCount = chunk.TotalCount
+		}
+		_, err = writer.Write(chunk.Data)
+		if err != nil {
+			return
+		}
+	}
 }
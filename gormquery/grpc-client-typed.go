@@ -0,0 +1,247 @@
+package gormquery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+/*
+Typed model of QueryServiceModel, decoding results into T
+
+Fields are columns of T, by gORM tag "column" or the default naming strategy, while field names
+of UpdateFields are JSON names of T. Fields of struct or slice-of-struct type (relations) and
+fields tagged `gormquery:"-"` are excluded from the default field list.
+
+Example
+
+	type Item struct {
+		ID     uint64   `json:"id" gorm:"primaryKey"`
+		Name   string   `json:"name"`
+		Tags   []string `json:"tags" gorm:"serializer:json"`
+		Parent *Item    `json:"parent,omitempty"`
+	}
+
+	itemModel := gormquery.NewTypedQueryServiceModel[Item](QueryServiceModel, "item")
+	items, totalCount, err := itemModel.Get(ctx, skmap.Map{"filter": skmap.Map{"name": "a"}})
+	item, err := itemModel.Create(ctx, Item{Name: "b"})
+	err = itemModel.Update(ctx, skmap.Map{"id": item.ID}, Item{Name: "c"})
+*/
+type TypedQueryServiceModel[T any] struct {
+	QueryServiceModel
+	// model class name, set into options if it is not provided
+	ModelClass string
+	// fields of Get / GetOne if "fields" is not provided
+	DefaultFields []string
+
+	fields []typedField
+}
+
+type typedField struct {
+	name       string
+	column     string
+	index      []int
+	primaryKey bool
+	// auto time of gORM, e.g. CreatedAt, UpdatedAt and DeletedAt
+	autoTime bool
+}
+
+var typedColumnNaming = schema.NamingStrategy{}
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+func NewTypedQueryServiceModel[T any](model QueryServiceModel, modelClass string) *TypedQueryServiceModel[T] {
+	m := &TypedQueryServiceModel[T]{
+		QueryServiceModel: model,
+		ModelClass:        modelClass,
+	}
+	var record T
+	m.fields = typedFieldsOf(reflect.TypeOf(record), nil, "")
+	for _, field := range m.fields {
+		m.DefaultFields = append(m.DefaultFields, field.column)
+	}
+	return m
+}
+
+// column fields of struct type, including fields of embedded structs with their column prefix
+func typedFieldsOf(t reflect.Type, index []int, columnPrefix string) (fields []typedField) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+		if !structField.IsExported() || structField.Tag.Get("gormquery") == "-" {
+			continue
+		}
+		name := strings.Split(structField.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		gormTag := schema.ParseTagSetting(structField.Tag.Get("gorm"), ";")
+		if structField.Anonymous && name == "" {
+			fields = append(fields, typedFieldsOf(structField.Type, fieldIndex, columnPrefix+gormTag["EMBEDDEDPREFIX"])...)
+			continue
+		}
+		if isRelationType(structField.Type) {
+			continue
+		}
+		if name == "" {
+			name = structField.Name
+		}
+		column := gormTag["COLUMN"]
+		if column == "" {
+			column = typedColumnNaming.ColumnName("", structField.Name)
+		}
+		_, primaryKey := gormTag["PRIMARYKEY"]
+		_, autoCreateTime := gormTag["AUTOCREATETIME"]
+		_, autoUpdateTime := gormTag["AUTOUPDATETIME"]
+		fields = append(fields, typedField{
+			name:       name,
+			column:     columnPrefix + column,
+			index:      fieldIndex,
+			primaryKey: primaryKey || structField.Name == "ID",
+			autoTime: autoCreateTime || autoUpdateTime || structField.Name == "CreatedAt" || structField.Name == "UpdatedAt" ||
+				structField.Type == deletedAtType,
+		})
+	}
+	return
+}
+
+// struct or slice of struct, except time.Time and JSON marshalers
+func isRelationType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return false
+	}
+	return !t.Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()) &&
+		!reflect.PointerTo(t).Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem())
+}
+
+// copy of options with model class and default fields
+func (m *TypedQueryServiceModel[T]) options(options skmap.Map, withFields bool) skmap.Map {
+	typedOptions := skmap.Map{}
+	for key, value := range options {
+		typedOptions[key] = value
+	}
+	if _, ok := typedOptions["modelClass"]; !ok && m.ModelClass != "" {
+		typedOptions["modelClass"] = m.ModelClass
+	}
+	if _, ok := typedOptions["fields"]; !ok && withFields && len(m.DefaultFields) > 0 {
+		typedOptions["fields"] = m.DefaultFields
+	}
+	return typedOptions
+}
+
+/*
+Record data of typed fields, keyed by columns
+
+All fields are included if names is nil, except a zero primary key which is left to the database,
+and zero auto time fields which would be stored as a zero time. Otherwise only the named fields are included.
+*/
+func (m *TypedQueryServiceModel[T]) data(record T, names map[string]bool) skmap.Map {
+	value := reflect.ValueOf(record)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return skmap.Map{}
+		}
+		value = value.Elem()
+	}
+	data := skmap.Map{}
+	if value.Kind() != reflect.Struct {
+		return data
+	}
+	for _, field := range m.fields {
+		fieldValue, err := value.FieldByIndexErr(field.index)
+		if err != nil {
+			// nil embedded pointer
+			continue
+		}
+		if names == nil && (field.primaryKey || field.autoTime) && fieldValue.IsZero() {
+			continue
+		}
+		if names != nil && !names[field.name] {
+			continue
+		}
+		data[field.column] = fieldValue.Interface()
+	}
+	return data
+}
+
+func (m *TypedQueryServiceModel[T]) Get(ctx context.Context, options skmap.Map, callOptions ...CallOption) (results []T, totalCount uint64, err error) {
+	response, err := m.get(ctx, m.options(options, true), callOptions)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response.Results, &results)
+	if err != nil {
+		return
+	}
+	totalCount = response.TotalCount
+	return
+}
+
+func (m *TypedQueryServiceModel[T]) GetOne(ctx context.Context, options skmap.Map, callOptions ...CallOption) (result T, err error) {
+	resultBytes, err := m.getOne(ctx, m.options(options, true), callOptions)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(resultBytes, &result)
+	return
+}
+
+func (m *TypedQueryServiceModel[T]) Create(ctx context.Context, record T, callOptions ...CallOption) (result T, err error) {
+	resultBytes, err := m.create(ctx, m.options(skmap.Map{"data": m.data(record, nil)}, false), callOptions)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(resultBytes, &result)
+	return
+}
+
+// Update records matching filter with non-zero fields of partial record
+func (m *TypedQueryServiceModel[T]) Update(ctx context.Context, filter skmap.Map, partial T, callOptions ...CallOption) (err error) {
+	value := reflect.ValueOf(partial)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return errors.New("missing data")
+	}
+	fields := []string{}
+	for _, field := range m.fields {
+		fieldValue, fieldErr := value.FieldByIndexErr(field.index)
+		if fieldErr == nil && !fieldValue.IsZero() {
+			fields = append(fields, field.name)
+		}
+	}
+	return m.UpdateFields(ctx, filter, partial, fields, callOptions...)
+}
+
+// Update records matching filter with the named fields of partial record, including zero values
+func (m *TypedQueryServiceModel[T]) UpdateFields(ctx context.Context, filter skmap.Map, partial T, fields []string, callOptions ...CallOption) (err error) {
+	names := map[string]bool{}
+	for _, field := range fields {
+		names[field] = true
+	}
+	return m.QueryServiceModel.Update(ctx, m.options(skmap.Map{
+		"filter": filter,
+		"data":   m.data(partial, names),
+	}, false), callOptions...)
+}
+
+func (m *TypedQueryServiceModel[T]) Delete(ctx context.Context, filter skmap.Map, callOptions ...CallOption) (err error) {
+	return m.QueryServiceModel.Delete(ctx, m.options(skmap.Map{"filter": filter}, false), callOptions...)
+}
@@ -0,0 +1,75 @@
+package gormquery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"gorm.io/gorm"
+)
+
+// JSON names differ from columns, with auto time fields of gorm.Model
+type testTypedRecord struct {
+	gorm.Model
+	ItemName   string        `json:"itemName"`
+	Price      int           `json:"cost" gorm:"column:amount"`
+	Secret     string        `json:"secret" gormquery:"-"`
+	CategoryID uint          `json:"categoryId"`
+	Category   *testCategory `json:"category,omitempty"`
+}
+
+func newTestTypedModel(t *testing.T) (*TypedQueryServiceModel[testTypedRecord], *gorm.DB) {
+	db := newTestDb(t)
+	expectNoError(t, db.AutoMigrate(&testTypedRecord{}))
+	server := newTestServer(db, ModelClass{
+		Model: testTypedRecord{},
+		WhitelistedFields: skmap.Map{
+			"id": true, "created_at": true, "updated_at": true, "deleted_at": true, "item_name": true, "amount": true, "category_id": true,
+		},
+	})
+	return NewTypedQueryServiceModel[testTypedRecord](*newTestModel(t, server), "item"), db
+}
+
+func TestTypedFields(t *testing.T) {
+	model, _ := newTestTypedModel(t)
+	expectEqual(t, "default fields", []string{"id", "created_at", "updated_at", "deleted_at", "item_name", "amount", "category_id"}, model.DefaultFields)
+
+	data := model.data(testTypedRecord{ItemName: "a", Price: 1}, nil)
+	expectEqual(t, "data of zero primary key and auto time", skmap.Map{"item_name": "a", "amount": 1, "category_id": uint(0)}, data)
+	createdAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	data = model.data(testTypedRecord{Model: gorm.Model{ID: 5, CreatedAt: createdAt}, ItemName: "a"}, nil)
+	expectEqual(t, "data of non-zero primary key and auto time", skmap.Map{"id": uint(5), "created_at": createdAt, "item_name": "a", "amount": 0, "category_id": uint(0)}, data)
+	data = model.data(testTypedRecord{Price: 2}, map[string]bool{"cost": true})
+	expectEqual(t, "data of named fields", skmap.Map{"amount": 2}, data)
+}
+
+func TestTypedModel(t *testing.T) {
+	model, db := newTestTypedModel(t)
+	created, err := model.Create(testCtx, testTypedRecord{ItemName: "a", Price: 1})
+	expectNoError(t, err)
+	expect(t, "primary key of Create", created.ID > 0)
+	stored := testTypedRecord{}
+	expectNoError(t, db.Take(&stored, created.ID).Error)
+	expectEqual(t, "item name", "a", stored.ItemName)
+	expectEqual(t, "price", 1, stored.Price)
+	expect(t, "created at", time.Since(stored.CreatedAt) < time.Minute)
+	expect(t, "updated at", time.Since(stored.UpdatedAt) < time.Minute)
+	var zeroTimeCount int64
+	expectNoError(t, db.Model(&testTypedRecord{}).Where("created_at IS NULL OR created_at < ? OR deleted_at IS NOT NULL", "1970-01-01").Count(&zeroTimeCount).Error)
+	expectEqual(t, "records with zero or missing auto time", int64(0), zeroTimeCount)
+
+	_, err = model.Create(testCtx, testTypedRecord{ItemName: "b", Price: 2})
+	expectNoError(t, err)
+	expectNoError(t, model.Update(testCtx, skmap.Map{"item_name": "a"}, testTypedRecord{Price: 10}))
+	expectNoError(t, model.UpdateFields(testCtx, skmap.Map{"item_name": "b"}, testTypedRecord{}, []string{"cost"}))
+
+	results, totalCount, err := model.Get(testCtx, skmap.Map{"sort": skmap.Map{"id": "ASC"}})
+	expectNoError(t, err)
+	expectEqual(t, "total count", uint64(2), totalCount)
+	expectEqual(t, "prices", []int{10, 0}, []int{results[0].Price, results[1].Price})
+	expectEqual(t, "item name", "a", results[0].ItemName)
+
+	result, err := model.GetOne(testCtx, skmap.Map{"id": created.ID})
+	expectNoError(t, err)
+	expectEqual(t, "item name of GetOne", "a", result.ItemName)
+}
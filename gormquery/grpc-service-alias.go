@@ -0,0 +1,191 @@
+package gormquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"gorm.io/gorm/schema"
+)
+
+// translate API field name to column name. Sub-fields of relations are kept as is
+func (mc *ModelClass) column(field string) string {
+	if column, ok := mc.FieldAliases[field]; ok {
+		return column
+	}
+	return field
+}
+
+// translate column name back to API field name
+func (mc *ModelClass) apiField(column string) string {
+	for field, aliasColumn := range mc.FieldAliases {
+		if aliasColumn == column {
+			return field
+		}
+	}
+	return column
+}
+
+// translate keys of API field map to column names
+func (mc *ModelClass) columnMap(m skmap.Map) skmap.Map {
+	if m == nil {
+		return nil
+	}
+	columnMap := skmap.Map{}
+	for field, value := range m {
+		columnMap[mc.column(field)] = value
+	}
+	return columnMap
+}
+
+/*
+Translate API field names of options to column names
+
+Applied to "fields", "filter", "sort", "data" and the whitelisted fields of the model class,
+so that the rest of the query works on column names only.
+*/
+func (mc *ModelClass) applyFieldAliases(options skmap.Map) {
+	if len(mc.FieldAliases) == 0 {
+		return
+	}
+	mc.WhitelistedFields = mc.columnMap(mc.WhitelistedFields)
+	if fields := options.GetStringArraySafe("fields"); len(fields) > 0 {
+		columns := []any{}
+		for _, field := range fields {
+			if strings.Contains(field, ".") {
+				columns = append(columns, field)
+				continue
+			}
+			columns = append(columns, mc.column(field))
+		}
+		options["fields"] = columns
+	}
+	if filter := options.GetMapDefault("filter", nil); filter != nil {
+		options["filter"] = mc.filterColumnMap(filter)
+	}
+	for _, key := range []string{"sort", "data"} {
+		if m := options.GetMapDefault(key, nil); m != nil {
+			options[key] = mc.columnMap(m)
+		}
+	}
+}
+
+// columnMap of filter, including alternatives of "$or"
+func (mc *ModelClass) filterColumnMap(filter skmap.Map) skmap.Map {
+	columnFilter := mc.columnMap(filter)
+	alternatives, ok := columnFilter[FilterOr].([]any)
+	if !ok {
+		return columnFilter
+	}
+	columnAlternatives := []any{}
+	for _, alternative := range alternatives {
+		if alternativeFilter, ok := alternative.(map[string]any); ok {
+			alternative = map[string]any(mc.filterColumnMap(alternativeFilter))
+		}
+		columnAlternatives = append(columnAlternatives, alternative)
+	}
+	columnFilter[FilterOr] = columnAlternatives
+	return columnFilter
+}
+
+// translate column name to the key of results marshalled from the model: API field of an alias, or JSON name of the model field
+func (mc *ModelClass) resultKey(modelSchema *schema.Schema, column string) string {
+	if field := mc.apiField(column); field != column {
+		return field
+	}
+	if schemaField := modelSchema.LookUpField(column); schemaField != nil {
+		if name := propertyNameOf(schemaField); name != "" {
+			return name
+		}
+	}
+	return column
+}
+
+// JSON names of aliased model fields to API field names
+func (mc *ModelClass) jsonAliases(modelSchema *schema.Schema) map[string]string {
+	aliases := map[string]string{}
+	for field, column := range mc.FieldAliases {
+		schemaField := modelSchema.LookUpField(column)
+		if schemaField == nil {
+			continue
+		}
+		if name := propertyNameOf(schemaField); name != "" {
+			aliases[name] = field
+		}
+	}
+	return aliases
+}
+
+// key of the field in JSON encoded model
+func jsonNameOf(field *schema.Field) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// JSON name of a field, or "" if it is not marshalled
+func propertyNameOf(field *schema.Field) string {
+	if field.Tag.Get("json") == "-" {
+		return ""
+	}
+	return jsonNameOf(field)
+}
+
+/*
+Translate JSON names of results marshalled from the model back to API field names
+
+Input could be an object or an array of objects.
+*/
+func (mc *ModelClass) aliasResult(modelSchema *schema.Schema, result []byte) (aliased []byte, err error) {
+	if len(mc.FieldAliases) == 0 {
+		return result, nil
+	}
+	return renameKeys(result, mc.jsonAliases(modelSchema))
+}
+
+// Translate column names of record data, e.g. data of Create, back to API field names
+func (mc *ModelClass) aliasData(data []byte) (aliased []byte, err error) {
+	if len(mc.FieldAliases) == 0 {
+		return data, nil
+	}
+	aliases := map[string]string{}
+	for field, column := range mc.FieldAliases {
+		aliases[column] = field
+	}
+	return renameKeys(data, aliases)
+}
+
+// rename keys of a JSON object or an array of objects
+func renameKeys(result []byte, names map[string]string) (renamed []byte, err error) {
+	rename := func(record map[string]json.RawMessage) map[string]json.RawMessage {
+		renamed := map[string]json.RawMessage{}
+		for key, value := range record {
+			if name, ok := names[key]; ok {
+				key = name
+			}
+			renamed[key] = value
+		}
+		return renamed
+	}
+	trimmed := bytes.TrimSpace(result)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var records []map[string]json.RawMessage
+		err = json.Unmarshal(trimmed, &records)
+		if err != nil {
+			return
+		}
+		for i, record := range records {
+			records[i] = rename(record)
+		}
+		return json.Marshal(records)
+	}
+	var record map[string]json.RawMessage
+	err = json.Unmarshal(trimmed, &record)
+	if err != nil || record == nil {
+		return result, err
+	}
+	return json.Marshal(rename(record))
+}
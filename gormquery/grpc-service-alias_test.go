@@ -0,0 +1,88 @@
+package gormquery
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+)
+
+// JSON names differ from columns, e.g. "itemName" of column "item_name"
+type testAliasRecord struct {
+	ID       uint   `json:"id"`
+	ItemName string `json:"itemName"`
+	Price    int    `json:"cost"`
+}
+
+func newTestAliasServer(t *testing.T) *QueryServiceServer {
+	db := newTestDb(t)
+	expectNoError(t, db.AutoMigrate(&testAliasRecord{}))
+	expectNoError(t, db.Create(&[]testAliasRecord{{ItemName: "a", Price: 1}, {ItemName: "b", Price: 2}}).Error)
+	return newTestServer(db, ModelClass{
+		Model:             testAliasRecord{},
+		FieldAliases:      map[string]string{"title": "item_name", "amount": "price"},
+		WhitelistedFields: skmap.Map{"id": true, "title": true, "amount": true},
+	})
+}
+
+func TestFieldAliases(t *testing.T) {
+	server := newTestAliasServer(t)
+	response, err := server.Get(testCtx, optionRequest(skmap.Map{
+		"fields": []string{"id", "title", "amount"},
+		"filter": skmap.Map{"amount": skmap.Map{"gte": 2}},
+		"sort":   skmap.Map{"title": "DESC"},
+	}))
+	expectNoError(t, err)
+	expectEqual(t, "results", []map[string]any{{"id": float64(2), "title": "b", "amount": float64(2)}}, decodeResults[map[string]any](t, response.Results))
+
+	getOneResponse, err := server.GetOne(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"title": "a"}, "fields": []string{"title"}}))
+	expectNoError(t, err)
+	result := map[string]any{}
+	expectNoError(t, json.Unmarshal(getOneResponse.Result, &result))
+	expectEqual[any](t, "title of GetOne", "a", result["title"])
+	expect(t, "JSON name is renamed", result["itemName"] == nil)
+
+	createResponse, err := server.Create(testCtx, optionRequest(skmap.Map{"data": skmap.Map{"title": "c", "amount": 3}}))
+	expectNoError(t, err)
+	result = map[string]any{}
+	expectNoError(t, json.Unmarshal(createResponse.Result, &result))
+	expectEqual[any](t, "title of Create", "c", result["title"])
+	expectEqual[any](t, "amount of Create", float64(3), result["amount"])
+
+	_, err = server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"title": "c"}, "data": skmap.Map{"amount": 30}}))
+	expectNoError(t, err)
+	record := testAliasRecord{}
+	expectNoError(t, server.DefaultDb.Where("item_name = ?", "c").Take(&record).Error)
+	expectEqual(t, "price of update", 30, record.Price)
+}
+
+func TestFieldAliasesCsv(t *testing.T) {
+	server := newTestAliasServer(t)
+	response, err := server.Get(testCtx, optionRequest(skmap.Map{"fields": []string{"title", "amount"}, "format": ResultFormatCsv}))
+	expectNoError(t, err)
+	expectEqual(t, "csv", "title,amount\na,1\nb,2\n", string(response.Results))
+}
+
+func TestResultKey(t *testing.T) {
+	db := newTestDb(t)
+	modelSchema, err := schemaOf(db, testAliasRecord{})
+	expectNoError(t, err)
+	modelClass := ModelClass{FieldAliases: map[string]string{"title": "item_name"}}
+	expectEqual(t, "key of aliased column", "title", modelClass.resultKey(modelSchema, "item_name"))
+	expectEqual(t, "key of column", "cost", modelClass.resultKey(modelSchema, "price"))
+	expectEqual(t, "key of relation field", "category.name", modelClass.resultKey(modelSchema, "category.name"))
+
+	aliased, err := modelClass.aliasData([]byte(`{"item_name": "a", "price": 1}`))
+	expectNoError(t, err)
+	expectEqual(t, "aliased data", `{"price":1,"title":"a"}`, string(aliased))
+}
+
+func TestFieldAliasesOpenAPI(t *testing.T) {
+	server := newTestAliasServer(t)
+	document, err := server.OpenAPI(OpenAPIConfig{})
+	expectNoError(t, err)
+	properties := document.GetMapDefault("components.schemas.ItemRecord.properties", nil)
+	expect(t, "record schema", properties != nil)
+	expect(t, "properties of aliased columns", properties["title"] != nil && properties["amount"] != nil)
+	expect(t, "JSON names of aliased columns", properties["itemName"] == nil && properties["cost"] == nil)
+}
@@ -0,0 +1,301 @@
+package gormquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	AuditOperationCreate = "create"
+	AuditOperationUpdate = "update"
+	AuditOperationDelete = "delete"
+)
+
+// gRPC metadata key carrying the actor of a request
+const ActorMetadataKey = "x-actor"
+
+const defaultAuditTable = "audit_trails"
+
+/*
+Audit trail config of a model class
+
+Each create / update / delete on the model class writes one AuditRecord per
+affected row into Table, in the same transaction as the operation itself.
+
+Example
+
+	"item": {
+		Model:     postgres.Item{},
+		CanUpdate: true,
+		Audit: &gormquery.AuditConfig{
+			Table: "item_audit_trails",
+		},
+	},
+*/
+type AuditConfig struct {
+	// Table of audit records. "audit_trails" would be used if it is not provided
+	Table string
+	// Actor extractor. ActorFromContext would be used if it is not provided
+	GetActor func(ctx context.Context) string
+}
+
+/*
+Record of audit table
+
+The table could be created by
+
+	db.Table("audit_trails").AutoMigrate(&gormquery.AuditRecord{})
+*/
+type AuditRecord struct {
+	ID         uint64    `gorm:"primaryKey" json:"id"`
+	Actor      string    `gorm:"index" json:"actor"`
+	Operation  string    `json:"operation"`
+	ModelClass string    `gorm:"index" json:"modelClass"`
+	RecordKey  string    `gorm:"index" json:"recordKey"`
+	Filter     skmap.Map `gorm:"type:json" json:"filter"`
+	Before     skmap.Map `gorm:"type:json" json:"before"`
+	After      skmap.Map `gorm:"type:json" json:"after"`
+	Diff       skmap.Map `gorm:"type:json" json:"diff"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Attach actor to outgoing gRPC metadata, for QueryServiceModel calls
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, ActorMetadataKey, actor)
+}
+
+// Extract actor from incoming gRPC metadata
+func ActorFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(ActorMetadataKey)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+/*
+Compute field difference of 2 snapshots
+
+Output
+
+	key (string): changed field
+	value (skmap.Map): { "from": beforeValue, "to": afterValue }
+*/
+func DiffRecords(before map[string]any, after map[string]any) (diff skmap.Map) {
+	diff = skmap.Map{}
+	for field, beforeValue := range before {
+		afterValue, ok := after[field]
+		if ok && reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		diff[field] = skmap.Map{"from": beforeValue, "to": afterValue}
+	}
+	for field, afterValue := range after {
+		if _, ok := before[field]; ok {
+			continue
+		}
+		diff[field] = skmap.Map{"from": nil, "to": afterValue}
+	}
+	return
+}
+
+// auditor collects snapshots of a write operation. It does nothing if the model class is not audited.
+type auditor struct {
+	ctx        context.Context
+	tx         *gorm.DB
+	modelClass ModelClass
+	operation  string
+	filter     skmap.Map
+	primaryKey string
+	before     []map[string]any
+}
+
+func newAuditor(ctx context.Context, tx *gorm.DB, modelClass ModelClass, operation string, filter skmap.Map) *auditor {
+	return &auditor{
+		ctx:        ctx,
+		tx:         tx,
+		modelClass: modelClass,
+		operation:  operation,
+		filter:     filter,
+	}
+}
+
+func (a *auditor) enabled() bool {
+	return a.modelClass.Audit != nil
+}
+
+func (a *auditor) snapshotBefore() (err error) {
+	if !a.enabled() {
+		return
+	}
+	a.primaryKey, err = primaryKeyOf(a.tx, a.modelClass.Model)
+	if err != nil {
+		return
+	}
+	qf := QueryFactory{Query: a.tx.Model(a.modelClass.CreateModelRef())}
+	a.modelClass.applyFilter(&qf, a.filter)
+	a.before = []map[string]any{}
+	err = qf.Query.Find(&a.before).Error
+	normalizeSnapshots(a.before)
+	return
+}
+
+// re-read rows captured by snapshotBefore, by primary key, as the filter may not match after update
+func (a *auditor) snapshotAfter() (after []map[string]any, err error) {
+	if !a.enabled() || len(a.before) == 0 {
+		return
+	}
+	return a.snapshotOf(a.before)
+}
+
+/*
+Re-read created rows by primary key, as the data of Create misses columns filled by the database, e.g. defaults.
+
+Data of a row that is not found by its primary key is kept as is.
+*/
+func (a *auditor) snapshotCreated(created []map[string]any) (after []map[string]any, err error) {
+	if !a.enabled() || len(created) == 0 {
+		return created, nil
+	}
+	a.primaryKey, err = primaryKeyOf(a.tx, a.modelClass.Model)
+	if err != nil {
+		return
+	}
+	rows, err := a.snapshotOf(created)
+	if err != nil {
+		return
+	}
+	rowMap := map[string]map[string]any{}
+	for _, row := range rows {
+		rowMap[fmt.Sprint(row[a.primaryKey])] = row
+	}
+	after = make([]map[string]any, 0, len(created))
+	for _, record := range created {
+		if row, ok := rowMap[fmt.Sprint(record[a.primaryKey])]; ok {
+			record = row
+		}
+		after = append(after, record)
+	}
+	return
+}
+
+// rows of the primary keys of records
+func (a *auditor) snapshotOf(records []map[string]any) (rows []map[string]any, err error) {
+	keys := make([]any, 0, len(records))
+	for _, record := range records {
+		keys = append(keys, record[a.primaryKey])
+	}
+	rows = []map[string]any{}
+	err = a.tx.Model(a.modelClass.CreateModelRef()).
+		Where(fmt.Sprintf("%s in ?", a.primaryKey), keys).
+		Find(&rows).Error
+	normalizeSnapshots(rows)
+	return
+}
+
+func (a *auditor) record(after []map[string]any) (err error) {
+	if !a.enabled() {
+		return
+	}
+	if a.primaryKey == "" {
+		a.primaryKey, err = primaryKeyOf(a.tx, a.modelClass.Model)
+		if err != nil {
+			return
+		}
+	}
+	getActor := a.modelClass.Audit.GetActor
+	if getActor == nil {
+		getActor = ActorFromContext
+	}
+	actor := getActor(a.ctx)
+	afterMap := map[string]map[string]any{}
+	for _, record := range after {
+		afterMap[fmt.Sprint(record[a.primaryKey])] = record
+	}
+	records := []AuditRecord{}
+	appendRecord := func(key string, before map[string]any, after map[string]any) {
+		records = append(records, AuditRecord{
+			Actor:      actor,
+			Operation:  a.operation,
+			ModelClass: a.modelClass.name,
+			RecordKey:  key,
+			Filter:     a.filter,
+			Before:     before,
+			After:      after,
+			Diff:       DiffRecords(before, after),
+		})
+	}
+	switch a.operation {
+	case AuditOperationCreate:
+		for _, record := range after {
+			appendRecord(fmt.Sprint(record[a.primaryKey]), nil, record)
+		}
+	default:
+		for _, record := range a.before {
+			key := fmt.Sprint(record[a.primaryKey])
+			appendRecord(key, record, afterMap[key])
+		}
+	}
+	if len(records) == 0 {
+		return
+	}
+	table := a.modelClass.Audit.Table
+	if table == "" {
+		table = defaultAuditTable
+	}
+	return a.tx.Table(table).Create(&records).Error
+}
+
+func primaryKeyOf(db *gorm.DB, model any) (primaryKey string, err error) {
+	field, err := primaryFieldOf(db, model)
+	if err != nil {
+		return
+	}
+	primaryKey = field.DBName
+	return
+}
+
+func primaryFieldOf(db *gorm.DB, model any) (field *schema.Field, err error) {
+	modelSchema, err := schemaOf(db, model)
+	if err != nil {
+		return
+	}
+	field = modelSchema.PrioritizedPrimaryField
+	if field == nil {
+		err = errors.New("missing primary key")
+	}
+	return
+}
+
+func schemaOf(db *gorm.DB, model any) (modelSchema *schema.Schema, err error) {
+	stmt := &gorm.Statement{DB: db}
+	err = stmt.Parse(model)
+	if err != nil {
+		return
+	}
+	modelSchema = stmt.Schema
+	return
+}
+
+// raw bytes (e.g. JSON columns) would otherwise be marshalled as base64
+func normalizeSnapshots(records []map[string]any) {
+	for _, record := range records {
+		for field, value := range record {
+			if bytes, ok := value.([]byte); ok {
+				record[field] = string(bytes)
+			}
+		}
+	}
+}
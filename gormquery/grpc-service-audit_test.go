@@ -0,0 +1,55 @@
+package gormquery
+
+import (
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAuditTrail(t *testing.T) {
+	db := newTestDb(t)
+	expectNoError(t, db.Table("item_audit_trails").AutoMigrate(&AuditRecord{}))
+	server := newTestServer(db, ModelClass{Audit: &AuditConfig{Table: "item_audit_trails"}})
+	ctx := metadata.NewIncomingContext(testCtx, metadata.Pairs(ActorMetadataKey, "alice"))
+
+	_, err := server.Create(ctx, optionRequest(skmap.Map{"data": skmap.Map{"name": "d", "price": 4}}))
+	expectNoError(t, err)
+	_, err = server.Update(ctx, optionRequest(skmap.Map{"filter": skmap.Map{"name": []any{"a", "b"}}, "data": skmap.Map{"price": 10}}))
+	expectNoError(t, err)
+	_, err = server.Delete(ctx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "d"}}))
+	expectNoError(t, err)
+
+	records := []AuditRecord{}
+	expectNoError(t, db.Table("item_audit_trails").Order("id").Find(&records).Error)
+	operations := []string{}
+	for _, record := range records {
+		expectEqual(t, "actor", "alice", record.Actor)
+		expectEqual(t, "model class", "item", record.ModelClass)
+		operations = append(operations, record.Operation+":"+record.RecordKey)
+	}
+	expectEqual(t, "operations", []string{"create:4", "update:1", "update:2", "delete:4"}, operations)
+	expectEqual(t, "diff of update", skmap.Map{"from": float64(1), "to": float64(10)}, skmap.Map(records[1].Diff.GetMapDefault("price", nil)))
+	expect(t, "delete has no after snapshot", records[3].After == nil)
+	// after snapshot of create is the stored row, not the request data
+	expectEqual[any](t, "id of create", float64(4), records[0].After["id"])
+	_, ok := records[0].After["category_id"]
+	expect(t, "create has columns missing in data", ok)
+}
+
+func TestAuditDisabled(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	_, err := server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "a"}, "data": skmap.Map{"price": 10}}))
+	expectNoError(t, err)
+	expect(t, "no audit table without Audit", !db.Migrator().HasTable(defaultAuditTable))
+}
+
+func TestDiffRecords(t *testing.T) {
+	diff := DiffRecords(map[string]any{"a": 1, "b": 2, "c": 3}, map[string]any{"a": 1, "b": 4, "d": 5})
+	expectEqual(t, "diff", skmap.Map{
+		"b": skmap.Map{"from": 2, "to": 4},
+		"c": skmap.Map{"from": 3, "to": nil},
+		"d": skmap.Map{"from": nil, "to": 5},
+	}, diff)
+}
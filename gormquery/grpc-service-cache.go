@@ -0,0 +1,214 @@
+package gormquery
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+/*
+Backend of QueryServiceServer result cache
+
+Values are serialized QueryResponse. Implementation must be safe for concurrent use.
+*/
+type ResultCache interface {
+	Get(key string) (value []byte, ok bool)
+	Set(key string, modelClass string, value []byte, ttl time.Duration)
+	// drop all entries of the model class
+	Invalidate(modelClass string)
+}
+
+// cache key of Get options. "modelClass" is excluded as it is the key prefix, and "readYourWrites" does not affect results
+func resultCacheKey(modelClass string, options skmap.Map) (key string, err error) {
+	canonical := skmap.Map{}
+	for field, value := range options {
+		if field == "modelClass" || field == "readYourWrites" {
+			continue
+		}
+		canonical[field] = value
+	}
+	// encoding/json sorts map keys, which canonicalizes nested maps as well
+	bytes, err := json.Marshal(canonical)
+	if err != nil {
+		return
+	}
+	key = modelClass + ":" + string(bytes)
+	return
+}
+
+/*
+Drop cached results changed by a write of the model class
+
+Results of all model classes of the same table, and of model classes preloading the table as a relation,
+are dropped. A write marker expiring after QueryServiceServer.ReplicaLag is kept in the cache as well.
+*/
+func (q *QueryServiceServer) invalidateCache(db *gorm.DB, modelClass ModelClass) {
+	if q.Cache == nil {
+		return
+	}
+	for _, name := range q.cacheDependents(db, modelClass) {
+		q.Cache.Invalidate(name)
+		if q.ReplicaLag > 0 {
+			// not an entry of the model class, so that it survives invalidation
+			q.Cache.Set(writeMarkerKey(name), "", []byte{}, q.ReplicaLag)
+		}
+	}
+}
+
+// cache key of the write marker of the model class, which can not collide with resultCacheKey
+func writeMarkerKey(modelClass string) string {
+	return "write:" + modelClass
+}
+
+// names of cached model classes reading the table of modelClass, by their own table or their relations
+func (q *QueryServiceServer) cacheDependents(db *gorm.DB, modelClass ModelClass) (names []string) {
+	writtenSchema, err := schemaOf(db, modelClass.Model)
+	if err != nil {
+		// unknown table: only the model class itself
+		return []string{modelClass.name}
+	}
+	table := writtenSchema.Table
+	for name, mc := range q.ModelClasses {
+		if mc.CacheTTL <= 0 {
+			continue
+		}
+		if name == modelClass.name {
+			names = append(names, name)
+			continue
+		}
+		modelSchema, err := schemaOf(db, mc.Model)
+		if err != nil {
+			continue
+		}
+		if modelSchema.Table == table || mc.relationsRead(modelSchema, table) {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// whether a relation of the model class reads the table, as the related table or the join table
+func (mc *ModelClass) relationsRead(modelSchema *schema.Schema, table string) bool {
+	for name, relation := range mc.Relations {
+		relationship, ok := modelSchema.Relationships.Relations[relation.association(name)]
+		if !ok {
+			continue
+		}
+		if relationship.FieldSchema.Table == table || (relationship.JoinTable != nil && relationship.JoinTable.Table == table) {
+			return true
+		}
+	}
+	return false
+}
+
+// whether results of a replica could miss a write of the model class, which is within QueryServiceServer.ReplicaLag
+func (q *QueryServiceServer) withinReplicaLag(modelClass ModelClass) bool {
+	if q.ReplicaLag <= 0 || q.Cache == nil {
+		return false
+	}
+	_, ok := q.Cache.Get(writeMarkerKey(modelClass.name))
+	return ok
+}
+
+type lruEntry struct {
+	key        string
+	modelClass string
+	value      []byte
+	expireAt   time.Time
+}
+
+/*
+In-memory LRU implementation of ResultCache
+
+Example
+
+	&gormquery.QueryServiceServer{
+		ModelClasses: map[string]gormquery.ModelClass{
+			"country": {
+				Model:    postgres.Country{},
+				CanGet:   true,
+				CacheTTL: time.Minute,
+			},
+		},
+		Cache: gormquery.NewLRUCache(1000),
+	}
+*/
+type LRUCache struct {
+	capacity     int
+	mutex        sync.Mutex
+	entries      *list.List
+	keyMap       map[string]*list.Element
+	modelClasses map[string]map[string]bool
+}
+
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity:     capacity,
+		entries:      list.New(),
+		keyMap:       map[string]*list.Element{},
+		modelClasses: map[string]map[string]bool{},
+	}
+}
+
+func (c *LRUCache) Get(key string) (value []byte, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.keyMap[key]
+	if !ok {
+		return
+	}
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expireAt) {
+		c.remove(element)
+		return nil, false
+	}
+	c.entries.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *LRUCache) Set(key string, modelClass string, value []byte, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.keyMap[key]; ok {
+		c.remove(element)
+	}
+	element := c.entries.PushFront(&lruEntry{
+		key:        key,
+		modelClass: modelClass,
+		value:      value,
+		expireAt:   time.Now().Add(ttl),
+	})
+	c.keyMap[key] = element
+	if c.modelClasses[modelClass] == nil {
+		c.modelClasses[modelClass] = map[string]bool{}
+	}
+	c.modelClasses[modelClass][key] = true
+	for c.capacity > 0 && c.entries.Len() > c.capacity {
+		c.remove(c.entries.Back())
+	}
+}
+
+func (c *LRUCache) Invalidate(modelClass string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key := range c.modelClasses[modelClass] {
+		if element, ok := c.keyMap[key]; ok {
+			c.remove(element)
+		}
+	}
+	delete(c.modelClasses, modelClass)
+}
+
+func (c *LRUCache) remove(element *list.Element) {
+	entry := element.Value.(*lruEntry)
+	c.entries.Remove(element)
+	delete(c.keyMap, entry.key)
+	if keys := c.modelClasses[entry.modelClass]; keys != nil {
+		delete(keys, entry.key)
+	}
+}
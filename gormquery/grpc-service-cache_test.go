@@ -0,0 +1,150 @@
+package gormquery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+)
+
+func TestResultCache(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{CacheTTL: time.Minute})
+	server.Cache = NewLRUCache(10)
+	prices := func(options skmap.Map) (prices []int) {
+		response, err := server.Get(testCtx, optionRequest(options))
+		expectNoError(t, err)
+		for _, item := range decodeResults[testItem](t, response.Results) {
+			prices = append(prices, item.Price)
+		}
+		return
+	}
+	options := skmap.Map{"filter": skmap.Map{"name": "a"}}
+	expectEqual(t, "prices", []int{1}, prices(options))
+
+	// changed behind the server
+	expectNoError(t, db.Model(&testItem{}).Where("name = ?", "a").Update("price", 10).Error)
+	expectEqual(t, "cached prices", []int{1}, prices(options))
+	expectEqual(t, "cached prices with model class", []int{1}, prices(skmap.Map{"modelClass": "item", "filter": skmap.Map{"name": "a"}}))
+	expectEqual(t, "prices of read-your-writes", []int{10}, prices(skmap.Map{"filter": skmap.Map{"name": "a"}, "readYourWrites": true}))
+
+	// invalidated by a write of the model class
+	_, err := server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "b"}, "data": skmap.Map{"price": 20}}))
+	expectNoError(t, err)
+	expectNoError(t, db.Model(&testItem{}).Where("name = ?", "a").Update("price", 11).Error)
+	expectEqual(t, "prices after update", []int{11}, prices(options))
+}
+
+func TestResultCacheDependents(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestRelationServer(db, ModelClass{CacheTTL: time.Minute})
+	server.ModelClasses["cheap_item"] = ModelClass{Model: testItem{}, CanGet: true, CacheTTL: time.Minute}
+	server.ModelClasses["comment"] = ModelClass{Model: testComment{}, CanCreate: true}
+	server.ModelClasses["category"] = ModelClass{Model: testCategory{}, CanGet: true, CacheTTL: time.Minute}
+	server.Cache = NewLRUCache(10)
+	cachedClasses := func() (names []string) {
+		names = []string{}
+		for _, name := range []string{"item", "cheap_item", "category"} {
+			if len(server.Cache.(*LRUCache).modelClasses[name]) > 0 {
+				names = append(names, name)
+			}
+		}
+		return
+	}
+	getAll := func() {
+		for _, name := range []string{"item", "cheap_item", "category"} {
+			_, err := server.Get(testCtx, optionRequest(skmap.Map{"modelClass": name}))
+			expectNoError(t, err)
+		}
+	}
+
+	getAll()
+	expectEqual(t, "cached model classes", []string{"item", "cheap_item", "category"}, cachedClasses())
+	// "cheap_item" maps to the same table
+	_, err := server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "a"}, "data": skmap.Map{"price": 10}}))
+	expectNoError(t, err)
+	expectEqual(t, "cached model classes after update of item", []string{"category"}, cachedClasses())
+
+	getAll()
+	// "item" preloads comments as a relation
+	_, err = server.Create(testCtx, optionRequest(skmap.Map{"modelClass": "comment", "data": skmap.Map{"item_id": 1, "body": "new"}}))
+	expectNoError(t, err)
+	expectEqual(t, "cached model classes after create of comment", []string{"cheap_item", "category"}, cachedClasses())
+}
+
+func TestResultCacheReplicaLag(t *testing.T) {
+	primary := newTestDb(t)
+	replica := newTestDb(t)
+	server := newTestServer(primary, ModelClass{CacheTTL: time.Minute})
+	server.DefaultReadDb = replica
+	server.Cache = NewLRUCache(10)
+	server.ReplicaLag = time.Minute
+	options := skmap.Map{"filter": skmap.Map{"name": "a"}}
+	price := func() int {
+		response, err := server.Get(testCtx, optionRequest(options))
+		expectNoError(t, err)
+		return decodeResults[testItem](t, response.Results)[0].Price
+	}
+	expectEqual(t, "price", 1, price())
+
+	_, err := server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "a"}, "data": skmap.Map{"price": 10}}))
+	expectNoError(t, err)
+	expectEqual(t, "price of lagging replica", 1, price())
+	// replicated: the lagging result was not cached
+	expectNoError(t, replica.Model(&testItem{}).Where("name = ?", "a").Update("price", 10).Error)
+	expectEqual(t, "price of replicated replica", 10, price())
+
+	// cached as usual without ReplicaLag
+	server.ReplicaLag = 0
+	_, err = server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "a"}, "data": skmap.Map{"price": 20}}))
+	expectNoError(t, err)
+	expectEqual(t, "price of lagging replica", 10, price())
+	expectNoError(t, replica.Model(&testItem{}).Where("name = ?", "a").Update("price", 20).Error)
+	expectEqual(t, "cached price of lagging replica", 10, price())
+}
+
+func TestResultCacheDisabled(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	server.Cache = NewLRUCache(10)
+	_, err := server.Get(testCtx, optionRequest(skmap.Map{}))
+	expectNoError(t, err)
+	expectEqual(t, "entries without CacheTTL", 0, server.Cache.(*LRUCache).entries.Len())
+}
+
+func TestResultCacheKey(t *testing.T) {
+	key1, err := resultCacheKey("item", skmap.Map{"modelClass": "item", "filter": skmap.Map{"a": 1, "b": 2}, "readYourWrites": true})
+	expectNoError(t, err)
+	key2, err := resultCacheKey("item", skmap.Map{"filter": skmap.Map{"b": 2, "a": 1}})
+	expectNoError(t, err)
+	expectEqual(t, "key", key1, key2)
+	key3, err := resultCacheKey("category", skmap.Map{"filter": skmap.Map{"b": 2, "a": 1}})
+	expectNoError(t, err)
+	expect(t, "keys of model classes should differ", key1 != key3)
+}
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Set("a", "item", []byte("1"), time.Minute)
+	cache.Set("b", "item", []byte("2"), time.Minute)
+	cache.Get("a")
+	cache.Set("c", "category", []byte("3"), time.Minute)
+	_, ok := cache.Get("b")
+	expect(t, "least recently used entry is evicted", !ok)
+	value, ok := cache.Get("a")
+	expect(t, "recently used entry is kept", ok)
+	expectEqual(t, "value", "1", string(value))
+
+	cache.Set("d", "category", []byte("4"), -time.Second)
+	_, ok = cache.Get("d")
+	expect(t, "expired entry", !ok)
+
+	cache = NewLRUCache(0)
+	cache.Set("a", "item", []byte("1"), time.Minute)
+	cache.Set("b", "category", []byte("2"), time.Minute)
+	cache.Invalidate("item")
+	_, ok = cache.Get("a")
+	expect(t, "invalidated entry", !ok)
+	_, ok = cache.Get("b")
+	expect(t, "entry of other model class is kept", ok)
+}
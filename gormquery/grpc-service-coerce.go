@@ -0,0 +1,256 @@
+package gormquery
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm/schema"
+)
+
+// layouts of time filter values, ISO-8601 with timezone or a date (UTC)
+var filterTimeLayouts = []string{time.RFC3339Nano, "2006-01-02"}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// option of options in JSON, with numbers as json.Number so that integers are not rounded by float64
+func numberOptionOf(optionsBytes []byte, key string) (value any, ok bool) {
+	var options map[string]json.RawMessage
+	if json.Unmarshal(optionsBytes, &options) != nil {
+		return
+	}
+	optionBytes, ok := options[key]
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(optionBytes))
+	decoder.UseNumber()
+	if decoder.Decode(&value) != nil || value == nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// filter of options in JSON, with numbers as json.Number
+func numberFilterOf(optionsBytes []byte) (filter map[string]any, ok bool) {
+	value, _ := numberOptionOf(optionsBytes, "filter")
+	filter, ok = value.(map[string]any)
+	return
+}
+
+/*
+Convert filter values to the types of the fields of the gORM model
+
+  - integers, floats and booleans are parsed from JSON numbers, booleans or strings
+  - time.Time is parsed from ISO-8601 timestamps with timezone (RFC 3339) or dates, in UTC so that
+    timestamps stored as text (e.g. SQLite) are compared in the same zone
+  - types implementing encoding.TextUnmarshaler (e.g. UUID, decimal, enum types) are parsed from strings,
+    and structs implementing json.Unmarshaler (e.g. decimal) from other JSON values
+  - values of other fields (virtual fields, JSON fields, fields not in the model) are kept,
+    with JSON numbers as int64 or float64
+
+Relation fields, e.g. "category.name", are converted by the field of the related model.
+Values that cannot be converted are rejected with InvalidArgument.
+*/
+func (mc *ModelClass) coerceFilter(modelSchema *schema.Schema, filter map[string]any) (coerced skmap.Map, err error) {
+	coerced = skmap.Map{}
+	for field, value := range filter {
+		if field == FilterOr {
+			alternatives, _ := value.([]any)
+			coercedAlternatives := []any{}
+			for _, alternative := range alternatives {
+				alternativeFilter, _ := alternative.(map[string]any)
+				var coercedAlternative skmap.Map
+				coercedAlternative, err = mc.coerceFilter(modelSchema, alternativeFilter)
+				if err != nil {
+					return
+				}
+				coercedAlternatives = append(coercedAlternatives, map[string]any(coercedAlternative))
+			}
+			coerced[field] = coercedAlternatives
+			continue
+		}
+		coerced[field], err = coerceFilterValue(mc.filterFieldOf(modelSchema, field), value)
+		if err != nil {
+			err = status.Errorf(codes.InvalidArgument, "invalid filter value of %s: %v", field, err)
+			return
+		}
+	}
+	return
+}
+
+// field of the model, or of the related model for relation fields. nil if it is not a typed column
+func (mc *ModelClass) filterFieldOf(modelSchema *schema.Schema, field string) *schema.Field {
+	if mc.WhitelistedFields.GetBoolDefault(fmt.Sprintf("%s.isJsonField", field), false) {
+		return nil
+	}
+	relationName, subField, isRelationField := strings.Cut(field, ".")
+	if !isRelationField {
+		return modelSchema.LookUpField(field)
+	}
+	relation, ok := mc.Relations[relationName]
+	if !ok {
+		return nil
+	}
+	relationship, ok := modelSchema.Relationships.Relations[relation.association(relationName)]
+	if !ok {
+		return nil
+	}
+	return relationship.FieldSchema.LookUpField(subField)
+}
+
+// value of filter: a primitive, an array (in) or an operator map
+func coerceFilterValue(field *schema.Field, value any) (coerced any, err error) {
+	switch value := value.(type) {
+	case []any:
+		return coerceValues(field, value)
+	case map[string]any:
+		operators := map[string]any{}
+		for operator, operand := range value {
+			switch operator {
+			case "null":
+				operators[operator] = operand
+			case "like":
+				operators[operator], err = coerceValue(nil, operand)
+			default:
+				operators[operator], err = coerceFilterValue(field, operand)
+			}
+			if err != nil {
+				return
+			}
+		}
+		return operators, nil
+	}
+	return coerceValue(field, value)
+}
+
+func coerceValues(field *schema.Field, values []any) (coerced []any, err error) {
+	coerced = make([]any, len(values))
+	for i, value := range values {
+		coerced[i], err = coerceValue(field, value)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// primitive value of filter to the type of field
+func coerceValue(field *schema.Field, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if field == nil {
+		return plainValue(value), nil
+	}
+	fieldType := field.FieldType
+	for fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType == reflect.TypeOf(time.Time{}) {
+		return coerceTime(value)
+	}
+	if str, ok := value.(string); ok && reflect.PointerTo(fieldType).Implements(textUnmarshalerType) {
+		ptr := reflect.New(fieldType)
+		if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str)); err != nil {
+			return nil, err
+		}
+		return ptr.Elem().Interface(), nil
+	}
+	if fieldType.Kind() == reflect.Struct && reflect.PointerTo(fieldType).Implements(jsonUnmarshalerType) {
+		valueBytes, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		ptr := reflect.New(fieldType)
+		if err := ptr.Interface().(json.Unmarshaler).UnmarshalJSON(valueBytes); err != nil {
+			return nil, err
+		}
+		return ptr.Elem().Interface(), nil
+	}
+	switch fieldType.Kind() {
+	case reflect.Bool:
+		switch value := value.(type) {
+		case bool:
+			return value, nil
+		case string:
+			return strconv.ParseBool(value)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		intValue, err := strconv.ParseInt(numberText(value), 10, 64)
+		if err != nil || reflect.Zero(fieldType).OverflowInt(intValue) {
+			return nil, fmt.Errorf("%v is not %s", value, fieldType.Kind())
+		}
+		return intValue, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		uintValue, err := strconv.ParseUint(numberText(value), 10, 64)
+		if err != nil || reflect.Zero(fieldType).OverflowUint(uintValue) {
+			return nil, fmt.Errorf("%v is not %s", value, fieldType.Kind())
+		}
+		return uintValue, nil
+	case reflect.Float32, reflect.Float64:
+		floatValue, err := strconv.ParseFloat(numberText(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v is not a number", value)
+		}
+		return floatValue, nil
+	case reflect.String:
+		switch value := value.(type) {
+		case string:
+			return value, nil
+		case json.Number:
+			return value.String(), nil
+		}
+	default:
+		return plainValue(value), nil
+	}
+	return nil, fmt.Errorf("%v is not %s", value, fieldType.Kind())
+}
+
+func coerceTime(value any) (any, error) {
+	if str, ok := value.(string); ok {
+		for _, layout := range filterTimeLayouts {
+			if timeValue, err := time.Parse(layout, str); err == nil {
+				return timeValue.UTC(), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%v is not an ISO-8601 timestamp", value)
+}
+
+// text of a number, which could be a JSON number, a float64 without fraction or a string
+func numberText(value any) string {
+	switch value := value.(type) {
+	case json.Number:
+		return value.String()
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case string:
+		return value
+	}
+	return fmt.Sprint(value)
+}
+
+// JSON number as int64 if it is an integer, otherwise float64
+func plainValue(value any) any {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if intValue, err := number.Int64(); err == nil {
+		return intValue
+	}
+	floatValue, _ := number.Float64()
+	return floatValue
+}
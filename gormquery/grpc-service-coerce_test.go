@@ -0,0 +1,169 @@
+package gormquery
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+)
+
+// enum parsed from its name
+type testStatus int
+
+func (s *testStatus) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "open":
+		*s = 1
+	case "closed":
+		*s = 2
+	default:
+		return fmt.Errorf("unknown status %s", text)
+	}
+	return nil
+}
+
+// decimal of cents, parsed from a JSON number or string
+type testAmount struct {
+	Cents int64
+}
+
+func (a *testAmount) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	whole, fraction, _ := strings.Cut(number.String(), ".")
+	_, err := fmt.Sscan(whole+(fraction + "00")[:2], &a.Cents)
+	return err
+}
+
+func (a testAmount) Value() (driver.Value, error) {
+	return a.Cents, nil
+}
+
+func (a *testAmount) Scan(value any) error {
+	cents, ok := value.(int64)
+	if !ok {
+		return fmt.Errorf("invalid amount %v", value)
+	}
+	a.Cents = cents
+	return nil
+}
+
+type testTypedFilterRecord struct {
+	ID       int64
+	Level    int8
+	Count    uint16
+	Ratio    float64
+	Active   bool
+	Name     string
+	Status   testStatus
+	Amount   testAmount
+	At       time.Time
+	ClosedAt *time.Time
+	Meta     string
+}
+
+func TestCoerceFilter(t *testing.T) {
+	db := newTestDb(t)
+	modelSchema, err := schemaOf(db, testTypedFilterRecord{})
+	expectNoError(t, err)
+	modelClass := ModelClass{WhitelistedFields: skmap.Map{"meta": skmap.Map{"isJsonField": true}}}
+	coerce := func(filter string) (skmap.Map, error) {
+		filterMap, ok := numberFilterOf([]byte(`{"filter":` + filter + `}`))
+		expect(t, "filter of "+filter, ok)
+		return modelClass.coerceFilter(modelSchema, filterMap)
+	}
+
+	coerced, err := coerce(`{"id": 9007199254740993, "level": "-3", "count": [1, "2"], "ratio": "0.5", "active": "true", "name": 12, "status": "open", "amount": 1.5}`)
+	expectNoError(t, err)
+	expectEqual(t, "coerced", skmap.Map{
+		"id":     int64(9007199254740993),
+		"level":  int64(-3),
+		"count":  []any{uint64(1), uint64(2)},
+		"ratio":  0.5,
+		"active": true,
+		"name":   "12",
+		"status": testStatus(1),
+		"amount": testAmount{Cents: 150},
+	}, coerced)
+
+	coerced, err = coerce(`{"at": {"gte": "2024-01-01T10:00:00+02:00", "lt": "2024-01-02"}, "closed_at": {"null": true}, "name": {"like": "a%"}, "meta": ["x"], "score": 2.5, "rank": 3}`)
+	expectNoError(t, err)
+	at := coerced.GetMapDefault("at", nil)
+	expectEqual[any](t, "time with timezone", time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC), at["gte"])
+	expectEqual[any](t, "date", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), at["lt"])
+	expectEqual[any](t, "null operator", map[string]any{"null": true}, coerced["closed_at"])
+	expectEqual[any](t, "like operator", map[string]any{"like": "a%"}, coerced["name"])
+	expectEqual[any](t, "JSON field", []any{"x"}, coerced["meta"])
+	// fields not in the model keep JSON numbers as int64 or float64
+	expectEqual[any](t, "float of unknown field", 2.5, coerced["score"])
+	expectEqual[any](t, "integer of unknown field", int64(3), coerced["rank"])
+
+	coerced, err = coerce(`{"$or": [{"level": "1"}, {"at": "2024-01-01"}]}`)
+	expectNoError(t, err)
+	expectEqual[any](t, "$or", []any{map[string]any{"level": int64(1)}, map[string]any{"at": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}, coerced[FilterOr])
+
+	for _, filter := range []string{
+		`{"level": 128}`,
+		`{"count": -1}`,
+		`{"id": 1.5}`,
+		`{"ratio": "x"}`,
+		`{"active": 1}`,
+		`{"name": true}`,
+		`{"status": "pending"}`,
+		`{"at": "yesterday"}`,
+		`{"at": {"gte": 1}}`,
+		`{"$or": [{"level": "x"}]}`,
+	} {
+		_, err = coerce(filter)
+		expectCode(t, "coerce of "+filter, codes.InvalidArgument, err)
+	}
+}
+
+func TestCoerceFilterGet(t *testing.T) {
+	db := newTestDb(t)
+	expectNoError(t, db.AutoMigrate(&testBigRecord{}))
+	expectNoError(t, db.Create(&[]testBigRecord{{ID: 9007199254740992, Name: "even"}, {ID: 9007199254740993, Name: "odd"}}).Error)
+	server := newTestServer(db, ModelClass{Model: testBigRecord{}, WhitelistedFields: skmap.Map{"id": true, "name": true}})
+	// integers above 2^53 are not rounded by float64
+	response, err := server.Get(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"id": json.Number("9007199254740993")}}))
+	expectNoError(t, err)
+	expectEqual(t, "records of id", []testBigRecord{{ID: 9007199254740993, Name: "odd"}}, decodeResults[testBigRecord](t, response.Results))
+	response, err = server.Get(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"id": "9007199254740992"}}))
+	expectNoError(t, err)
+	expectEqual(t, "records of id string", []testBigRecord{{ID: 9007199254740992, Name: "even"}}, decodeResults[testBigRecord](t, response.Results))
+
+	_, err = server.Get(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"id": "x"}}))
+	expectCode(t, "Get of invalid id", codes.InvalidArgument, err)
+	_, err = server.Delete(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"id": []any{"x"}}}))
+	expectCode(t, "Delete of invalid id", codes.InvalidArgument, err)
+}
+
+func TestCoerceFilterTime(t *testing.T) {
+	db := newTestDb(t)
+	expectNoError(t, db.AutoMigrate(&testTypedFilterRecord{}))
+	expectNoError(t, db.Create(&[]testTypedFilterRecord{
+		{Name: "early", At: time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)},
+		{Name: "late", At: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}).Error)
+	server := newTestServer(db, ModelClass{Model: testTypedFilterRecord{}, WhitelistedFields: skmap.Map{"id": true, "name": true, "at": true}})
+	names := func(filter skmap.Map) (names []string) {
+		response, err := server.Get(testCtx, optionRequest(skmap.Map{"fields": []string{"name"}, "filter": filter, "sort": skmap.Map{"id": "ASC"}}))
+		expectNoError(t, err)
+		for _, record := range decodeResults[testItem](t, response.Results) {
+			names = append(names, record.Name)
+		}
+		return
+	}
+	// 11:00 of +02:00 is 09:00 UTC
+	expectEqual(t, "names after 09:00 UTC", []string{"late"}, names(skmap.Map{"at": skmap.Map{"gt": "2024-01-01T11:00:00+02:00"}}))
+	expectEqual(t, "names at 08:00 UTC", []string{"early"}, names(skmap.Map{"at": "2024-01-01T10:00:00+02:00"}))
+	// 09:30 of -03:00 is 12:30 UTC
+	expectEqual(t, "names after 12:30 UTC", []string(nil), names(skmap.Map{"at": skmap.Map{"gt": "2024-01-01T09:30:00-03:00"}}))
+}
@@ -0,0 +1,157 @@
+package gormquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+/*
+Keyset pagination of Get, enabled by option "cursor"
+
+Rows are ordered by the sort field (at most 1) and then the primary key, and the cursor
+is the position of the last row of a page. An empty cursor starts from the first page.
+*/
+type keyset struct {
+	sortField  *schema.Field
+	primaryKey *schema.Field
+	descending bool
+	after      []any
+}
+
+func newKeyset(db *gorm.DB, modelClass ModelClass, sortDefs skmap.Map, cursor string) (k *keyset, err error) {
+	if len(sortDefs) > 1 {
+		err = status.Error(codes.InvalidArgument, "cursor supports at most 1 sort field")
+		return
+	}
+	modelSchema, err := schemaOf(db, modelClass.Model)
+	if err != nil {
+		return
+	}
+	k = &keyset{primaryKey: modelSchema.PrioritizedPrimaryField}
+	if k.primaryKey == nil {
+		err = status.Error(codes.FailedPrecondition, "cursor requires a primary key")
+		return
+	}
+	for field := range sortDefs {
+		k.sortField = modelSchema.LookUpField(field)
+		if k.sortField == nil {
+			err = status.Errorf(codes.InvalidArgument, "cursor does not support sort field %s", field)
+			return
+		}
+		k.descending = strings.ToUpper(sortDefs.GetStringDefault(field, "ASC")) == "DESC"
+	}
+	if k.sortField == k.primaryKey {
+		k.sortField = nil
+	}
+	if cursor == "" {
+		return
+	}
+	k.after, err = k.decode(cursor)
+	if err != nil {
+		err = status.Error(codes.InvalidArgument, "invalid cursor")
+	}
+	return
+}
+
+// order by primary key as tie-breaker, and skip rows up to the cursor
+func (k *keyset) apply(query *gorm.DB) *gorm.DB {
+	direction, comparison := "ASC", ">"
+	if k.descending {
+		direction, comparison = "DESC", "<"
+	}
+	query = query.Order(fmt.Sprintf("%s %s", k.primaryKey.DBName, direction))
+	if k.after == nil {
+		return query
+	}
+	if k.sortField == nil {
+		return query.Where(fmt.Sprintf("%s %s ?", k.primaryKey.DBName, comparison), k.after[0])
+	}
+	return query.Where(
+		fmt.Sprintf("%s %s ? OR (%s = ? AND %s %s ?)", k.sortField.DBName, comparison, k.sortField.DBName, k.primaryKey.DBName, comparison),
+		k.after[0], k.after[0], k.after[1],
+	)
+}
+
+// cursor of the last row of results (pointer to slice of model)
+func (k *keyset) next(ctx context.Context, results any) (cursor string, err error) {
+	resultsValue := reflect.ValueOf(results).Elem()
+	if resultsValue.Len() == 0 {
+		return
+	}
+	last := resultsValue.Index(resultsValue.Len() - 1)
+	values := []any{}
+	for _, field := range k.fields() {
+		value, _ := field.ValueOf(ctx, last)
+		values = append(values, value)
+	}
+	valuesBytes, err := json.Marshal(values)
+	if err != nil {
+		return
+	}
+	cursor = base64.RawURLEncoding.EncodeToString(valuesBytes)
+	return
+}
+
+func (k *keyset) fields() []*schema.Field {
+	if k.sortField == nil {
+		return []*schema.Field{k.primaryKey}
+	}
+	return []*schema.Field{k.sortField, k.primaryKey}
+}
+
+// columns of the keyset fields
+func (k *keyset) columns() (columns []string) {
+	for _, field := range k.fields() {
+		columns = append(columns, field.DBName)
+	}
+	return
+}
+
+// values of cursor, typed by the fields, as JSON numbers and times are not comparable otherwise
+func (k *keyset) decode(cursor string) (values []any, err error) {
+	valuesBytes, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(valuesBytes))
+	decoder.UseNumber()
+	err = decoder.Decode(&values)
+	if err != nil {
+		return
+	}
+	fields := k.fields()
+	if len(values) != len(fields) {
+		err = fmt.Errorf("expected %d cursor values, got %d", len(fields), len(values))
+		return
+	}
+	for i, field := range fields {
+		switch value := values[i].(type) {
+		case json.Number:
+			if intValue, intErr := value.Int64(); intErr == nil {
+				values[i] = intValue
+			} else {
+				values[i], err = value.Float64()
+			}
+		case string:
+			if field.GORMDataType == schema.Time {
+				values[i], err = time.Parse(time.RFC3339Nano, value)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
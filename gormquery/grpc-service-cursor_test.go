@@ -0,0 +1,63 @@
+package gormquery
+
+import (
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+)
+
+func TestFilterOperators(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	expectEqual(t, "names of operators", []string{"b", "c"}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{"price": skmap.Map{"gte": 2}}}))
+	expectEqual(t, "names of $or", []string{"a", "c"}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{
+		FilterOr: []any{skmap.Map{"name": "a"}, skmap.Map{"price": skmap.Map{"gt": 2}}},
+	}}))
+	expectEqual(t, "names of $or with other conditions", []string{"c"}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{
+		"category_id": 2,
+		FilterOr:      []any{skmap.Map{"name": "a"}, skmap.Map{"price": skmap.Map{"gt": 2}}},
+	}}))
+
+	_, err := server.Get(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"price": skmap.Map{"between": 1}}}))
+	expectCode(t, "Get with unknown operator", codes.InvalidArgument, err)
+	// an unknown operator would otherwise widen the update
+	_, err = server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"price": skmap.Map{"between": 1}}, "data": skmap.Map{"price": 0}}))
+	expectCode(t, "Update with unknown operator", codes.InvalidArgument, err)
+	expectEqual(t, "price is not updated", 1, testItemPrice(t, db, "a"))
+}
+
+func TestCursor(t *testing.T) {
+	db := newTestDb(t)
+	expectNoError(t, db.Create(&[]testItem{{Name: "d", Price: 2}, {Name: "e", Price: 1}}).Error)
+	server := newTestServer(db, ModelClass{})
+	// pages of names until the last page, with the cursor of each page
+	pages := func(options skmap.Map) (pages [][]string) {
+		options["cursor"] = ""
+		options["limit"] = 2
+		for {
+			response, err := server.Get(testCtx, optionRequest(options))
+			expectNoError(t, err)
+			names := []string{}
+			for _, item := range decodeResults[testItem](t, response.Results) {
+				names = append(names, item.Name)
+			}
+			pages = append(pages, names)
+			if response.NextCursor == "" {
+				return
+			}
+			options["cursor"] = response.NextCursor
+		}
+	}
+	expectEqual(t, "pages of primary key", [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, pages(skmap.Map{}))
+	// ties of price are ordered by primary key
+	expectEqual(t, "pages of price", [][]string{{"a", "e"}, {"b", "d"}, {"c"}}, pages(skmap.Map{"sort": skmap.Map{"price": "ASC"}}))
+	expectEqual(t, "pages of price descending", [][]string{{"c", "d"}, {"b", "e"}, {"a"}}, pages(skmap.Map{"sort": skmap.Map{"price": "DESC"}}))
+	// a full last page is followed by an empty page
+	expectEqual(t, "pages of filter", [][]string{{"b", "d"}, {}}, pages(skmap.Map{"filter": skmap.Map{"price": 2}}))
+
+	_, err := server.Get(testCtx, optionRequest(skmap.Map{"cursor": "", "sort": skmap.Map{"price": "ASC", "name": "ASC"}}))
+	expectCode(t, "cursor with 2 sort fields", codes.InvalidArgument, err)
+	_, err = server.Get(testCtx, optionRequest(skmap.Map{"cursor": "invalid"}))
+	expectCode(t, "invalid cursor", codes.InvalidArgument, err)
+}
@@ -0,0 +1,69 @@
+package gormquery
+
+import (
+	"encoding/json"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+/*
+Explain of an operation, returned instead of executing it
+
+Sql is the generated statement with bound parameters inlined. Plan is the rows of
+the database EXPLAIN output, only if "explainPlan" is requested.
+*/
+type Explain struct {
+	Sql  string           `json:"sql"`
+	Vars []any            `json:"vars"`
+	Plan []map[string]any `json:"plan,omitempty"`
+}
+
+// whether the request asks for explain instead of execution
+func isExplain(options skmap.Map) bool {
+	return options.GetBoolDefault("explain", false) || options.GetBoolDefault("explainPlan", false)
+}
+
+/*
+Build the statement of operation in dry run mode, and optionally run EXPLAIN on it
+
+Writes are never executed: EXPLAIN without ANALYZE only plans the statement.
+*/
+func (mc *ModelClass) explain(query *gorm.DB, options skmap.Map, operation func(tx *gorm.DB) *gorm.DB) (explainBytes []byte, err error) {
+	withPlan := options.GetBoolDefault("explainPlan", false)
+	if withPlan && !mc.CanExplainPlan {
+		err = status.Error(codes.PermissionDenied, "explain plan is not allowed")
+		return
+	}
+	tx := operation(query.Session(&gorm.Session{DryRun: true}))
+	if tx.Error != nil {
+		err = tx.Error
+		return
+	}
+	sql := tx.Statement.SQL.String()
+	vars := tx.Statement.Vars
+	explain := Explain{
+		Sql:  query.Dialector.Explain(sql, vars...),
+		Vars: vars,
+	}
+	if withPlan {
+		explain.Plan = []map[string]any{}
+		err = query.Session(&gorm.Session{NewDB: true}).
+			Raw(explainPrefix(query.Dialector.Name())+" "+sql, vars...).
+			Scan(&explain.Plan).Error
+		if err != nil {
+			return
+		}
+		normalizeSnapshots(explain.Plan)
+	}
+	return json.Marshal(explain)
+}
+
+func explainPrefix(dialect string) string {
+	if dialect == "sqlite" {
+		return "EXPLAIN QUERY PLAN"
+	}
+	return "EXPLAIN"
+}
@@ -0,0 +1,54 @@
+package gormquery
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+)
+
+func decodeExplain(t *testing.T, explainBytes []byte) (explain Explain) {
+	t.Helper()
+	expectNoError(t, json.Unmarshal(explainBytes, &explain))
+	return
+}
+
+func TestExplainGet(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	response, err := server.Get(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "a"}, "explain": true}))
+	expectNoError(t, err)
+	expect(t, "no results of explain", len(response.Results) == 0)
+	explain := decodeExplain(t, response.Explain)
+	expect(t, "sql of Get", strings.HasPrefix(explain.Sql, "SELECT") && strings.Contains(explain.Sql, `"a"`))
+	expectEqual(t, "vars", []any{"a"}, explain.Vars[:1])
+	expect(t, "no plan without explainPlan", explain.Plan == nil)
+
+	_, err = server.Get(testCtx, optionRequest(skmap.Map{"explainPlan": true}))
+	expectCode(t, "explainPlan without CanExplainPlan", codes.PermissionDenied, err)
+	modelClass := server.ModelClasses["item"]
+	modelClass.CanExplainPlan = true
+	server.ModelClasses["item"] = modelClass
+	response, err = server.Get(testCtx, optionRequest(skmap.Map{"explainPlan": true}))
+	expectNoError(t, err)
+	expect(t, "plan", len(decodeExplain(t, response.Explain).Plan) > 0)
+}
+
+func TestExplainWrites(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	response, err := server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "a"}, "data": skmap.Map{"price": 10}, "explain": true}))
+	expectNoError(t, err)
+	expect(t, "sql of Update", strings.HasPrefix(decodeExplain(t, response.Explain).Sql, "UPDATE"))
+	expectEqual(t, "price is not updated", 1, testItemPrice(t, db, "a"))
+
+	response, err = server.Delete(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "a"}, "explain": true}))
+	expectNoError(t, err)
+	expect(t, "sql of Delete", strings.HasPrefix(decodeExplain(t, response.Explain).Sql, "DELETE"))
+	expectEqual(t, "names", []string{"a", "b", "c"}, testItemNames(t, server, skmap.Map{}))
+
+	_, err = server.Delete(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{}, "explain": true}))
+	expectCode(t, "explain of Delete without filter", codes.InvalidArgument, err)
+}
@@ -0,0 +1,351 @@
+package gormquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	ResultFormatJson   = "json"
+	ResultFormatNdjson = "ndjson"
+	ResultFormatCsv    = "csv"
+)
+
+const defaultExportPageSize = 1000
+
+// context key of Get pages read by Export
+type exportPageKey struct{}
+
+/*
+Get page read by Export
+
+Pages read the primary database without the result cache, as a page of a replica or a cached page
+could be out of step with the others. Total count and facets are read by the first page only.
+*/
+type exportPage struct {
+	counted bool
+}
+
+func exportPageOf(ctx context.Context) (page exportPage, ok bool) {
+	page, ok = ctx.Value(exportPageKey{}).(exportPage)
+	return
+}
+
+/*
+Encoder of JSON results to the requested format
+
+Results are encoded page by page. For csv, the header is decided by "fields" (in order),
+or by the sorted keys of the first page if no field is selected.
+*/
+type resultEncoder struct {
+	format     string
+	fields     []string
+	jsonFields map[string]bool
+	header     []string
+	count      int
+}
+
+func newResultEncoder(format string, fields []string, jsonFields map[string]bool) (encoder *resultEncoder, err error) {
+	switch format {
+	case ResultFormatJson, ResultFormatNdjson, ResultFormatCsv:
+	default:
+		err = status.Errorf(codes.InvalidArgument, "unknown format %s", format)
+		return
+	}
+	encoder = &resultEncoder{
+		format:     format,
+		fields:     fields,
+		jsonFields: jsonFields,
+	}
+	return
+}
+
+// encoder of a Get request, with fields and JSON fields as keys of results
+func (mc *ModelClass) newResultEncoder(modelSchema *schema.Schema, options skmap.Map) (*resultEncoder, error) {
+	fields := []string{}
+	for _, field := range options.GetStringArraySafe("fields") {
+		fields = append(fields, mc.resultKey(modelSchema, field))
+	}
+	jsonFields := map[string]bool{}
+	for field := range mc.WhitelistedFields {
+		if mc.WhitelistedFields.GetBoolDefault(fmt.Sprintf("%s.isJsonField", field), false) {
+			jsonFields[mc.resultKey(modelSchema, field)] = true
+		}
+	}
+	return newResultEncoder(options.GetStringDefault("format", ResultFormatJson), fields, jsonFields)
+}
+
+// encode next page of results (JSON array)
+func (e *resultEncoder) encode(results []byte) (encoded []byte, err error) {
+	var records []json.RawMessage
+	err = json.Unmarshal(results, &records)
+	if err != nil {
+		return
+	}
+	buffer := &bytes.Buffer{}
+	switch e.format {
+	case ResultFormatJson:
+		for _, record := range records {
+			if e.count == 0 {
+				buffer.WriteString("[")
+			} else {
+				buffer.WriteString(",")
+			}
+			buffer.Write(record)
+			e.count++
+		}
+	case ResultFormatNdjson:
+		for _, record := range records {
+			buffer.Write(record)
+			buffer.WriteString("\n")
+			e.count++
+		}
+	case ResultFormatCsv:
+		err = e.encodeCsv(buffer, records)
+	}
+	encoded = buffer.Bytes()
+	return
+}
+
+// closing bytes after the last page
+func (e *resultEncoder) finish() []byte {
+	if e.format != ResultFormatJson {
+		return nil
+	}
+	if e.count == 0 {
+		return []byte("[]")
+	}
+	return []byte("]")
+}
+
+func (e *resultEncoder) encodeCsv(buffer *bytes.Buffer, records []json.RawMessage) (err error) {
+	flatRecords := []map[string]string{}
+	for _, record := range records {
+		decoder := json.NewDecoder(bytes.NewReader(record))
+		decoder.UseNumber()
+		var value any
+		err = decoder.Decode(&value)
+		if err != nil {
+			return
+		}
+		flatRecord := map[string]string{}
+		e.flatten("", value, flatRecord)
+		flatRecords = append(flatRecords, flatRecord)
+	}
+	writer := csv.NewWriter(buffer)
+	if e.header == nil {
+		e.header = e.csvHeader(flatRecords)
+		err = writer.Write(e.header)
+		if err != nil {
+			return
+		}
+	}
+	for _, flatRecord := range flatRecords {
+		row := make([]string, len(e.header))
+		for i, column := range e.header {
+			row[i] = flatRecord[column]
+		}
+		err = writer.Write(row)
+		if err != nil {
+			return
+		}
+		e.count++
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (e *resultEncoder) csvHeader(flatRecords []map[string]string) (header []string) {
+	keySet := map[string]bool{}
+	for _, flatRecord := range flatRecords {
+		for key := range flatRecord {
+			keySet[key] = true
+		}
+	}
+	keys := []string{}
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(e.fields) == 0 {
+		return keys
+	}
+	header = []string{}
+	added := map[string]bool{}
+	for _, field := range e.fields {
+		// a field without value in the first page still gets its column
+		if !keySet[field] && !hasKeyPrefix(keys, field+".") {
+			header = append(header, field)
+			added[field] = true
+			continue
+		}
+		for _, key := range keys {
+			if added[key] || (key != field && !strings.HasPrefix(key, field+".")) {
+				continue
+			}
+			header = append(header, key)
+			added[key] = true
+		}
+	}
+	return
+}
+
+/*
+Flatten nested objects to dot-notation columns
+
+JSON fields stored as string are parsed and flattened as well. Arrays, e.g. has-many relations,
+are kept as JSON in a single column.
+*/
+func (e *resultEncoder) flatten(prefix string, value any, flatRecord map[string]string) {
+	switch value := value.(type) {
+	case map[string]any:
+		if len(value) == 0 && prefix != "" {
+			flatRecord[prefix] = ""
+			return
+		}
+		for key, subValue := range value {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			e.flatten(key, subValue, flatRecord)
+		}
+	case []any:
+		bytes, _ := json.Marshal(value)
+		flatRecord[prefix] = string(bytes)
+	case string:
+		if e.jsonFields[prefix] {
+			var jsonValue any
+			decoder := json.NewDecoder(strings.NewReader(value))
+			decoder.UseNumber()
+			if decoder.Decode(&jsonValue) == nil {
+				if _, ok := jsonValue.(map[string]any); ok {
+					e.flatten(prefix, jsonValue, flatRecord)
+					return
+				}
+			}
+		}
+		flatRecord[prefix] = value
+	case nil:
+		flatRecord[prefix] = ""
+	default:
+		flatRecord[prefix] = fmt.Sprint(value)
+	}
+}
+
+func hasKeyPrefix(keys []string, prefix string) bool {
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Perform "Read" operation as a stream, page by page
+
+# Input
+
+options: JSON string, the same as Get
+  - format string : "json" (default), "ndjson" or "csv"
+  - limit int : page size of each chunk, 1000 by default (bounded by ModelClass.Limits)
+
+"page", "cursor" and "explain" are not supported, since pages are read by keyset pagination,
+ordered by the sort field (at most 1) and then the primary key (ref: gormquery.keyset).
+
+# Output
+
+stream of data chunks in the requested format. totalCount is set in the first chunk
+*/
+func (q *QueryServiceServer) Export(request *queryService.OptionRequest, stream queryService.QueryService_ExportServer) (err error) {
+	ctx := stream.Context()
+	options, modelClass, db, err := q.parseOptionRequest(request)
+	if err != nil {
+		return
+	}
+	if options.GetDefault("cursor", nil) != nil {
+		err = status.Error(codes.InvalidArgument, "cursor is not supported by export")
+		return
+	}
+	if isExplain(options) {
+		err = status.Error(codes.InvalidArgument, "explain is not supported by export")
+		return
+	}
+	modelSchema, err := schemaOf(db, modelClass.Model)
+	if err != nil {
+		return
+	}
+	encoder, err := modelClass.newResultEncoder(modelSchema, options)
+	if err != nil {
+		return
+	}
+	err = q.checkRateLimit(ctx, modelClass, OperationExport)
+	if err != nil {
+		return
+	}
+	ctx = context.WithValue(ctx, rateLimitSkipKey{}, true)
+	// pages are read by Get in JSON, and encoded here to keep a single csv header
+	var pageOptions skmap.Map
+	err = json.Unmarshal(request.Options, &pageOptions)
+	if err != nil {
+		return
+	}
+	if filter, ok := numberFilterOf(request.Options); ok {
+		pageOptions["filter"] = filter
+	}
+	pageOptions["format"] = ResultFormatJson
+	delete(pageOptions, "page")
+	pageSize := options.GetIntDefault("limit", 0)
+	if pageSize <= 0 {
+		pageSize = defaultExportPageSize
+	}
+	if modelClass.Limits.MaxPageSize > 0 && pageSize > modelClass.Limits.MaxPageSize {
+		pageSize = modelClass.Limits.MaxPageSize
+	}
+	pageOptions["limit"] = pageSize
+	cursor := ""
+	for first := true; ; first = false {
+		pageOptions["cursor"] = cursor
+		var pageBytes []byte
+		pageBytes, err = json.Marshal(pageOptions)
+		if err != nil {
+			return
+		}
+		pageCtx := context.WithValue(ctx, exportPageKey{}, exportPage{counted: !first})
+		var response *queryService.QueryResponse
+		response, err = q.Get(pageCtx, &queryService.OptionRequest{Options: pageBytes})
+		if err != nil {
+			return
+		}
+		var data []byte
+		data, err = encoder.encode(response.Results)
+		if err != nil {
+			return
+		}
+		chunk := &queryService.ExportChunk{Data: data}
+		if first {
+			chunk.TotalCount = response.TotalCount
+		}
+		// the cursor is empty after the last (not full) page
+		cursor = response.NextCursor
+		if cursor == "" {
+			chunk.Data = append(chunk.Data, encoder.finish()...)
+			return stream.Send(chunk)
+		}
+		err = stream.Send(chunk)
+		if err != nil {
+			return
+		}
+	}
+}
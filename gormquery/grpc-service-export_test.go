@@ -0,0 +1,117 @@
+package gormquery
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// export stream recording the chunks
+type testExportStream struct {
+	grpc.ServerStream
+	chunks []*queryService.ExportChunk
+}
+
+func (s *testExportStream) Context() context.Context {
+	return testCtx
+}
+
+func (s *testExportStream) Send(chunk *queryService.ExportChunk) error {
+	s.chunks = append(s.chunks, chunk)
+	return nil
+}
+
+// exported data and chunks of Export with options
+func testExport(t *testing.T, server *QueryServiceServer, options skmap.Map) (data string, chunks []*queryService.ExportChunk, err error) {
+	t.Helper()
+	stream := &testExportStream{}
+	err = server.Export(optionRequest(options), stream)
+	buffer := bytes.Buffer{}
+	for _, chunk := range stream.chunks {
+		buffer.Write(chunk.Data)
+	}
+	return buffer.String(), stream.chunks, err
+}
+
+func TestExport(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	options := skmap.Map{"fields": []string{"name", "price"}, "sort": skmap.Map{"id": "ASC"}, "limit": 2}
+
+	data, chunks, err := testExport(t, server, options)
+	expectNoError(t, err)
+	expectEqual(t, "chunks", 2, len(chunks))
+	expectEqual(t, "total count", uint64(3), chunks[0].TotalCount)
+	items := decodeResults[testItem](t, []byte(data))
+	expectEqual(t, "json", []testItem{{ID: 1, Name: "a", Price: 1}, {ID: 2, Name: "b", Price: 2}, {ID: 3, Name: "c", Price: 3}}, items)
+
+	options["format"] = ResultFormatNdjson
+	data, _, err = testExport(t, server, options)
+	expectNoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	expectEqual(t, "lines of ndjson", 3, len(lines))
+	expectEqual(t, "item of last line", items[2:], decodeResults[testItem](t, []byte("["+lines[2]+"]")))
+
+	// a single header across pages
+	options["format"] = ResultFormatCsv
+	data, _, err = testExport(t, server, options)
+	expectNoError(t, err)
+	expectEqual(t, "csv", "name,price\na,1\nb,2\nc,3\n", data)
+
+	data, _, err = testExport(t, server, skmap.Map{"filter": skmap.Map{"name": "z"}})
+	expectNoError(t, err)
+	expectEqual(t, "json of no results", "[]", data)
+}
+
+func TestExportPages(t *testing.T) {
+	primary := newTestDb(t)
+	replica := newTestDb(t)
+	server := newTestServer(primary, ModelClass{CacheTTL: time.Minute})
+	server.DefaultReadDb = replica
+	server.Cache = NewLRUCache(10)
+	// pages of equal sort values are ordered by primary key, in the direction of the sort field
+	expectNoError(t, primary.Model(&testItem{}).Where("1 = 1").Update("price", 5).Error)
+	options := skmap.Map{"fields": []string{"name", "price"}, "sort": skmap.Map{"price": "DESC"}, "limit": 1, "format": ResultFormatCsv}
+
+	data, chunks, err := testExport(t, server, options)
+	expectNoError(t, err)
+	expectEqual(t, "csv of primary", "name,price\nc,5\nb,5\na,5\n", data)
+	expectEqual(t, "chunks", 4, len(chunks))
+	expectEqual(t, "total count of first chunk", uint64(3), chunks[0].TotalCount)
+	expectEqual(t, "total count of next chunk", uint64(0), chunks[1].TotalCount)
+	expectEqual(t, "cached pages", 0, len(server.Cache.(*LRUCache).modelClasses["item"]))
+
+	_, _, err = testExport(t, server, skmap.Map{"sort": skmap.Map{"name": "ASC", "price": "ASC"}})
+	expectCode(t, "Export of 2 sort fields", codes.InvalidArgument, err)
+}
+
+func TestExportInvalid(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	_, _, err := testExport(t, server, skmap.Map{"format": "xml"})
+	expectCode(t, "Export of unknown format", codes.InvalidArgument, err)
+	_, _, err = testExport(t, server, skmap.Map{"cursor": ""})
+	expectCode(t, "Export with cursor", codes.InvalidArgument, err)
+	_, _, err = testExport(t, server, skmap.Map{"explain": true})
+	expectCode(t, "Export with explain", codes.InvalidArgument, err)
+}
+
+func TestResultEncoderCsv(t *testing.T) {
+	encoder, err := newResultEncoder(ResultFormatCsv, nil, map[string]bool{"meta": true})
+	expectNoError(t, err)
+	// header of sorted keys of the first page, with objects and JSON fields flattened, and arrays kept as JSON
+	data, err := encoder.encode([]byte(`[{"name":"a","category":{"name":"x"},"meta":"{\"color\":\"red\"}","tags":["p"]},{"name":"b,c","price":12345678901234567890}]`))
+	expectNoError(t, err)
+	expectEqual(t, "csv of first page", "category.name,meta.color,name,price,tags\nx,red,a,,\"[\"\"p\"\"]\"\n,,\"b,c\",12345678901234567890,\n", string(data))
+	data, err = encoder.encode([]byte(`[{"name":"d","score":1}]`))
+	expectNoError(t, err)
+	expectEqual(t, "csv of next page", ",,d,,\n", string(data))
+	expectEqual(t, "finish of csv", "", string(encoder.finish()))
+}
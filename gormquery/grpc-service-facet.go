@@ -0,0 +1,99 @@
+package gormquery
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+/*
+Distinct value of a facet with the number of matching records
+
+Facets of Get are returned in "facets" of the response, as JSON of facet field to values
+ordered by count (descending), e.g.
+
+	{"status": [{"value": "open", "count": 12}, {"value": "closed", "count": 3}]}
+*/
+type FacetValue struct {
+	Value any    `json:"value"`
+	Count uint64 `json:"count"`
+}
+
+// facet fields of option "facets", which must be whitelisted columns
+func (mc *ModelClass) parseFacets(options skmap.Map) (facets []string, err error) {
+	facets = options.GetStringArraySafe("facets")
+	for _, facet := range facets {
+		column := mc.column(facet)
+		isColumn := !strings.Contains(column, ".") && mc.WhitelistedFields.GetDefault(column, nil) != nil
+		if !isColumn || mc.WhitelistedFields.GetBoolDefault(fmt.Sprintf("%s.isJsonField", column), false) {
+			err = status.Errorf(codes.InvalidArgument, "invalid facet %s", facet)
+			return
+		}
+	}
+	return
+}
+
+/*
+Count records by distinct values of each facet under filter
+
+The filter of the facet itself is excluded, so that other values of a multi-select facet are still counted.
+Filters of other fields, "$or" alternatives and virtual fields apply as they do to the results.
+*/
+func (mc *ModelClass) facetCounts(ctx context.Context, db *gorm.DB, facets []string, filter skmap.Map) (facetsBytes []byte, err error) {
+	if len(facets) == 0 {
+		return
+	}
+	counts := map[string][]FacetValue{}
+	for _, facet := range facets {
+		column := mc.column(facet)
+		facetFilter := skmap.Map{}
+		for field, value := range filter {
+			if field != column {
+				facetFilter[field] = value
+			}
+		}
+		var qf QueryFactory
+		qf, _, _, err = newReadQuery(ctx, db, *mc, nil, facetFilter)
+		if err != nil {
+			return
+		}
+		var rows *sql.Rows
+		rows, err = qf.Query.
+			Select(fmt.Sprintf("%s AS facet_value, COUNT(*) AS facet_count", column)).
+			Group(column).
+			Order("facet_count DESC").
+			Order(column).
+			Rows()
+		if err != nil {
+			return
+		}
+		values := []FacetValue{}
+		for rows.Next() {
+			var value FacetValue
+			err = rows.Scan(&value.Value, &value.Count)
+			if err != nil {
+				rows.Close()
+				return
+			}
+			// text columns of some drivers are scanned as raw bytes
+			if bytes, ok := value.Value.([]byte); ok {
+				value.Value = string(bytes)
+			}
+			values = append(values, value)
+		}
+		rows.Close()
+		err = rows.Err()
+		if err != nil {
+			return
+		}
+		counts[facet] = values
+	}
+	return json.Marshal(counts)
+}
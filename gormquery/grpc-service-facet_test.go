@@ -0,0 +1,55 @@
+package gormquery
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+)
+
+// facets of Get with options
+func testFacets(t *testing.T, server *QueryServiceServer, options skmap.Map) (facets map[string][]FacetValue) {
+	t.Helper()
+	response, err := server.Get(testCtx, optionRequest(options))
+	expectNoError(t, err)
+	expectNoError(t, json.Unmarshal(response.Facets, &facets))
+	return
+}
+
+func TestFacets(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{VirtualFields: testVirtualFields})
+
+	facets := testFacets(t, server, skmap.Map{"facets": []string{"category_id", "name"}})
+	expectEqual(t, "facet of category", []FacetValue{{Value: float64(1), Count: 2}, {Value: float64(2), Count: 1}}, facets["category_id"])
+	expectEqual(t, "facet of name", []FacetValue{{Value: "a", Count: 1}, {Value: "b", Count: 1}, {Value: "c", Count: 1}}, facets["name"])
+
+	// the filter of the facet itself is excluded, while other filters apply
+	facets = testFacets(t, server, skmap.Map{"facets": []string{"category_id", "name"}, "filter": skmap.Map{"category_id": 1, "price": skmap.Map{"gte": 2}}})
+	expectEqual(t, "facet of filtered category", []FacetValue{{Value: float64(1), Count: 1}, {Value: float64(2), Count: 1}}, facets["category_id"])
+	expectEqual(t, "facet of filtered name", []FacetValue{{Value: "b", Count: 1}}, facets["name"])
+	facets = testFacets(t, server, skmap.Map{"facets": []string{"category_id"}, "filter": skmap.Map{FilterOr: []any{skmap.Map{"name": "a"}, skmap.Map{"price": 3}}}})
+	expectEqual(t, "facet of $or", []FacetValue{{Value: float64(1), Count: 1}, {Value: float64(2), Count: 1}}, facets["category_id"])
+	facets = testFacets(t, server, skmap.Map{"facets": []string{"category_id"}, "filter": skmap.Map{"double_price": []any{4, 6}}})
+	expectEqual(t, "facet of virtual field", []FacetValue{{Value: float64(1), Count: 1}, {Value: float64(2), Count: 1}}, facets["category_id"])
+
+	response, err := server.Get(testCtx, optionRequest(skmap.Map{}))
+	expectNoError(t, err)
+	expect(t, "no facets without option", len(response.Facets) == 0)
+}
+
+func TestFacetsAlias(t *testing.T) {
+	server := newTestAliasServer(t)
+	facets := testFacets(t, server, skmap.Map{"facets": []string{"title"}, "filter": skmap.Map{"title": "a", "amount": skmap.Map{"lte": 2}}})
+	expectEqual(t, "facet of alias", []FacetValue{{Value: "a", Count: 1}, {Value: "b", Count: 1}}, facets["title"])
+}
+
+func TestFacetsInvalid(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{WhitelistedFields: skmap.Map{"id": true, "name": true, "meta": skmap.Map{"isJsonField": true}}})
+	for _, facet := range []string{"price", "category.name", "meta"} {
+		_, err := server.Get(testCtx, optionRequest(skmap.Map{"facets": []string{facet}}))
+		expectCode(t, "facet of "+facet, codes.InvalidArgument, err)
+	}
+}
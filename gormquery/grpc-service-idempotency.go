@@ -0,0 +1,208 @@
+package gormquery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// gRPC metadata key carrying the idempotency key of a request
+const IdempotencyKeyMetadataKey = "x-idempotency-key"
+
+const (
+	defaultIdempotencyTable     = "idempotency_keys"
+	defaultIdempotencyRetention = 24 * time.Hour
+)
+
+/*
+Idempotency config of QueryServiceServer
+
+A Create or Update request with an idempotency key is recorded with its response in Table, in the
+same transaction as the write itself. Keys are scoped by the caller (ref: QueryServiceServer.GetCaller),
+so that callers choosing the same key do not replay each other's responses. Repeating the key within Retention replays the
+recorded response, while reusing it with different options is rejected. Concurrent requests
+of the same key fail on the primary key of the record except the first one, and replay its
+response as well.
+
+Example
+
+	db.Table("idempotency_keys").AutoMigrate(&gormquery.IdempotencyRecord{})
+	queryServiceServer := gormquery.QueryServiceServer{
+		...
+		Idempotency: &gormquery.IdempotencyConfig{
+			Retention: time.Hour,
+		},
+	}
+*/
+type IdempotencyConfig struct {
+	// Table of idempotency records. "idempotency_keys" would be used if it is not provided
+	Table string
+	// Retention of idempotency records, 24 hours by default
+	Retention time.Duration
+}
+
+// Record of idempotency table
+type IdempotencyRecord struct {
+	ModelClass     string    `gorm:"primaryKey" json:"modelClass"`
+	IdempotencyKey string    `gorm:"primaryKey" json:"idempotencyKey"`
+	Caller         string    `gorm:"primaryKey" json:"caller"`
+	RequestHash    string    `json:"requestHash"`
+	Response       []byte    `json:"response"`
+	ExpiredAt      time.Time `gorm:"index" json:"expiredAt"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Attach idempotency key to outgoing gRPC metadata, for QueryServiceModel calls
+func ContextWithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, IdempotencyKeyMetadataKey, key)
+}
+
+// idempotency key of option "idempotencyKey" or gRPC metadata "x-idempotency-key"
+func idempotencyKeyOf(ctx context.Context, options skmap.Map) string {
+	if key := options.GetStringDefault("idempotencyKey", ""); key != "" {
+		return key
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(IdempotencyKeyMetadataKey)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// idempotency of a request. It does nothing without config or key.
+type idempotency struct {
+	config      *IdempotencyConfig
+	modelClass  string
+	key         string
+	caller      string
+	requestHash string
+}
+
+func (q *QueryServiceServer) newIdempotency(ctx context.Context, modelClass ModelClass, options skmap.Map) (i *idempotency, err error) {
+	i = &idempotency{config: q.Idempotency, modelClass: modelClass.name}
+	if i.config == nil {
+		return
+	}
+	i.key = idempotencyKeyOf(ctx, options)
+	if i.key == "" {
+		return
+	}
+	i.caller = q.callerOf(ctx)
+	// the key itself is not a part of the payload
+	payload := skmap.Map{}
+	for key, value := range options {
+		if key != "idempotencyKey" {
+			payload[key] = value
+		}
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	hash := sha256.Sum256(payloadBytes)
+	i.requestHash = hex.EncodeToString(hash[:])
+	return
+}
+
+func (i *idempotency) enabled() bool {
+	return i.config != nil && i.key != ""
+}
+
+func (i *idempotency) table(tx *gorm.DB) *gorm.DB {
+	table := i.config.Table
+	if table == "" {
+		table = defaultIdempotencyTable
+	}
+	return tx.Table(table)
+}
+
+// record of the key. The caller is compared explicitly, since an empty caller is ignored by struct conditions
+func (i *idempotency) recordOf(tx *gorm.DB) *gorm.DB {
+	return i.table(tx).
+		Where(&IdempotencyRecord{ModelClass: i.modelClass, IdempotencyKey: i.key}).
+		Where("caller = ?", i.caller)
+}
+
+/*
+Look up recorded response of the key
+
+Expired records are removed, so that the key could be used again.
+*/
+func (i *idempotency) replay(tx *gorm.DB) (response []byte, ok bool, err error) {
+	if !i.enabled() {
+		return
+	}
+	record := IdempotencyRecord{}
+	err = i.recordOf(tx).Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	if !record.ExpiredAt.After(time.Now()) {
+		err = i.recordOf(tx).Delete(&IdempotencyRecord{}).Error
+		return
+	}
+	if record.RequestHash != i.requestHash {
+		err = status.Error(codes.InvalidArgument, "idempotency key is reused with different payload")
+		return
+	}
+	return record.Response, true, nil
+}
+
+func (i *idempotency) record(tx *gorm.DB, response []byte) error {
+	if !i.enabled() {
+		return nil
+	}
+	retention := i.config.Retention
+	if retention <= 0 {
+		retention = defaultIdempotencyRetention
+	}
+	return i.table(tx).Create(&IdempotencyRecord{
+		ModelClass:     i.modelClass,
+		IdempotencyKey: i.key,
+		Caller:         i.caller,
+		RequestHash:    i.requestHash,
+		Response:       response,
+		ExpiredAt:      time.Now().Add(retention),
+	}).Error
+}
+
+/*
+Replay the response of a concurrent request with the same key, after the transaction failed
+
+Concurrent requests all miss the record in replay, and all but the first fail on the primary
+key of the record (or on a unique field of the created record). The record of the first is
+committed by then, so its response is replayed. txErr is returned if there is no such record.
+*/
+func (i *idempotency) replayConflict(db *gorm.DB, txErr error) (response []byte, err error) {
+	if !i.enabled() {
+		return nil, txErr
+	}
+	record := IdempotencyRecord{}
+	err = i.recordOf(db).
+		Where("expired_at > ?", time.Now()).
+		Take(&record).Error
+	if err != nil {
+		return nil, txErr
+	}
+	if record.RequestHash != i.requestHash {
+		return nil, status.Error(codes.InvalidArgument, "idempotency key is reused with different payload")
+	}
+	return record.Response, nil
+}
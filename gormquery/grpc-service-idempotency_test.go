@@ -0,0 +1,127 @@
+package gormquery
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"gorm.io/gorm"
+)
+
+func newTestIdempotencyServer(t *testing.T) *QueryServiceServer {
+	db := newTestDb(t)
+	expectNoError(t, db.Table(defaultIdempotencyTable).AutoMigrate(&IdempotencyRecord{}))
+	server := newTestServer(db, ModelClass{})
+	server.Idempotency = &IdempotencyConfig{}
+	return server
+}
+
+func TestIdempotency(t *testing.T) {
+	server := newTestIdempotencyServer(t)
+	options := skmap.Map{"data": skmap.Map{"name": "d", "price": 4}, "idempotencyKey": "k1"}
+	response1, err := server.Create(testCtx, optionRequest(options))
+	expectNoError(t, err)
+	response2, err := server.Create(testCtx, optionRequest(options))
+	expectNoError(t, err)
+	expectEqual(t, "replayed result", string(response1.Result), string(response2.Result))
+	// the key of metadata
+	ctx := metadata.NewIncomingContext(testCtx, metadata.Pairs(IdempotencyKeyMetadataKey, "k1"))
+	response3, err := server.Create(ctx, optionRequest(skmap.Map{"data": skmap.Map{"name": "d", "price": 4}}))
+	expectNoError(t, err)
+	expectEqual(t, "replayed result of metadata key", string(response1.Result), string(response3.Result))
+	expectEqual(t, "names", []string{"a", "b", "c", "d"}, testItemNames(t, server, skmap.Map{}))
+
+	_, err = server.Create(testCtx, optionRequest(skmap.Map{"data": skmap.Map{"name": "e"}, "idempotencyKey": "k1"}))
+	expectCode(t, "key reused with different payload", codes.InvalidArgument, err)
+	_, err = server.Create(testCtx, optionRequest(skmap.Map{"data": skmap.Map{"name": "d", "price": 4}}))
+	expectNoError(t, err)
+	expectEqual(t, "names without key", []string{"a", "b", "c", "d", "d"}, testItemNames(t, server, skmap.Map{}))
+}
+
+func TestIdempotencyCallers(t *testing.T) {
+	server := newTestIdempotencyServer(t)
+	options := skmap.Map{"data": skmap.Map{"name": "d", "price": 4}, "idempotencyKey": "k1"}
+	callerCtx := func(ip string) context.Context {
+		return peer.NewContext(testCtx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}})
+	}
+	responseA, err := server.Create(callerCtx("10.0.0.1"), optionRequest(options))
+	expectNoError(t, err)
+	// the same key of another caller is another request
+	responseB, err := server.Create(callerCtx("10.0.0.2"), optionRequest(options))
+	expectNoError(t, err)
+	expect(t, "result of another caller", string(responseA.Result) != string(responseB.Result))
+	expectEqual(t, "names", []string{"a", "b", "c", "d", "d"}, testItemNames(t, server, skmap.Map{}))
+
+	replayed, err := server.Create(callerCtx("10.0.0.2"), optionRequest(options))
+	expectNoError(t, err)
+	expectEqual(t, "replayed result of the caller", string(responseB.Result), string(replayed.Result))
+	_, err = server.Create(callerCtx("10.0.0.1"), optionRequest(skmap.Map{"data": skmap.Map{"name": "e"}, "idempotencyKey": "k1"}))
+	expectCode(t, "key reused by the caller with different payload", codes.InvalidArgument, err)
+	expectEqual(t, "names after replay", []string{"a", "b", "c", "d", "d"}, testItemNames(t, server, skmap.Map{}))
+}
+
+func TestIdempotencyExpired(t *testing.T) {
+	server := newTestIdempotencyServer(t)
+	server.Idempotency.Retention = -1
+	options := skmap.Map{"data": skmap.Map{"name": "d"}, "idempotencyKey": "k1"}
+	for i := 0; i < 2; i++ {
+		_, err := server.Create(testCtx, optionRequest(options))
+		expectNoError(t, err)
+	}
+	// retention <= 0 falls back to the default, so the second request is replayed
+	expectEqual(t, "names", []string{"a", "b", "c", "d"}, testItemNames(t, server, skmap.Map{}))
+
+	expectNoError(t, server.DefaultDb.Table(defaultIdempotencyTable).Where("1 = 1").Update("expired_at", "2000-01-01").Error)
+	_, err := server.Create(testCtx, optionRequest(options))
+	expectNoError(t, err)
+	expectEqual(t, "names after expiry", []string{"a", "b", "c", "d", "d"}, testItemNames(t, server, skmap.Map{}))
+}
+
+func TestIdempotencyConcurrent(t *testing.T) {
+	server := newTestIdempotencyServer(t)
+	db := server.DefaultDb
+	// WAL lets the concurrent request commit while the first transaction holds its read snapshot
+	expectNoError(t, db.Exec("PRAGMA journal_mode=WAL").Error)
+	options := skmap.Map{"data": skmap.Map{"name": "d", "price": 4}, "idempotencyKey": "k1"}
+	var concurrentResponse *queryService.CreateResponse
+	started := false
+	expectNoError(t, db.Callback().Create().Before("gorm:create").Register("test:concurrent_create", func(tx *gorm.DB) {
+		if started || tx.Statement.Table != "test_items" {
+			return
+		}
+		started = true
+		// the same key is committed after the replay of this transaction missed it
+		var err error
+		concurrentResponse, err = server.Create(context.Background(), optionRequest(options))
+		expectNoError(t, err)
+	}))
+	response, err := server.Create(testCtx, optionRequest(options))
+	expectNoError(t, err)
+	expectEqual(t, "replayed result", string(concurrentResponse.Result), string(response.Result))
+	expectEqual(t, "names", []string{"a", "b", "c", "d"}, testItemNames(t, server, skmap.Map{}))
+}
+
+func TestIdempotencyUpdate(t *testing.T) {
+	server := newTestIdempotencyServer(t)
+	db := server.DefaultDb
+	options := skmap.Map{"filter": skmap.Map{"name": "a"}, "data": skmap.Map{"price": 10}, "idempotencyKey": "k1"}
+	_, err := server.Update(testCtx, optionRequest(options))
+	expectNoError(t, err)
+	expectEqual(t, "price of a", 10, testItemPrice(t, db, "a"))
+	// the repeated request is replayed without updating again
+	expectNoError(t, db.Model(&testItem{}).Where("name = ?", "a").Update("price", 20).Error)
+	_, err = server.Update(testCtx, optionRequest(options))
+	expectNoError(t, err)
+	expectEqual(t, "price of a after replay", 20, testItemPrice(t, db, "a"))
+
+	_, err = server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "a"}, "data": skmap.Map{"price": 30}, "idempotencyKey": "k1"}))
+	expectCode(t, "key reused with different payload", codes.InvalidArgument, err)
+	_, err = server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "a"}, "data": skmap.Map{"price": 10}}))
+	expectNoError(t, err)
+	expectEqual(t, "price of a without key", 10, testItemPrice(t, db, "a"))
+}
@@ -0,0 +1,342 @@
+package gormquery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/levav-enspiren/common-go/gormquery/helper"
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	ImportFormatCsv    = "csv"
+	ImportFormatNdjson = "ndjson"
+)
+
+const defaultImportBatchSize = 100
+
+// Error of a row in Import report. Row is 1-based, excluding CSV header
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+/*
+Perform "Import" operation, creating records from a CSV / NDJSON stream
+
+# Input
+
+options of the first request: JSON string
+  - modelClass string : model class name
+  - format string : "csv" (default, with header row) or "ndjson"
+  - batchSize int : rows per transaction, 100 by default
+  - atomic bool : all-or-nothing. Nothing is committed if any row fails
+
+data of each request: next chunk of the file
+
+# Output
+
+totalCount, importedCount, and errors (JSON array of gormquery.ImportRowError)
+*/
+func (q *QueryServiceServer) Import(stream queryService.QueryService_ImportServer) (err error) {
+	ctx := stream.Context()
+	first, err := stream.Recv()
+	if err != nil {
+		return
+	}
+	options, modelClass, db, err := q.parseOptionRequest(&queryService.OptionRequest{Options: first.Options})
+	if err != nil {
+		return
+	}
+	if !modelClass.CanCreate {
+		err = status.Error(codes.PermissionDenied, "permission denied")
+		return
+	}
+	err = q.checkRateLimit(ctx, modelClass, OperationImport)
+	if err != nil {
+		return
+	}
+	batchSize := options.GetIntDefault("batchSize", defaultImportBatchSize)
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+	reader := &importStreamReader{stream: stream, buffer: first.Data}
+	nextRow, err := newImportRowReader(options.GetStringDefault("format", ImportFormatCsv), reader)
+	if err != nil {
+		return
+	}
+	im := &importer{
+		ctx:        ctx,
+		db:         db,
+		modelClass: modelClass,
+		atomic:     options.GetBoolDefault("atomic", false),
+		rowErrors:  []ImportRowError{},
+	}
+	err = im.run(nextRow, batchSize)
+	if err != nil {
+		return
+	}
+	if im.importedCount > 0 {
+		q.invalidateCache(db, modelClass)
+	}
+	errorsBytes, err := json.Marshal(im.rowErrors)
+	if err != nil {
+		return
+	}
+	return stream.SendAndClose(&queryService.ImportResponse{
+		TotalCount:    uint64(im.totalCount),
+		ImportedCount: uint64(im.importedCount),
+		Errors:        errorsBytes,
+	})
+}
+
+// io.Reader over data chunks of the import stream
+type importStreamReader struct {
+	stream queryService.QueryService_ImportServer
+	buffer []byte
+}
+
+func (r *importStreamReader) Read(p []byte) (n int, err error) {
+	for len(r.buffer) == 0 {
+		var request *queryService.ImportRequest
+		request, err = r.stream.Recv()
+		if err != nil {
+			return
+		}
+		r.buffer = request.Data
+	}
+	n = copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
+	return
+}
+
+// error of a single row, which is reported without stopping the import
+type importRowError struct {
+	err error
+}
+
+func (e *importRowError) Error() string {
+	return e.err.Error()
+}
+
+// returns next row data, or io.EOF at the end
+type importRowReader func() (data skmap.Map, err error)
+
+func newImportRowReader(format string, reader io.Reader) (nextRow importRowReader, err error) {
+	switch format {
+	case ImportFormatCsv:
+		return newCsvRowReader(reader), nil
+	case ImportFormatNdjson:
+		return newNdjsonRowReader(reader), nil
+	}
+	err = status.Errorf(codes.InvalidArgument, "unknown import format %s", format)
+	return
+}
+
+// columns are mapped by header row. Empty values are imported as null
+func newCsvRowReader(reader io.Reader) importRowReader {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	var header []string
+	return func() (data skmap.Map, err error) {
+		if header == nil {
+			header, err = csvReader.Read()
+			if err != nil {
+				return
+			}
+		}
+		record, err := csvReader.Read()
+		if err != nil {
+			var parseError *csv.ParseError
+			if errors.As(err, &parseError) {
+				err = &importRowError{err}
+			}
+			return
+		}
+		if len(record) != len(header) {
+			err = &importRowError{fmt.Errorf("expected %d columns, got %d", len(header), len(record))}
+			return
+		}
+		data = skmap.Map{}
+		for i, column := range header {
+			if record[i] == "" {
+				data[column] = nil
+				continue
+			}
+			data[column] = record[i]
+		}
+		return
+	}
+}
+
+// one JSON object per line. Blank lines are skipped
+func newNdjsonRowReader(reader io.Reader) importRowReader {
+	bufReader := bufio.NewReader(reader)
+	return func() (data skmap.Map, err error) {
+		for {
+			line, readErr := bufReader.ReadBytes('\n')
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				if readErr != nil {
+					return nil, readErr
+				}
+				continue
+			}
+			if readErr != nil && readErr != io.EOF {
+				return nil, readErr
+			}
+			err = json.Unmarshal(line, &data)
+			if err != nil {
+				err = &importRowError{err}
+			}
+			return
+		}
+	}
+}
+
+type importRow struct {
+	number int
+	data   map[string]any
+}
+
+type importer struct {
+	ctx           context.Context
+	db            *gorm.DB
+	modelClass    ModelClass
+	atomic        bool
+	totalCount    int
+	importedCount int
+	rowErrors     []ImportRowError
+}
+
+var errImportRollback = errors.New("import rolled back")
+
+func (im *importer) run(nextRow importRowReader, batchSize int) (err error) {
+	if !im.atomic {
+		return im.readBatches(nil, nextRow, batchSize)
+	}
+	err = im.db.WithContext(im.ctx).Transaction(func(tx *gorm.DB) error {
+		err := im.readBatches(tx, nextRow, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(im.rowErrors) > 0 {
+			return errImportRollback
+		}
+		return nil
+	})
+	if err == errImportRollback {
+		im.importedCount = 0
+		err = nil
+	}
+	return
+}
+
+// tx is the transaction of atomic import, or nil to commit each batch separately
+func (im *importer) readBatches(tx *gorm.DB, nextRow importRowReader, batchSize int) (err error) {
+	batch := []importRow{}
+	for {
+		data, rowErr := nextRow()
+		if rowErr == io.EOF {
+			break
+		}
+		im.totalCount++
+		if rowErr != nil {
+			var importRowErr *importRowError
+			if !errors.As(rowErr, &importRowErr) {
+				return rowErr
+			}
+			im.appendRowError(im.totalCount, rowErr)
+			continue
+		}
+		data = im.modelClass.columnMap(data)
+		rowErr = im.modelClass.validateCreateData(data)
+		if rowErr != nil {
+			im.appendRowError(im.totalCount, rowErr)
+			continue
+		}
+		batch = append(batch, importRow{number: im.totalCount, data: helper.CastDataMap(data)})
+		if len(batch) < batchSize {
+			continue
+		}
+		err = im.commit(tx, batch)
+		if err != nil {
+			return
+		}
+		batch = []importRow{}
+	}
+	if len(batch) > 0 {
+		err = im.commit(tx, batch)
+	}
+	return
+}
+
+func (im *importer) commit(tx *gorm.DB, batch []importRow) error {
+	if tx == nil {
+		tx = im.db.WithContext(im.ctx)
+	}
+	return tx.Transaction(func(tx *gorm.DB) error {
+		return im.commitBatch(tx, batch)
+	})
+}
+
+/*
+Insert the batch in a savepoint, or retry with a savepoint per row to locate failing rows
+
+Rows are created one by one as map records, since gORM appends returned rows to a slice of maps.
+*/
+func (im *importer) commitBatch(tx *gorm.DB, batch []importRow) (err error) {
+	records := []map[string]any{}
+	for _, row := range batch {
+		err = fillAutoTime(tx, im.modelClass, row.data)
+		if err != nil {
+			return
+		}
+		records = append(records, row.data)
+	}
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		for _, record := range records {
+			record := record
+			err := tx.Model(im.modelClass.CreateModelRef()).Create(&record).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		records = []map[string]any{}
+		for _, row := range batch {
+			record := row.data
+			rowErr := tx.Transaction(func(tx *gorm.DB) error {
+				return tx.Model(im.modelClass.CreateModelRef()).Create(&record).Error
+			})
+			if rowErr != nil {
+				im.appendRowError(row.number, rowErr)
+				continue
+			}
+			records = append(records, record)
+		}
+	}
+	im.importedCount += len(records)
+	auditor := newAuditor(im.ctx, tx, im.modelClass, AuditOperationCreate, nil)
+	after, err := auditor.snapshotCreated(records)
+	if err != nil {
+		return
+	}
+	return auditor.record(after)
+}
+
+func (im *importer) appendRowError(row int, err error) {
+	im.rowErrors = append(im.rowErrors, ImportRowError{Row: row, Message: status.Convert(err).Message()})
+}
@@ -0,0 +1,116 @@
+package gormquery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// import stream of requests, recording the response
+type testImportStream struct {
+	grpc.ServerStream
+	requests []*queryService.ImportRequest
+	response *queryService.ImportResponse
+}
+
+func (s *testImportStream) Context() context.Context {
+	return testCtx
+}
+
+func (s *testImportStream) Recv() (request *queryService.ImportRequest, err error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	request, s.requests = s.requests[0], s.requests[1:]
+	return
+}
+
+func (s *testImportStream) SendAndClose(response *queryService.ImportResponse) error {
+	s.response = response
+	return nil
+}
+
+// imports chunks of data, with options in the first request
+func testImport(t *testing.T, server *QueryServiceServer, options skmap.Map, chunks ...string) (response *queryService.ImportResponse, rowErrors []ImportRowError, err error) {
+	t.Helper()
+	stream := &testImportStream{}
+	for i, chunk := range chunks {
+		request := &queryService.ImportRequest{Data: []byte(chunk)}
+		if i == 0 {
+			request.Options = optionRequest(options).Options
+		}
+		stream.requests = append(stream.requests, request)
+	}
+	err = server.Import(stream)
+	if err != nil {
+		return
+	}
+	response = stream.response
+	expectNoError(t, json.Unmarshal(response.Errors, &rowErrors))
+	return
+}
+
+func TestImportCsv(t *testing.T) {
+	db := newTestDb(t)
+	expectNoError(t, db.Exec("CREATE UNIQUE INDEX idx_test_items_name ON test_items(name)").Error)
+	server := newTestServer(db, ModelClass{ValidateData: func(data skmap.Map) error {
+		if data["name"] == nil {
+			return errors.New("name is required")
+		}
+		return nil
+	}})
+	// rows split across chunks: empty name, missing column and duplicate name fail
+	response, rowErrors, err := testImport(t, server, skmap.Map{"batchSize": 2}, "name,price,category_id\nd,4,1\n,5,1\ne,6", ",2\nf,7\na,8,1\ng,9,2\n")
+	expectNoError(t, err)
+	expectEqual(t, "total count", uint64(6), response.TotalCount)
+	expectEqual(t, "imported count", uint64(3), response.ImportedCount)
+	rows := []int{}
+	for _, rowError := range rowErrors {
+		rows = append(rows, rowError.Row)
+	}
+	expectEqual(t, "rows of errors", []int{2, 4, 5}, rows)
+	expectEqual(t, "names", []string{"a", "b", "c", "d", "e", "g"}, testItemNames(t, server, skmap.Map{}))
+	expectEqual(t, "price of e", 6, testItemPrice(t, db, "e"))
+}
+
+func TestImportNdjson(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	response, rowErrors, err := testImport(t, server, skmap.Map{"format": ImportFormatNdjson}, `{"name":"d","price":4}`+"\n\n"+`not json`+"\n"+`{"name":"e"}`)
+	expectNoError(t, err)
+	expectEqual(t, "total count", uint64(3), response.TotalCount)
+	expectEqual(t, "imported count", uint64(2), response.ImportedCount)
+	expectEqual(t, "row of error", 2, rowErrors[0].Row)
+	expectEqual(t, "names", []string{"a", "b", "c", "d", "e"}, testItemNames(t, server, skmap.Map{}))
+}
+
+func TestImportAtomic(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	response, rowErrors, err := testImport(t, server, skmap.Map{"format": ImportFormatNdjson, "atomic": true, "batchSize": 1}, `{"name":"d"}`+"\n"+`{"name":"e"}`+"\n"+`not json`)
+	expectNoError(t, err)
+	expectEqual(t, "total count", uint64(3), response.TotalCount)
+	expectEqual(t, "imported count", uint64(0), response.ImportedCount)
+	expectEqual(t, "errors", 1, len(rowErrors))
+	expectEqual(t, "names", []string{"a", "b", "c"}, testItemNames(t, server, skmap.Map{}))
+}
+
+func TestImportInvalid(t *testing.T) {
+	db := newTestDb(t)
+	_, _, err := testImport(t, newTestServer(db, ModelClass{}), skmap.Map{"format": "xml"}, "<items/>")
+	expectCode(t, "Import of unknown format", codes.InvalidArgument, err)
+
+	server := newTestServer(db, ModelClass{})
+	modelClass := server.ModelClasses["item"]
+	modelClass.CanCreate = false
+	server.ModelClasses["item"] = modelClass
+	_, _, err = testImport(t, server, skmap.Map{}, "name\nd\n")
+	expectCode(t, "Import without CanCreate", codes.PermissionDenied, err)
+}
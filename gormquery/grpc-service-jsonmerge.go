@@ -0,0 +1,291 @@
+package gormquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm/clause"
+)
+
+// key of a merge patch value appending elements to an array, e.g. {"labels": {"$append": ["a", "b"]}}
+const JsonAppend = "$append"
+
+/*
+In-place JSON functions of a dialect, for compiling merge patches of JSON columns
+
+Paths are keys from the column root. Values at paths are read from the column as it is before the update.
+*/
+type jsonMergeDialect interface {
+	// object at path, or an empty object if it is not an object
+	objectAt(column string, path []string) clause.Expr
+	// array at path, or an empty array if it is not an array
+	arrayAt(column string, path []string) clause.Expr
+	remove(object clause.Expr, keys []string) clause.Expr
+	set(object clause.Expr, keys []string, values []clause.Expr) clause.Expr
+	concat(array clause.Expr, elements []any) clause.Expr
+	literal(value any) clause.Expr
+}
+
+var jsonMergeDialects = map[string]jsonMergeDialect{
+	"postgres": postgresJsonMerge{},
+	"mysql":    mysqlJsonMerge{},
+	"sqlite":   sqliteJsonMerge{},
+}
+
+/*
+Replace values of JSON columns in data with in-place merge patch updates (RFC 7386)
+
+Applied to columns with "isJsonField" in WhitelistedFields whose value is an object:
+  - a key with null is removed
+  - a key with an object is merged recursively, and created if it is not an object
+  - a key with {"$append": [...]} appends the elements to the array, which is created if it is not an array
+  - a key with any other value is set
+
+Keys with double quotes or backslashes are rejected.
+
+Other values replace the whole column as before.
+*/
+func (mc *ModelClass) applyJsonMerge(dialectName string, data skmap.Hash) (err error) {
+	for field, value := range data {
+		if !mc.WhitelistedFields.GetBoolDefault(fmt.Sprintf("%s.isJsonField", field), false) {
+			continue
+		}
+		patch, ok := jsonObjectOf(value)
+		if !ok {
+			continue
+		}
+		dialect, ok := jsonMergeDialects[dialectName]
+		if !ok {
+			return status.Errorf(codes.Unimplemented, "json merge is not supported by %s", dialectName)
+		}
+		data[field], err = compileJsonMerge(dialect, field, nil, patch)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid json merge of %s: %v", field, err)
+		}
+	}
+	return
+}
+
+func jsonObjectOf(value any) (object map[string]any, ok bool) {
+	switch value := value.(type) {
+	case map[string]any:
+		return value, true
+	case skmap.Map:
+		return value, true
+	}
+	return
+}
+
+func compileJsonMerge(dialect jsonMergeDialect, column string, path []string, patch map[string]any) (expr clause.Expr, err error) {
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	removedKeys := []string{}
+	setKeys := []string{}
+	values := []clause.Expr{}
+	for _, key := range keys {
+		// not supported by JSON paths of SQLite, for removed keys as well
+		if strings.ContainsAny(key, `"\`) {
+			return expr, fmt.Errorf("unsupported key %s", strconv.Quote(key))
+		}
+		value := patch[key]
+		if value == nil {
+			removedKeys = append(removedKeys, key)
+			continue
+		}
+		keyPath := append(append([]string{}, path...), key)
+		var valueExpr clause.Expr
+		if object, ok := jsonObjectOf(value); ok {
+			if elements, ok := object[JsonAppend]; ok {
+				if len(object) > 1 {
+					return expr, fmt.Errorf("%s of %s with other keys", JsonAppend, strings.Join(keyPath, "."))
+				}
+				elementArray, ok := elements.([]any)
+				if !ok {
+					elementArray = []any{elements}
+				}
+				valueExpr = dialect.concat(dialect.arrayAt(column, keyPath), elementArray)
+			} else {
+				valueExpr, err = compileJsonMerge(dialect, column, keyPath, object)
+				if err != nil {
+					return
+				}
+			}
+		} else {
+			valueExpr = dialect.literal(value)
+		}
+		setKeys = append(setKeys, key)
+		values = append(values, valueExpr)
+	}
+	expr = dialect.objectAt(column, path)
+	if len(removedKeys) > 0 {
+		expr = dialect.remove(expr, removedKeys)
+	}
+	if len(setKeys) > 0 {
+		expr = dialect.set(expr, setKeys, values)
+	}
+	return
+}
+
+func jsonText(value any) string {
+	valueBytes, _ := json.Marshal(value)
+	return string(valueBytes)
+}
+
+// placeholders of n values, e.g. "?, ?, ?"
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// JSON path of MySQL / SQLite, e.g. $."a"."b"
+func jsonPathOf(path []string) string {
+	jsonPath := "$"
+	for _, key := range path {
+		jsonPath += "." + strconv.Quote(key)
+	}
+	return jsonPath
+}
+
+// jsonb of Postgres
+type postgresJsonMerge struct{}
+
+func (postgresJsonMerge) valueAt(column string, path []string) clause.Expr {
+	if len(path) == 0 {
+		return clause.Expr{SQL: fmt.Sprintf("CAST(%s AS jsonb)", column)}
+	}
+	vars := []any{}
+	for _, key := range path {
+		vars = append(vars, key)
+	}
+	return clause.Expr{SQL: fmt.Sprintf("jsonb_extract_path(CAST(%s AS jsonb), %s)", column, placeholders(len(path))), Vars: vars}
+}
+
+func (d postgresJsonMerge) objectAt(column string, path []string) clause.Expr {
+	value := d.valueAt(column, path)
+	return clause.Expr{SQL: "(CASE WHEN jsonb_typeof(?) = 'object' THEN ? ELSE '{}'::jsonb END)", Vars: []any{value, value}}
+}
+
+func (d postgresJsonMerge) arrayAt(column string, path []string) clause.Expr {
+	value := d.valueAt(column, path)
+	return clause.Expr{SQL: "(CASE WHEN jsonb_typeof(?) = 'array' THEN ? ELSE '[]'::jsonb END)", Vars: []any{value, value}}
+}
+
+func (postgresJsonMerge) remove(object clause.Expr, keys []string) clause.Expr {
+	vars := []any{object}
+	for _, key := range keys {
+		vars = append(vars, key)
+	}
+	return clause.Expr{SQL: "(?" + strings.Repeat(" - CAST(? AS text)", len(keys)) + ")", Vars: vars}
+}
+
+func (postgresJsonMerge) set(object clause.Expr, keys []string, values []clause.Expr) clause.Expr {
+	vars := []any{object}
+	for i, key := range keys {
+		vars = append(vars, key, values[i])
+	}
+	return clause.Expr{SQL: "(? || jsonb_build_object(" + strings.TrimPrefix(strings.Repeat(", CAST(? AS text), ?", len(keys)), ", ") + "))", Vars: vars}
+}
+
+func (postgresJsonMerge) concat(array clause.Expr, elements []any) clause.Expr {
+	return clause.Expr{SQL: "(? || CAST(? AS jsonb))", Vars: []any{array, jsonText(elements)}}
+}
+
+func (postgresJsonMerge) literal(value any) clause.Expr {
+	return clause.Expr{SQL: "CAST(? AS jsonb)", Vars: []any{jsonText(value)}}
+}
+
+type mysqlJsonMerge struct{}
+
+func (mysqlJsonMerge) objectAt(column string, path []string) clause.Expr {
+	return clause.Expr{
+		SQL:  fmt.Sprintf("(CASE WHEN JSON_TYPE(JSON_EXTRACT(%s, ?)) = 'OBJECT' THEN JSON_EXTRACT(%s, ?) ELSE JSON_OBJECT() END)", column, column),
+		Vars: []any{jsonPathOf(path), jsonPathOf(path)},
+	}
+}
+
+func (mysqlJsonMerge) arrayAt(column string, path []string) clause.Expr {
+	return clause.Expr{
+		SQL:  fmt.Sprintf("(CASE WHEN JSON_TYPE(JSON_EXTRACT(%s, ?)) = 'ARRAY' THEN JSON_EXTRACT(%s, ?) ELSE JSON_ARRAY() END)", column, column),
+		Vars: []any{jsonPathOf(path), jsonPathOf(path)},
+	}
+}
+
+func (mysqlJsonMerge) remove(object clause.Expr, keys []string) clause.Expr {
+	vars := []any{object}
+	for _, key := range keys {
+		vars = append(vars, jsonPathOf([]string{key}))
+	}
+	return clause.Expr{SQL: fmt.Sprintf("JSON_REMOVE(?, %s)", placeholders(len(keys))), Vars: vars}
+}
+
+func (mysqlJsonMerge) set(object clause.Expr, keys []string, values []clause.Expr) clause.Expr {
+	vars := []any{object}
+	for i, key := range keys {
+		vars = append(vars, jsonPathOf([]string{key}), values[i])
+	}
+	return clause.Expr{SQL: fmt.Sprintf("JSON_SET(?, %s)", placeholders(len(keys)*2)), Vars: vars}
+}
+
+func (mysqlJsonMerge) concat(array clause.Expr, elements []any) clause.Expr {
+	return clause.Expr{SQL: "JSON_MERGE_PRESERVE(?, CAST(? AS JSON))", Vars: []any{array, jsonText(elements)}}
+}
+
+func (mysqlJsonMerge) literal(value any) clause.Expr {
+	return clause.Expr{SQL: "CAST(? AS JSON)", Vars: []any{jsonText(value)}}
+}
+
+// JSON functions of SQLite 3.31+, with values wrapped by json() to be inserted as JSON rather than strings
+type sqliteJsonMerge struct{}
+
+func (sqliteJsonMerge) objectAt(column string, path []string) clause.Expr {
+	return clause.Expr{
+		SQL:  fmt.Sprintf("(CASE WHEN json_type(%s, ?) = 'object' THEN json_extract(%s, ?) ELSE json_object() END)", column, column),
+		Vars: []any{jsonPathOf(path), jsonPathOf(path)},
+	}
+}
+
+func (sqliteJsonMerge) arrayAt(column string, path []string) clause.Expr {
+	return clause.Expr{
+		SQL:  fmt.Sprintf("(CASE WHEN json_type(%s, ?) = 'array' THEN json_extract(%s, ?) ELSE json_array() END)", column, column),
+		Vars: []any{jsonPathOf(path), jsonPathOf(path)},
+	}
+}
+
+func (sqliteJsonMerge) remove(object clause.Expr, keys []string) clause.Expr {
+	vars := []any{object}
+	for _, key := range keys {
+		vars = append(vars, jsonPathOf([]string{key}))
+	}
+	return clause.Expr{SQL: fmt.Sprintf("json_remove(?, %s)", placeholders(len(keys))), Vars: vars}
+}
+
+func (sqliteJsonMerge) set(object clause.Expr, keys []string, values []clause.Expr) clause.Expr {
+	vars := []any{object}
+	for i, key := range keys {
+		vars = append(vars, jsonPathOf([]string{key}), values[i])
+	}
+	return clause.Expr{SQL: "json_set(?" + strings.Repeat(", ?, json(?)", len(keys)) + ")", Vars: vars}
+}
+
+func (sqliteJsonMerge) concat(array clause.Expr, elements []any) clause.Expr {
+	if len(elements) == 0 {
+		return array
+	}
+	vars := []any{array}
+	for _, element := range elements {
+		vars = append(vars, jsonText(element))
+	}
+	return clause.Expr{SQL: "json_insert(?" + strings.Repeat(", '$[#]', json(?)", len(elements)) + ")", Vars: vars}
+}
+
+func (sqliteJsonMerge) literal(value any) clause.Expr {
+	return clause.Expr{SQL: "json(?)", Vars: []any{jsonText(value)}}
+}
@@ -0,0 +1,135 @@
+package gormquery
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type testJsonRecord struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Meta string `json:"meta"`
+}
+
+// SQL and vars of expr, with nested expressions expanded
+func testExprSql(db *gorm.DB, expr clause.Expr) (string, []any) {
+	stmt := &gorm.Statement{DB: db, Clauses: map[string]clause.Clause{}}
+	stmt.AddVar(stmt, expr)
+	return stmt.SQL.String(), stmt.Vars
+}
+
+func TestCompileJsonMerge(t *testing.T) {
+	db := newTestDb(t)
+	// removed "a", merged "b" and appended "d"
+	patch := map[string]any{"a": nil, "b": map[string]any{"c": 1}, "d": map[string]any{JsonAppend: []any{"x"}}}
+	objectPaths := []any{"$", "$", `$."a"`, `$."b"`, `$."b"`, `$."b"`, `$."c"`, "1", `$."d"`, `$."d"`, `$."d"`}
+	for _, golden := range []struct {
+		dialect string
+		sql     string
+		vars    []any
+	}{
+		{
+			dialect: "postgres",
+			sql: `(((CASE WHEN jsonb_typeof(CAST(meta AS jsonb)) = 'object' THEN CAST(meta AS jsonb) ELSE '{}'::jsonb END) - CAST(? AS text)) || jsonb_build_object(` +
+				`CAST(? AS text), ((CASE WHEN jsonb_typeof(jsonb_extract_path(CAST(meta AS jsonb), ?)) = 'object' THEN jsonb_extract_path(CAST(meta AS jsonb), ?) ELSE '{}'::jsonb END) || jsonb_build_object(CAST(? AS text), CAST(? AS jsonb))), ` +
+				`CAST(? AS text), ((CASE WHEN jsonb_typeof(jsonb_extract_path(CAST(meta AS jsonb), ?)) = 'array' THEN jsonb_extract_path(CAST(meta AS jsonb), ?) ELSE '[]'::jsonb END) || CAST(? AS jsonb))))`,
+			vars: []any{"a", "b", "b", "b", "c", "1", "d", "d", "d", `["x"]`},
+		},
+		{
+			dialect: "mysql",
+			sql: `JSON_SET(JSON_REMOVE((CASE WHEN JSON_TYPE(JSON_EXTRACT(meta, ?)) = 'OBJECT' THEN JSON_EXTRACT(meta, ?) ELSE JSON_OBJECT() END), ?), ` +
+				`?, JSON_SET((CASE WHEN JSON_TYPE(JSON_EXTRACT(meta, ?)) = 'OBJECT' THEN JSON_EXTRACT(meta, ?) ELSE JSON_OBJECT() END), ?, CAST(? AS JSON)), ` +
+				`?, JSON_MERGE_PRESERVE((CASE WHEN JSON_TYPE(JSON_EXTRACT(meta, ?)) = 'ARRAY' THEN JSON_EXTRACT(meta, ?) ELSE JSON_ARRAY() END), CAST(? AS JSON)))`,
+			vars: append(append([]any{}, objectPaths...), `["x"]`),
+		},
+		{
+			dialect: "sqlite",
+			sql: `json_set(json_remove((CASE WHEN json_type(meta, ?) = 'object' THEN json_extract(meta, ?) ELSE json_object() END), ?), ` +
+				`?, json(json_set((CASE WHEN json_type(meta, ?) = 'object' THEN json_extract(meta, ?) ELSE json_object() END), ?, json(json(?)))), ` +
+				`?, json(json_insert((CASE WHEN json_type(meta, ?) = 'array' THEN json_extract(meta, ?) ELSE json_array() END), '$[#]', json(?))))`,
+			vars: append(append([]any{}, objectPaths...), `"x"`),
+		},
+	} {
+		expr, err := compileJsonMerge(jsonMergeDialects[golden.dialect], "meta", nil, patch)
+		expectNoError(t, err)
+		sql, vars := testExprSql(db, expr)
+		expectEqual(t, "sql of "+golden.dialect, golden.sql, sql)
+		expectEqual(t, "vars of "+golden.dialect, golden.vars, vars)
+	}
+
+	for description, invalidPatch := range map[string]map[string]any{
+		"key with double quote":      {`a"b`: 1},
+		"removed key with backslash": {`a\b`: nil},
+		"nested key":                 {"a": map[string]any{`"`: nil}},
+		"$append with other keys":    {"a": map[string]any{JsonAppend: []any{1}, "b": 1}},
+	} {
+		_, err := compileJsonMerge(sqliteJsonMerge{}, "meta", nil, invalidPatch)
+		expect(t, description+" is rejected", err != nil)
+	}
+}
+
+// merge patch Update of record "r" of meta, and the resulting meta
+func testJsonMergeUpdate(t *testing.T, meta string, patch skmap.Map) (merged map[string]any) {
+	t.Helper()
+	db := newTestDb(t)
+	expectNoError(t, db.AutoMigrate(&testJsonRecord{}))
+	expectNoError(t, db.Create(&[]testJsonRecord{{Name: "r", Meta: meta}, {Name: "other", Meta: meta}}).Error)
+	server := newTestServer(db, ModelClass{
+		Model:             testJsonRecord{},
+		WhitelistedFields: skmap.Map{"id": true, "name": true, "meta": skmap.Map{"isJsonField": true}},
+	})
+	_, err := server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "r"}, "jsonMerge": true, "data": skmap.Map{"meta": patch}}))
+	expectNoError(t, err)
+	records := []testJsonRecord{}
+	expectNoError(t, db.Order("id").Find(&records).Error)
+	expectEqual(t, "meta of other record", meta, records[1].Meta)
+	expectNoError(t, json.Unmarshal([]byte(records[0].Meta), &merged))
+	return
+}
+
+func TestJsonMergeSqlite(t *testing.T) {
+	meta := `{"views": 10, "draft": true, "author": {"name": "a", "age": 3}, "labels": ["a"], "tags": ["t"]}`
+
+	merged := testJsonMergeUpdate(t, meta, skmap.Map{"draft": nil, "missing": nil})
+	expectEqual(t, "meta of remove", map[string]any{"views": float64(10), "author": map[string]any{"name": "a", "age": float64(3)}, "labels": []any{"a"}, "tags": []any{"t"}}, merged)
+
+	merged = testJsonMergeUpdate(t, meta, skmap.Map{"author": skmap.Map{"name": "b", "age": nil, "links": skmap.Map{"web": "w"}}, "tags": skmap.Map{"k": 1}})
+	expectEqual[any](t, "author of nested merge", map[string]any{"name": "b", "links": map[string]any{"web": "w"}}, merged["author"])
+	expectEqual[any](t, "tags replaced by an object", map[string]any{"k": float64(1)}, merged["tags"])
+	expectEqual[any](t, "views of nested merge", float64(10), merged["views"])
+
+	merged = testJsonMergeUpdate(t, meta, skmap.Map{
+		"labels":  skmap.Map{JsonAppend: []any{"b", skmap.Map{"c": 1}}},
+		"history": skmap.Map{JsonAppend: "h"},
+		"views":   11,
+		"title":   "x",
+	})
+	expectEqual[any](t, "labels of append", []any{"a", "b", map[string]any{"c": float64(1)}}, merged["labels"])
+	expectEqual[any](t, "history of append to missing array", []any{"h"}, merged["history"])
+	expectEqual[any](t, "views of set", float64(11), merged["views"])
+	expectEqual[any](t, "title of set", "x", merged["title"])
+
+	// a column which is not an object is merged as an empty object
+	merged = testJsonMergeUpdate(t, `[1]`, skmap.Map{"a": skmap.Map{"b": true}})
+	expectEqual(t, "meta of array", map[string]any{"a": map[string]any{"b": true}}, merged)
+}
+
+func TestJsonMergeInvalid(t *testing.T) {
+	db := newTestDb(t)
+	expectNoError(t, db.AutoMigrate(&testJsonRecord{}))
+	server := newTestServer(db, ModelClass{
+		Model:             testJsonRecord{},
+		WhitelistedFields: skmap.Map{"id": true, "name": true, "meta": skmap.Map{"isJsonField": true}},
+	})
+	_, err := server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "r"}, "jsonMerge": true, "data": skmap.Map{"meta": skmap.Map{`a"b`: nil}}}))
+	expectCode(t, "Update of invalid key", codes.InvalidArgument, err)
+
+	modelClass := server.ModelClasses["item"]
+	err = modelClass.applyJsonMerge("sqlserver", skmap.Hash{"meta": map[string]any{"a": 1}})
+	expectCode(t, "json merge of sqlserver", codes.Unimplemented, err)
+}
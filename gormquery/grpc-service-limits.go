@@ -0,0 +1,195 @@
+package gormquery
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+Query guardrails of a model class. Zero value means unlimited.
+
+Example
+
+	"item": {
+		Model:  postgres.Item{},
+		CanGet: true,
+		Limits: gormquery.QueryLimits{
+			DefaultPageSize:  20,
+			MaxPageSize:      500,
+			MaxFilterDepth:   3,
+			MaxInListLength:  1000,
+			MaxRelations:     2,
+			StatementTimeout: 5 * time.Second,
+		},
+	},
+*/
+type QueryLimits struct {
+	// page size applied when "limit" is 0. MaxPageSize would be used if it is not provided
+	DefaultPageSize int
+	// "limit" above it is rejected with ResourceExhausted
+	MaxPageSize int
+	// nesting level of "filter", the filter map itself counts as 1
+	MaxFilterDepth int
+	// length of any array value in "filter"
+	MaxInListLength int
+	// number of distinct relations of a query, selected in "fields", filtered in "filter" or scoped in "relations"
+	MaxRelations int
+	// deadline of database statements of a request
+	StatementTimeout time.Duration
+}
+
+func (l QueryLimits) pageSize(limit int) (pageSize int, err error) {
+	if l.MaxPageSize > 0 && limit > l.MaxPageSize {
+		err = status.Errorf(codes.ResourceExhausted, "limit %d exceeds max page size %d", limit, l.MaxPageSize)
+		return
+	}
+	pageSize = limit
+	if pageSize == 0 {
+		pageSize = l.DefaultPageSize
+	}
+	if pageSize == 0 {
+		pageSize = l.MaxPageSize
+	}
+	return
+}
+
+func (l QueryLimits) checkFilter(filter skmap.Map) (err error) {
+	if filter == nil {
+		return
+	}
+	if l.MaxFilterDepth > 0 {
+		depth := valueDepth(map[string]any(filter))
+		if depth > l.MaxFilterDepth {
+			return status.Errorf(codes.InvalidArgument, "filter depth %d exceeds %d", depth, l.MaxFilterDepth)
+		}
+	}
+	if l.MaxInListLength > 0 {
+		length := maxArrayLength(map[string]any(filter))
+		if length > l.MaxInListLength {
+			return status.Errorf(codes.ResourceExhausted, "filter list length %d exceeds %d", length, l.MaxInListLength)
+		}
+	}
+	return
+}
+
+func (l QueryLimits) checkRelations(relations map[string]bool) (err error) {
+	if l.MaxRelations <= 0 {
+		return
+	}
+	if len(relations) > l.MaxRelations {
+		return status.Errorf(codes.ResourceExhausted, "%d relations exceed %d", len(relations), l.MaxRelations)
+	}
+	return
+}
+
+/*
+Relations of a query, counted by QueryLimits.MaxRelations
+
+Fields and filter keys are matched against Relations like ApplyFields does, by the exact relation name
+(the whole relation) or its "relation." prefix. Filter alternatives of "$or" are included.
+*/
+func (mc *ModelClass) queryRelations(fields []string, filter skmap.Map, scopes map[string]relationScope) (relations map[string]bool) {
+	relations = map[string]bool{}
+	for _, field := range fields {
+		mc.addRelationOf(relations, field)
+	}
+	mc.addFilterRelations(relations, filter)
+	for name := range scopes {
+		relations[name] = true
+	}
+	return
+}
+
+func (mc *ModelClass) addFilterRelations(relations map[string]bool, filter map[string]any) {
+	for field, value := range filter {
+		if field != FilterOr {
+			mc.addRelationOf(relations, field)
+			continue
+		}
+		alternatives, _ := value.([]any)
+		for _, alternative := range alternatives {
+			if alternativeFilter, ok := alternative.(map[string]any); ok {
+				mc.addFilterRelations(relations, alternativeFilter)
+			}
+		}
+	}
+}
+
+func (mc *ModelClass) addRelationOf(relations map[string]bool, field string) {
+	for relation := range mc.Relations {
+		if field == relation || strings.HasPrefix(field, relation+".") {
+			relations[relation] = true
+			return
+		}
+	}
+}
+
+func (l QueryLimits) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.StatementTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, l.StatementTimeout)
+}
+
+// convert error caused by statement timeout to DeadlineExceeded
+func timeoutError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	if _, ok := status.FromError(err); ok && status.Code(err) != codes.Unknown {
+		return err
+	}
+	return status.Error(codes.DeadlineExceeded, "statement timeout")
+}
+
+func valueDepth(value any) (depth int) {
+	switch value := value.(type) {
+	case map[string]any:
+		return 1 + maxDepth(mapValues(value))
+	case skmap.Map:
+		return 1 + maxDepth(mapValues(value))
+	case []any:
+		return 1 + maxDepth(value)
+	}
+	return 0
+}
+
+func maxDepth(values []any) (depth int) {
+	for _, value := range values {
+		if d := valueDepth(value); d > depth {
+			depth = d
+		}
+	}
+	return
+}
+
+func maxArrayLength(value any) (length int) {
+	var children []any
+	switch value := value.(type) {
+	case map[string]any:
+		children = mapValues(value)
+	case skmap.Map:
+		children = mapValues(value)
+	case []any:
+		length = len(value)
+		children = value
+	}
+	for _, child := range children {
+		if l := maxArrayLength(child); l > length {
+			length = l
+		}
+	}
+	return
+}
+
+func mapValues(m map[string]any) (values []any) {
+	for _, value := range m {
+		values = append(values, value)
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package gormquery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+)
+
+func TestQueryLimitsPageSize(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{Limits: QueryLimits{DefaultPageSize: 1, MaxPageSize: 2}})
+
+	response, err := server.Get(testCtx, optionRequest(skmap.Map{}))
+	expectNoError(t, err)
+	expectEqual(t, "results of default page size", 1, len(decodeResults[testItem](t, response.Results)))
+	expectEqual(t, "total count", uint64(3), response.TotalCount)
+
+	response, err = server.Get(testCtx, optionRequest(skmap.Map{"limit": 2}))
+	expectNoError(t, err)
+	expectEqual(t, "results of max page size", 2, len(decodeResults[testItem](t, response.Results)))
+
+	_, err = server.Get(testCtx, optionRequest(skmap.Map{"limit": 3}))
+	expectCode(t, "limit above max page size", codes.ResourceExhausted, err)
+}
+
+func TestQueryLimitsFilter(t *testing.T) {
+	limits := QueryLimits{MaxFilterDepth: 2, MaxInListLength: 2}
+	expectNoError(t, limits.checkFilter(skmap.Map{"name": []any{"a", "b"}}))
+	expectCode(t, "long in list", codes.ResourceExhausted, limits.checkFilter(skmap.Map{"name": []any{"a", "b", "c"}}))
+	expectCode(t, "long nested in list", codes.ResourceExhausted, QueryLimits{MaxInListLength: 2}.checkFilter(skmap.Map{"name": map[string]any{"in": []any{"a", "b", "c"}}}))
+	expectNoError(t, limits.checkFilter(skmap.Map{"price": map[string]any{"gt": 1}}))
+	expectCode(t, "deep filter", codes.InvalidArgument, limits.checkFilter(skmap.Map{"price": map[string]any{"in": []any{1}}}))
+	expectNoError(t, QueryLimits{}.checkFilter(skmap.Map{"name": []any{"a", "b", "c"}}))
+}
+
+func TestQueryLimitsRelations(t *testing.T) {
+	modelClass := ModelClass{Relations: map[string]ModelRelation{"category": {}, "comments": {}}}
+	relations := func(fields []string, filter skmap.Map, scopes map[string]relationScope) []string {
+		names := []string{}
+		for _, name := range []string{"category", "comments"} {
+			if modelClass.queryRelations(fields, filter, scopes)[name] {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	expectEqual(t, "relations of sub-fields", []string{"category"}, relations([]string{"id", "category.name", "category.id"}, nil, nil))
+	expectEqual(t, "relations of whole relations", []string{"category", "comments"}, relations([]string{"category", "comments"}, nil, nil))
+	expectEqual(t, "relations of filter", []string{"category", "comments"}, relations(nil, skmap.Map{
+		"category.name": "x",
+		FilterOr:        []any{map[string]any{"comments.body": "good"}},
+	}, nil))
+	expectEqual(t, "relations of scopes", []string{"comments"}, relations(nil, nil, map[string]relationScope{"comments": {}}))
+	expectEqual(t, "fields of other names", []string{}, relations([]string{"categoryName", "comment.body"}, nil, nil))
+
+	limits := QueryLimits{MaxRelations: 1}
+	expectNoError(t, limits.checkRelations(map[string]bool{"category": true}))
+	expectCode(t, "2 relations", codes.ResourceExhausted, limits.checkRelations(map[string]bool{"category": true, "comments": true}))
+}
+
+func TestQueryLimitsRelationsGet(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestRelationServer(db, ModelClass{Limits: QueryLimits{MaxRelations: 1}})
+
+	_, err := server.Get(testCtx, optionRequest(skmap.Map{"fields": []string{"id", "category"}}))
+	expectNoError(t, err)
+	_, err = server.Get(testCtx, optionRequest(skmap.Map{"fields": []string{"category", "comments"}}))
+	expectCode(t, "whole relations", codes.ResourceExhausted, err)
+	_, err = server.GetOne(testCtx, optionRequest(skmap.Map{"id": 1, "fields": []string{"category", "comments"}}))
+	expectCode(t, "whole relations of GetOne", codes.ResourceExhausted, err)
+	_, err = server.Get(testCtx, optionRequest(skmap.Map{"fields": []string{"category.name"}, "relations": skmap.Map{"comments": skmap.Map{"limit": 1}}}))
+	expectCode(t, "relation of scope", codes.ResourceExhausted, err)
+}
+
+func TestQueryLimitsTimeout(t *testing.T) {
+	limits := QueryLimits{StatementTimeout: time.Millisecond}
+	ctx, cancel := limits.withTimeout(testCtx)
+	defer cancel()
+	<-ctx.Done()
+	expectCode(t, "error after statement timeout", codes.DeadlineExceeded, timeoutError(ctx, errors.New("interrupted")))
+	expectNoError(t, timeoutError(ctx, nil))
+
+	ctx, cancel = QueryLimits{}.withTimeout(testCtx)
+	cancel()
+	err := errors.New("canceled")
+	expectEqual(t, "error of canceled context", err, timeoutError(ctx, err))
+	expectEqual(t, "deadline of unlimited", false, hasDeadline(ctx))
+}
+
+func hasDeadline(ctx context.Context) bool {
+	_, ok := ctx.Deadline()
+	return ok
+}
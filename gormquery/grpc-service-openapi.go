@@ -0,0 +1,484 @@
+package gormquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type OpenAPIConfig struct {
+	// title of the document, "QueryService" by default
+	Title string
+	// version of the document, "1.0.0" by default
+	Version string
+	// URL of the REST gateway, e.g. "/query"
+	ServerUrl string
+	// model classes exposed by the REST gateway, all model classes if it is not provided
+	ModelClasses []string
+}
+
+/*
+Generate an OpenAPI 3 document of the REST gateway (ref: gormqueryhttp.Gateway) from ModelClasses
+
+Each model class has the path "/{modelClass}", with operations allowed by CanGet / CanCreate / CanUpdate / CanDelete.
+Schemas are derived from gORM models by their JSON names, with relations of ModelClass.Relations
+and virtual fields. Filterable fields are WhitelistedFields, and sortable fields are columns and
+virtual fields with Expression. Operations limited by ModelClass.RateLimits have the 429 response
+if RateLimiter is set.
+
+Example
+
+	document, err := queryServiceServer.OpenAPI(gormquery.OpenAPIConfig{Title: "Item API", ServerUrl: "/query"})
+	documentBytes, err := json.Marshal(document)
+*/
+func (q *QueryServiceServer) OpenAPI(config OpenAPIConfig) (document skmap.Map, err error) {
+	title := config.Title
+	if title == "" {
+		title = "QueryService"
+	}
+	version := config.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+	modelClassNames := config.ModelClasses
+	if len(modelClassNames) == 0 {
+		for name := range q.ModelClasses {
+			modelClassNames = append(modelClassNames, name)
+		}
+	}
+	sort.Strings(modelClassNames)
+	g := &openAPIGenerator{schemas: skmap.Map{
+		"Error": skmap.Map{
+			"type": "object",
+			"properties": skmap.Map{
+				"code":    skmap.Map{"type": "string"},
+				"message": skmap.Map{"type": "string"},
+			},
+		},
+		"Success": skmap.Map{
+			"type": "object",
+			"properties": skmap.Map{
+				"code":    skmap.Map{"type": "integer"},
+				"message": skmap.Map{"type": "string"},
+			},
+		},
+	}}
+	paths := skmap.Map{}
+	for _, name := range modelClassNames {
+		modelClass, ok := q.ModelClasses[name]
+		if !ok {
+			err = fmt.Errorf("invalid model class %s", name)
+			return
+		}
+		db := modelClass.Db
+		if db == nil {
+			db = q.DefaultDb
+		}
+		var pathItem skmap.Map
+		pathItem, err = g.pathItem(db, name, modelClass, q.Idempotency != nil, q.RateLimiter != nil)
+		if err != nil {
+			return
+		}
+		paths["/"+name] = pathItem
+	}
+	document = skmap.Map{
+		"openapi": "3.0.3",
+		"info": skmap.Map{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+		"components": skmap.Map{
+			"schemas": g.schemas,
+		},
+	}
+	if config.ServerUrl != "" {
+		document["servers"] = []skmap.Map{{"url": config.ServerUrl}}
+	}
+	return
+}
+
+type openAPIGenerator struct {
+	schemas skmap.Map
+}
+
+func schemaRef(name string) skmap.Map {
+	return skmap.Map{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema skmap.Map) skmap.Map {
+	return skmap.Map{"application/json": skmap.Map{"schema": schema}}
+}
+
+// gORM schema of model, with naming strategy of db if it is provided
+func (g *openAPIGenerator) parse(db *gorm.DB, model any) (modelSchema *schema.Schema, err error) {
+	if db != nil {
+		return schemaOf(db, model)
+	}
+	return schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+}
+
+func (g *openAPIGenerator) pathItem(db *gorm.DB, name string, modelClass ModelClass, idempotency bool, rateLimited bool) (pathItem skmap.Map, err error) {
+	modelSchema, err := g.parse(db, modelClass.Model)
+	if err != nil {
+		return
+	}
+	recordSchemaName := g.addRecordSchema(name, modelSchema, modelClass)
+	filterSchemaName := g.addFilterSchema(name, modelSchema, modelClass)
+	errorResponses := func(operation string, responses skmap.Map) skmap.Map {
+		for _, statusCode := range []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError} {
+			responses[fmt.Sprint(statusCode)] = skmap.Map{
+				"description": http.StatusText(statusCode),
+				"content":     jsonContent(schemaRef("Error")),
+			}
+		}
+		if _, ok := modelClass.RateLimits[operation]; ok && rateLimited {
+			responses[fmt.Sprint(http.StatusTooManyRequests)] = skmap.Map{
+				"description": http.StatusText(http.StatusTooManyRequests),
+				"headers": skmap.Map{
+					"Retry-After": skmap.Map{"description": "seconds to wait", "schema": skmap.Map{"type": "integer"}},
+				},
+				"content": jsonContent(schemaRef("Error")),
+			}
+		}
+		return responses
+	}
+	filterParameter := func(required bool) skmap.Map {
+		return skmap.Map{
+			"name":     "filter",
+			"in":       "query",
+			"required": required,
+			"content":  jsonContent(schemaRef(filterSchemaName)),
+		}
+	}
+	success := skmap.Map{
+		"description": "Success",
+		"content":     jsonContent(schemaRef("Success")),
+	}
+	pathItem = skmap.Map{}
+	if modelClass.CanGet {
+		parameters := []skmap.Map{
+			{
+				"name":        "field",
+				"in":          "query",
+				"description": "selected fields, comma-separated: " + strings.Join(g.selectableFields(modelSchema, modelClass), ", "),
+				"schema":      skmap.Map{"type": "string"},
+			},
+			{"name": "page", "in": "query", "description": "page number, from 0", "schema": skmap.Map{"type": "integer", "minimum": 0}},
+			{"name": "limit", "in": "query", "description": "page size", "schema": skmap.Map{"type": "integer", "minimum": 0}},
+			{"name": "cursor", "in": "query", "description": "keyset pagination instead of page, empty for the first page", "schema": skmap.Map{"type": "string"}},
+			{"name": "keyword", "in": "query", "schema": skmap.Map{"type": "string"}},
+			{"name": "facets", "in": "query", "description": "fields to count records by distinct values, comma-separated", "schema": skmap.Map{"type": "string"}},
+			{
+				"name":    "sort",
+				"in":      "query",
+				"content": jsonContent(g.sortSchema(modelSchema, modelClass)),
+			},
+			filterParameter(false),
+		}
+		if len(modelClass.Relations) > 0 {
+			parameters = append(parameters, skmap.Map{
+				"name":        "relations",
+				"in":          "query",
+				"description": "limit, sort and filter of relations",
+				"content":     jsonContent(g.relationsSchema(modelClass)),
+			})
+		}
+		pathItem["get"] = skmap.Map{
+			"operationId": "get" + exportedName(name),
+			"tags":        []string{name},
+			"parameters":  parameters,
+			"responses": errorResponses(OperationGet, skmap.Map{
+				"200": skmap.Map{
+					"description": "Success",
+					"content": jsonContent(skmap.Map{
+						"type": "object",
+						"properties": skmap.Map{
+							"results":    skmap.Map{"type": "array", "items": schemaRef(recordSchemaName)},
+							"totalCount": skmap.Map{"type": "integer"},
+							"nextCursor": skmap.Map{"type": "string"},
+							"facets": skmap.Map{
+								"type": "object",
+								"additionalProperties": skmap.Map{
+									"type": "array",
+									"items": skmap.Map{
+										"type":       "object",
+										"properties": skmap.Map{"value": skmap.Map{}, "count": skmap.Map{"type": "integer"}},
+									},
+								},
+							},
+						},
+					}),
+				},
+			}),
+		}
+	}
+	if modelClass.CanCreate {
+		operation := skmap.Map{
+			"operationId": "create" + exportedName(name),
+			"tags":        []string{name},
+			"requestBody": skmap.Map{
+				"required": true,
+				"content":  jsonContent(schemaRef(recordSchemaName)),
+			},
+			"responses": errorResponses(OperationCreate, skmap.Map{
+				"201": skmap.Map{
+					"description": "Created",
+					"content":     jsonContent(schemaRef(recordSchemaName)),
+				},
+			}),
+		}
+		if idempotency {
+			operation["parameters"] = []skmap.Map{idempotencyKeyParameter()}
+		}
+		pathItem["post"] = operation
+	}
+	if modelClass.CanUpdate {
+		parameters := []skmap.Map{filterParameter(true)}
+		if idempotency {
+			parameters = append(parameters, idempotencyKeyParameter())
+		}
+		pathItem["patch"] = skmap.Map{
+			"operationId": "update" + exportedName(name),
+			"tags":        []string{name},
+			"parameters":  parameters,
+			"requestBody": skmap.Map{
+				"required": true,
+				"content":  jsonContent(schemaRef(recordSchemaName)),
+			},
+			"responses": errorResponses(OperationUpdate, skmap.Map{"200": success}),
+		}
+	}
+	if modelClass.CanDelete {
+		pathItem["delete"] = skmap.Map{
+			"operationId": "delete" + exportedName(name),
+			"tags":        []string{name},
+			"parameters":  []skmap.Map{filterParameter(true)},
+			"responses":   errorResponses(OperationDelete, skmap.Map{"200": success}),
+		}
+	}
+	return
+}
+
+// header of gormqueryhttp.IdempotencyKeyHeader, for POST and PATCH
+func idempotencyKeyParameter() skmap.Map {
+	return skmap.Map{
+		"name":   "Idempotency-Key",
+		"in":     "header",
+		"schema": skmap.Map{"type": "string"},
+	}
+}
+
+// schema of option "relations", by relation names
+func (g *openAPIGenerator) relationsSchema(modelClass ModelClass) skmap.Map {
+	properties := skmap.Map{}
+	for name := range modelClass.Relations {
+		properties[name] = skmap.Map{
+			"type": "object",
+			"properties": skmap.Map{
+				"limit":  skmap.Map{"type": "integer", "minimum": 0},
+				"sort":   skmap.Map{"type": "object", "additionalProperties": skmap.Map{"type": "string", "enum": []string{"ASC", "DESC"}}},
+				"filter": skmap.Map{"type": "object"},
+			},
+		}
+	}
+	return skmap.Map{"type": "object", "properties": properties}
+}
+
+// e.g. "itemTag" to "ItemTag"
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// schema of a related gORM model with all its relations, named by its Go type
+func (g *openAPIGenerator) addModelSchema(modelSchema *schema.Schema) {
+	properties := skmap.Map{}
+	g.schemas[modelSchema.Name] = skmap.Map{"type": "object", "properties": properties}
+	relationFields := map[string]bool{}
+	for _, relationship := range modelSchema.Relationships.Relations {
+		relationFields[relationship.Field.Name] = true
+		if jsonName := propertyNameOf(relationship.Field); jsonName != "" {
+			properties[jsonName] = g.relationSchema(relationship)
+		}
+	}
+	for _, field := range modelSchema.Fields {
+		if relationFields[field.Name] || field.DBName == "" {
+			continue
+		}
+		if jsonName := propertyNameOf(field); jsonName != "" {
+			properties[jsonName] = typeSchema(field.FieldType)
+		}
+	}
+}
+
+func (g *openAPIGenerator) relationSchema(relationship *schema.Relationship) skmap.Map {
+	if _, ok := g.schemas[relationship.FieldSchema.Name]; !ok {
+		g.addModelSchema(relationship.FieldSchema)
+	}
+	related := schemaRef(relationship.FieldSchema.Name)
+	switch relationship.Type {
+	case schema.HasMany, schema.Many2Many:
+		return skmap.Map{"type": "array", "items": related}
+	}
+	return related
+}
+
+// schema of records of a model class, with relations of ModelClass.Relations, field aliases and virtual fields
+func (g *openAPIGenerator) addRecordSchema(name string, modelSchema *schema.Schema, modelClass ModelClass) (schemaName string) {
+	schemaName = exportedName(name) + "Record"
+	properties := skmap.Map{}
+	relationFields := map[string]bool{}
+	for _, relationship := range modelSchema.Relationships.Relations {
+		relationFields[relationship.Field.Name] = true
+	}
+	for _, field := range modelSchema.Fields {
+		if relationFields[field.Name] || field.DBName == "" {
+			continue
+		}
+		if propertyNameOf(field) != "" {
+			properties[modelClass.resultKey(modelSchema, field.DBName)] = typeSchema(field.FieldType)
+		}
+	}
+	for relationName, relation := range modelClass.Relations {
+		relationship, ok := modelSchema.Relationships.Relations[relation.association(relationName)]
+		if !ok {
+			continue
+		}
+		if jsonName := propertyNameOf(relationship.Field); jsonName != "" {
+			properties[jsonName] = g.relationSchema(relationship)
+		}
+	}
+	for virtualName := range modelClass.VirtualFields {
+		properties[virtualName] = skmap.Map{"readOnly": true, "description": "virtual field"}
+	}
+	g.schemas[schemaName] = skmap.Map{"type": "object", "properties": properties}
+	return
+}
+
+// schema of filter of a model class, with operators of FilterOperators and "$or" alternatives
+func (g *openAPIGenerator) addFilterSchema(name string, modelSchema *schema.Schema, modelClass ModelClass) (schemaName string) {
+	schemaName = exportedName(name) + "Filter"
+	properties := skmap.Map{}
+	for field := range modelClass.WhitelistedFields {
+		if modelClass.WhitelistedFields.GetBoolDefault(fmt.Sprintf("%s.isJsonField", field), false) {
+			properties[field] = skmap.Map{
+				"type":        "array",
+				"items":       skmap.Map{"type": "string"},
+				"description": "key-value pairs of JSON field",
+			}
+			continue
+		}
+		valueSchema := skmap.Map{}
+		if schemaField := modelSchema.LookUpField(modelClass.column(field)); schemaField != nil {
+			valueSchema = typeSchema(schemaField.FieldType)
+		}
+		operators := skmap.Map{}
+		for operator := range FilterOperators {
+			switch operator {
+			case "in", "nin":
+				operators[operator] = skmap.Map{"type": "array", "items": valueSchema}
+			case "like":
+				operators[operator] = skmap.Map{"type": "string"}
+			case "null":
+				operators[operator] = skmap.Map{"type": "boolean"}
+			default:
+				operators[operator] = valueSchema
+			}
+		}
+		properties[field] = skmap.Map{"anyOf": []skmap.Map{
+			valueSchema,
+			{"type": "array", "items": valueSchema},
+			{"type": "object", "properties": operators, "additionalProperties": false},
+		}}
+	}
+	properties[FilterOr] = skmap.Map{"type": "array", "items": schemaRef(schemaName)}
+	g.schemas[schemaName] = skmap.Map{"type": "object", "properties": properties}
+	return
+}
+
+func (g *openAPIGenerator) sortSchema(modelSchema *schema.Schema, modelClass ModelClass) skmap.Map {
+	properties := skmap.Map{}
+	direction := skmap.Map{"type": "string", "enum": []string{"ASC", "DESC"}}
+	for _, field := range modelSchema.Fields {
+		if field.DBName != "" {
+			properties[modelClass.apiField(field.DBName)] = direction
+		}
+	}
+	for name, virtualField := range modelClass.VirtualFields {
+		if virtualField.Expression != "" {
+			properties[name] = direction
+		}
+	}
+	return skmap.Map{"type": "object", "properties": properties}
+}
+
+func (g *openAPIGenerator) selectableFields(modelSchema *schema.Schema, modelClass ModelClass) (fields []string) {
+	for _, field := range modelSchema.Fields {
+		if field.DBName != "" {
+			fields = append(fields, modelClass.apiField(field.DBName))
+		}
+	}
+	for name := range modelClass.Relations {
+		fields = append(fields, name, name+".*")
+	}
+	for name := range modelClass.VirtualFields {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return
+}
+
+// schema of a Go type of column
+func typeSchema(t reflect.Type) skmap.Map {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+	valueSchema := skmap.Map{}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		valueSchema = skmap.Map{"type": "string", "format": "date-time"}
+	case t.Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()) || reflect.PointerTo(t).Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()):
+		// any JSON value, e.g. datatypes.JSON
+	default:
+		switch t.Kind() {
+		case reflect.Bool:
+			valueSchema = skmap.Map{"type": "boolean"}
+		case reflect.Int8, reflect.Int16, reflect.Int32:
+			valueSchema = skmap.Map{"type": "integer", "format": "int32"}
+		case reflect.Int, reflect.Int64:
+			valueSchema = skmap.Map{"type": "integer", "format": "int64"}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			valueSchema = skmap.Map{"type": "integer", "minimum": 0}
+		case reflect.Float32, reflect.Float64:
+			valueSchema = skmap.Map{"type": "number"}
+		case reflect.String:
+			valueSchema = skmap.Map{"type": "string"}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				valueSchema = skmap.Map{"type": "string"}
+			} else {
+				valueSchema = skmap.Map{"type": "array", "items": typeSchema(t.Elem())}
+			}
+		case reflect.Map, reflect.Struct:
+			valueSchema = skmap.Map{"type": "object"}
+		}
+	}
+	if nullable {
+		valueSchema["nullable"] = true
+	}
+	return valueSchema
+}
@@ -0,0 +1,96 @@
+package gormquery
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+)
+
+// OpenAPI document of server, decoded from JSON
+func testOpenAPIDocument(t *testing.T, server *QueryServiceServer, config OpenAPIConfig) (document skmap.Map) {
+	t.Helper()
+	generated, err := server.OpenAPI(config)
+	expectNoError(t, err)
+	documentBytes, err := json.Marshal(generated)
+	expectNoError(t, err)
+	expectNoError(t, json.Unmarshal(documentBytes, &document))
+	return
+}
+
+// names of parameters of operation
+func testParameterNames(document skmap.Map, operation string) (names []string) {
+	parameters, _ := document.GetDefault(operation+".parameters", nil).([]any)
+	for _, parameter := range parameters {
+		names = append(names, skmap.Map(parameter.(map[string]any)).GetStringDefault("name", ""))
+	}
+	return
+}
+
+func TestOpenAPI(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestRelationServer(db, ModelClass{
+		VirtualFields: testVirtualFields,
+		RateLimits:    map[string]RateLimit{OperationCreate: {Rate: 1, Burst: 1}},
+	})
+	server.Idempotency = &IdempotencyConfig{}
+	server.RateLimiter = NewMemoryRateLimiter()
+	document := testOpenAPIDocument(t, server, OpenAPIConfig{Title: "Item API", ServerUrl: "/query"})
+	expectEqual[any](t, "title", "Item API", document.GetDefault("info.title", nil))
+	expectEqual[any](t, "server url", "/query", document.GetDefault("servers", []any{}).([]any)[0].(map[string]any)["url"])
+
+	operations := document.GetMapDefault("paths./item", nil)
+	expect(t, "operations", operations["get"] != nil && operations["post"] != nil && operations["patch"] != nil && operations["delete"] != nil)
+	expectEqual(t, "operation id", "getItem", document.GetStringDefault("paths./item.get.operationId", ""))
+	expectEqual(t, "parameters of post", []string{"Idempotency-Key"}, testParameterNames(document, "paths./item.post"))
+	expectEqual(t, "parameters of patch", []string{"filter", "Idempotency-Key"}, testParameterNames(document, "paths./item.patch"))
+	expectEqual(t, "parameters of delete", []string{"filter"}, testParameterNames(document, "paths./item.delete"))
+	expectEqual(t, "parameters of get", []string{"field", "page", "limit", "cursor", "keyword", "facets", "sort", "filter", "relations"}, testParameterNames(document, "paths./item.get"))
+	// 429 of rate limited operations only
+	expect(t, "429 of post", document.GetMapDefault("paths./item.post.responses.429.headers.Retry-After", nil) != nil)
+	expect(t, "no 429 of get", document.GetDefault("paths./item.get.responses.429", nil) == nil)
+
+	properties := document.GetMapDefault("components.schemas.ItemRecord.properties", nil)
+	expectEqual[any](t, "property of price", map[string]any{"type": "integer", "format": "int64"}, properties["price"])
+	expectEqual[any](t, "property of category", map[string]any{"$ref": "#/components/schemas/testCategory"}, properties["category"])
+	expectEqual[any](t, "property of comments", "array", skmap.Map(properties["comments"].(map[string]any)).GetStringDefault("type", ""))
+	expect(t, "property of virtual field", properties["double_price"] != nil && properties["label"] != nil)
+	expect(t, "schema of related model", document.GetMapDefault("components.schemas.testComment.properties.body", nil) != nil)
+
+	filterProperties := document.GetMapDefault("components.schemas.ItemFilter.properties", nil)
+	expect(t, "filter of whitelisted field", filterProperties["name"] != nil && filterProperties["category_id"] != nil)
+	expectEqual[any](t, "filter of $or", map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/ItemFilter"}}, filterProperties[FilterOr])
+
+	parameters := document.GetDefault("paths./item.get.parameters", nil).([]any)
+	for _, parameter := range parameters {
+		parameterMap := skmap.Map(parameter.(map[string]any))
+		if parameterMap.GetStringDefault("name", "") == "relations" {
+			relationProperties := parameterMap.GetMapDefault("content.application/json.schema.properties", nil)
+			expect(t, "relations of relations parameter", relationProperties["category"] != nil && relationProperties["comments"] != nil)
+		}
+		if parameterMap.GetStringDefault("name", "") != "sort" {
+			continue
+		}
+		sortProperties := parameterMap.GetMapDefault("content.application/json.schema.properties", nil)
+		expect(t, "sort of column and expression", sortProperties["price"] != nil && sortProperties["double_price"] != nil)
+		expect(t, "sort of computed virtual field", sortProperties["label"] == nil)
+	}
+}
+
+func TestOpenAPIPermissions(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	modelClass := server.ModelClasses["item"]
+	modelClass.CanCreate, modelClass.CanUpdate, modelClass.CanDelete = false, false, false
+	server.ModelClasses["item"] = modelClass
+	server.ModelClasses["category"] = ModelClass{Model: testCategory{}}
+	document := testOpenAPIDocument(t, server, OpenAPIConfig{ModelClasses: []string{"item"}})
+	expectEqual(t, "paths", 1, len(document.GetMapDefault("paths", nil)))
+	operations := document.GetMapDefault("paths./item", nil)
+	expect(t, "operations of CanGet only", operations["get"] != nil && len(operations) == 1)
+	expect(t, "no server url", document["servers"] == nil)
+	expectEqual(t, "parameters of get without relations", []string{"field", "page", "limit", "cursor", "keyword", "facets", "sort", "filter"}, testParameterNames(document, "paths./item.get"))
+
+	_, err := server.OpenAPI(OpenAPIConfig{ModelClasses: []string{"unknown"}})
+	expect(t, "unknown model class", err != nil)
+}
@@ -0,0 +1,182 @@
+package gormquery
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	OperationGet    = "get"
+	OperationGetOne = "getOne"
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+	OperationImport = "import"
+	OperationExport = "export"
+)
+
+// Token bucket of a caller: Burst tokens at most, refilled at Rate tokens per second
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+/*
+Rate limiter of QueryServiceServer
+
+Allow takes a token of the bucket of key, and returns the wait time until a token is
+available if the bucket is empty. A distributed backend, e.g. Redis, could implement it
+to share buckets among server instances.
+*/
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit RateLimit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+/*
+Caller identity of rate limits, the peer address
+
+The actor of gRPC metadata is not used, since any client could set it. See QueryServiceServer.TrustActorMetadata.
+*/
+func CallerFromContext(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	// port of a caller changes by connection
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// caller identity of rate limits and idempotency keys, by GetCaller, the trusted actor of gRPC metadata, or the peer address
+func (q *QueryServiceServer) callerOf(ctx context.Context) string {
+	if q.GetCaller != nil {
+		return q.GetCaller(ctx)
+	}
+	if q.TrustActorMetadata {
+		if actor := ActorFromContext(ctx); actor != "" {
+			return actor
+		}
+	}
+	return CallerFromContext(ctx)
+}
+
+type rateLimitSkipKey struct{}
+
+/*
+Check rate limit of operation on the model class
+
+Returns ResourceExhausted with RetryInfo details if the caller runs out of tokens.
+*/
+func (q *QueryServiceServer) checkRateLimit(ctx context.Context, modelClass ModelClass, operation string) (err error) {
+	if q.RateLimiter == nil {
+		return
+	}
+	limit, ok := modelClass.RateLimits[operation]
+	if !ok {
+		return
+	}
+	// pages of Export are limited by the export operation itself
+	if skip, _ := ctx.Value(rateLimitSkipKey{}).(bool); skip {
+		return
+	}
+	key := fmt.Sprintf("%s:%s:%s", modelClass.name, operation, q.callerOf(ctx))
+	allowed, retryAfter, err := q.RateLimiter.Allow(ctx, key, limit)
+	if err != nil || allowed {
+		return
+	}
+	st := status.Newf(codes.ResourceExhausted, "rate limit exceeded, retry after %s", retryAfter)
+	detailed, detailErr := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if detailErr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+/*
+In-memory token bucket RateLimiter, for a single server instance
+
+Example
+
+	queryServiceServer := gormquery.QueryServiceServer{
+		...
+		RateLimiter: gormquery.NewMemoryRateLimiter(),
+	}
+*/
+type MemoryRateLimiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	calls   int
+}
+
+type tokenBucket struct {
+	limit     RateLimit
+	tokens    float64
+	updatedAt time.Time
+}
+
+// buckets are swept every sweepInterval calls, dropping the full ones
+const sweepInterval = 1000
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+func (l *MemoryRateLimiter) Allow(ctx context.Context, key string, limit RateLimit) (allowed bool, retryAfter time.Duration, err error) {
+	if limit.Rate <= 0 || limit.Burst <= 0 {
+		return true, 0, nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	l.calls++
+	if l.calls%sweepInterval == 0 {
+		l.sweep(now)
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), updatedAt: now}
+		l.buckets[key] = bucket
+	}
+	bucket.limit = limit
+	bucket.refill(now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0, nil
+	}
+	wait := (1 - bucket.tokens) / limit.Rate
+	retryAfter = time.Duration(math.Ceil(wait * float64(time.Second)))
+	return false, retryAfter, nil
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.updatedAt).Seconds() * b.limit.Rate
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.updatedAt = now
+}
+
+// a bucket idle long enough to be full is the same as a new one
+func (l *MemoryRateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= float64(bucket.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package gormquery
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// incoming context of a peer address, with actor of metadata if it is not empty
+func testPeerCtx(address string, actor string) context.Context {
+	addr, _ := net.ResolveTCPAddr("tcp", address)
+	ctx := peer.NewContext(testCtx, &peer.Peer{Addr: addr})
+	if actor != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(ActorMetadataKey, actor))
+	}
+	return ctx
+}
+
+func TestRateLimit(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{RateLimits: map[string]RateLimit{OperationGet: {Rate: 0.001, Burst: 2}}})
+	server.RateLimiter = NewMemoryRateLimiter()
+	get := func(ctx context.Context) error {
+		_, err := server.Get(ctx, optionRequest(skmap.Map{}))
+		return err
+	}
+	ctx := testPeerCtx("10.0.0.1:1000", "alice")
+	expectNoError(t, get(ctx))
+	expectNoError(t, get(testPeerCtx("10.0.0.1:2000", "bob")))
+	err := get(ctx)
+	expectCode(t, "Get out of tokens", codes.ResourceExhausted, err)
+	retryInfo, ok := status.Convert(err).Details()[0].(*errdetails.RetryInfo)
+	expect(t, "retry info", ok && retryInfo.RetryDelay.AsDuration() > time.Second)
+	// other peers and operations have their own buckets
+	expectNoError(t, get(testPeerCtx("10.0.0.2:1000", "")))
+	_, err = server.GetOne(ctx, optionRequest(skmap.Map{"id": 1}))
+	expectNoError(t, err)
+}
+
+func TestRateLimitCaller(t *testing.T) {
+	server := &QueryServiceServer{}
+	ctx := testPeerCtx("10.0.0.1:1000", "alice")
+	expectEqual(t, "caller of peer", "10.0.0.1", server.callerOf(ctx))
+	expectEqual(t, "caller without peer", "", server.callerOf(testCtx))
+	server.TrustActorMetadata = true
+	expectEqual(t, "caller of trusted actor", "alice", server.callerOf(ctx))
+	expectEqual(t, "caller of trusted metadata without actor", "10.0.0.1", server.callerOf(testPeerCtx("10.0.0.1:1000", "")))
+	server.GetCaller = func(ctx context.Context) string { return "custom" }
+	expectEqual(t, "caller of GetCaller", "custom", server.callerOf(ctx))
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	limiter := NewMemoryRateLimiter()
+	limit := RateLimit{Rate: 1000, Burst: 1}
+	allowed, _, err := limiter.Allow(testCtx, "a", limit)
+	expectNoError(t, err)
+	expect(t, "first call", allowed)
+	allowed, retryAfter, _ := limiter.Allow(testCtx, "a", limit)
+	expect(t, "empty bucket", !allowed && retryAfter > 0 && retryAfter <= time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	allowed, _, _ = limiter.Allow(testCtx, "a", limit)
+	expect(t, "refilled bucket", allowed)
+	allowed, _, _ = limiter.Allow(testCtx, "b", RateLimit{})
+	expect(t, "no limit", allowed)
+}
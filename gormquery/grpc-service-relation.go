@@ -0,0 +1,358 @@
+package gormquery
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+/*
+Relational field of a model class, selected by "relation" or "relation.subField" in "fields"
+
+Example
+
+	"item": {
+		Model:  postgres.Item{},
+		CanGet: true,
+		Relations: map[string]gormquery.ModelRelation{
+			"category": {
+				Association:           "Category",
+				Dependencies:          []string{"category_id"},
+				QueryComplusoryFields: []string{"id"},
+			},
+		},
+	},
+*/
+type ModelRelation struct {
+	// association name of gORM model. The relation key would be used if it is not provided
+	Association string
+	// fields of the model required by the relation, e.g. foreign key of belongs-to
+	Dependencies []string
+	// fields of the related model that could be selected. Any field is allowed if it is not provided
+	WhitelistedFields skmap.Map
+	// fields of the related model that must be selected, e.g. primary key and foreign key of has-many
+	QueryComplusoryFields []string
+}
+
+func (r ModelRelation) association(name string) string {
+	if r.Association == "" {
+		return name
+	}
+	return r.Association
+}
+
+func (mc *ModelClass) relationDependencies() (dependencies map[string][]string) {
+	dependencies = map[string][]string{}
+	for name, relation := range mc.Relations {
+		dependencies[name] = relation.Dependencies
+	}
+	return
+}
+
+/*
+Dialects (gorm.Dialector.Name) supporting window functions, for "limit" of relation scopes.
+Relations of other dialects are loaded per parent record, e.g. add "mysql" for MySQL 8.0+.
+*/
+var WindowFunctionDialects = map[string]bool{
+	"postgres":  true,
+	"sqlite":    true,
+	"sqlserver": true,
+}
+
+// column of row number of the window function
+const relationRowNumberColumn = "gormquery_row_number"
+
+/*
+Limit, sort and filter of a relation, by option "relations"
+
+Example
+
+	"relations": {
+		"comments": {"limit": 5, "sort": {"created_at": "DESC"}, "filter": {"approved": true}}
+	}
+*/
+type relationScope struct {
+	limit    int
+	sortDefs skmap.Map
+	filter   skmap.Map
+}
+
+func (mc *ModelClass) parseRelationScopes(options skmap.Map) (scopes map[string]relationScope, err error) {
+	scopes = map[string]relationScope{}
+	for name, value := range options.GetMapDefault("relations", nil) {
+		if _, ok := mc.Relations[name]; !ok {
+			err = status.Errorf(codes.InvalidArgument, "invalid relation %s", name)
+			return
+		}
+		scopeMap, ok := value.(map[string]any)
+		if !ok {
+			err = status.Errorf(codes.InvalidArgument, "invalid scope of relation %s", name)
+			return
+		}
+		scope := relationScope{
+			limit:    skmap.Map(scopeMap).GetIntDefault("limit", 0),
+			sortDefs: skmap.Map(scopeMap).GetMapDefault("sort", nil),
+			filter:   skmap.Map(scopeMap).GetMapDefault("filter", nil),
+		}
+		if scope.limit < 0 {
+			err = status.Errorf(codes.InvalidArgument, "invalid limit of relation %s", name)
+			return
+		}
+		err = mc.Limits.checkFilter(scope.filter)
+		if err != nil {
+			return
+		}
+		scopes[name] = scope
+	}
+	return
+}
+
+/*
+Preload relations resolved by ApplyFields
+
+It should be applied after counting, as preloading is not part of the count query.
+Relations with "limit" in scopes are limited per parent record with ROW_NUMBER() if the dialect is in
+WindowFunctionDialects, otherwise (and for many-to-many) they are loaded by loadRelations after the records.
+*/
+func (mc *ModelClass) applyRelations(qf *QueryFactory, relationFieldMap map[string][]string, scopes map[string]relationScope) (loadRelations func(results any) error) {
+	var modelSchema *schema.Schema
+	if len(scopes) > 0 {
+		var err error
+		modelSchema, err = schemaOf(qf.Query, mc.Model)
+		if err != nil {
+			return func(results any) error { return err }
+		}
+	}
+	loaders := []func(results any) error{}
+	db := qf.Query.Session(&gorm.Session{NewDB: true})
+	for name, subFields := range relationFieldMap {
+		relation, ok := mc.Relations[name]
+		if !ok {
+			continue
+		}
+		conditions := []any{}
+		// exact relation: all fields
+		if len(subFields) > 0 {
+			selected := []string{}
+			for _, subField := range subFields {
+				if relation.WhitelistedFields != nil && relation.WhitelistedFields.GetDefault(subField, nil) == nil {
+					continue
+				}
+				selected = append(selected, subField)
+			}
+			selected = append(selected, relation.QueryComplusoryFields...)
+			conditions = append(conditions, func(db *gorm.DB) *gorm.DB {
+				return db.Select(selected)
+			})
+		}
+		scope, ok := scopes[name]
+		if !ok {
+			qf.Query = qf.Query.Preload(relation.association(name), conditions...)
+			continue
+		}
+		relationship, ok := modelSchema.Relationships.Relations[relation.association(name)]
+		if !ok {
+			continue
+		}
+		if scope.limit > 0 && relationship.Type == schema.HasMany && WindowFunctionDialects[qf.Query.Dialector.Name()] {
+			conditions = append(conditions, relation.windowScopeQuery(relationship, scope))
+			qf.Query = qf.Query.Preload(relation.association(name), conditions...)
+			continue
+		}
+		conditions = append(conditions, relation.scopeQuery(relationship, scope))
+		if scope.limit == 0 || (relationship.Type != schema.HasMany && relationship.Type != schema.Many2Many) {
+			qf.Query = qf.Query.Preload(relation.association(name), conditions...)
+			continue
+		}
+		loaders = append(loaders, perParentLoader(db, relationship, conditions, scope.limit))
+	}
+	return func(results any) error {
+		for _, loader := range loaders {
+			if err := loader(results); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// filter and sort of relation scope, on fields whitelisted by the relation, or any column of the related model
+func (r ModelRelation) scopeDefs(relationship *schema.Relationship, scope relationScope) (filterFields skmap.Map, sortDefs skmap.Map) {
+	isField := func(field string) bool {
+		if r.WhitelistedFields != nil {
+			return r.WhitelistedFields.GetDefault(field, nil) != nil
+		}
+		schemaField := relationship.FieldSchema.LookUpField(field)
+		return schemaField != nil && schemaField.DBName == field
+	}
+	filterFields = skmap.Map{}
+	for field := range scope.filter {
+		if isField(field) {
+			filterFields[field] = r.WhitelistedFields.GetDefault(field, true)
+		}
+	}
+	sortDefs = skmap.Map{}
+	for field := range scope.sortDefs {
+		if isField(field) {
+			sortDefs[field] = scope.sortDefs.GetStringDefault(field, "ASC")
+		}
+	}
+	return
+}
+
+func (r ModelRelation) scopeQuery(relationship *schema.Relationship, scope relationScope) func(db *gorm.DB) *gorm.DB {
+	filterFields, sortDefs := r.scopeDefs(relationship, scope)
+	return func(db *gorm.DB) *gorm.DB {
+		qf := QueryFactory{Query: db}
+		applyFilter(&qf, scope.filter, filterFields)
+		applySortDefs(&qf, sortDefs)
+		return qf.Query
+	}
+}
+
+/*
+Limit related records of each parent record with ROW_NUMBER(), for preloading has-many relations
+
+The related table is replaced by a subquery of the same name, numbering filtered records of each parent
+in the order of the scope, with the primary key as tie-breaker.
+*/
+func (r ModelRelation) windowScopeQuery(relationship *schema.Relationship, scope relationScope) func(db *gorm.DB) *gorm.DB {
+	filterFields, sortDefs := r.scopeDefs(relationship, scope)
+	table := relationship.FieldSchema.Table
+	partitions := []string{}
+	for _, reference := range relationship.References {
+		if reference.OwnPrimaryKey {
+			partitions = append(partitions, fmt.Sprintf("%s.%s", table, reference.ForeignKey.DBName))
+		}
+	}
+	orders := []string{}
+	for field := range sortDefs {
+		if sortDef := sortDefs.GetStringDefault(field, "ASC"); sortDef == "ASC" || sortDef == "DESC" {
+			orders = append(orders, fmt.Sprintf("%s.%s %s", table, field, sortDef))
+		}
+	}
+	for _, field := range relationship.FieldSchema.PrimaryFields {
+		orders = append(orders, fmt.Sprintf("%s.%s", table, field.DBName))
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		numbered := QueryFactory{Query: db.Session(&gorm.Session{NewDB: true}).Model(reflect.New(relationship.FieldSchema.ModelType).Interface())}
+		applyFilter(&numbered, scope.filter, filterFields)
+		numbered.Query = numbered.Query.Select(fmt.Sprintf("%s.*, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) AS %s",
+			table, strings.Join(partitions, ", "), strings.Join(orders, ", "), relationRowNumberColumn))
+		qf := QueryFactory{Query: db.Table(fmt.Sprintf("(?) AS %s", table), numbered.Query).Where(fmt.Sprintf("%s <= ?", relationRowNumberColumn), scope.limit)}
+		applySortDefs(&qf, sortDefs)
+		return qf.Query
+	}
+}
+
+// load related records of each parent record by association, for dialects without window functions and many-to-many
+func perParentLoader(db *gorm.DB, relationship *schema.Relationship, conditions []any, limit int) func(results any) error {
+	return func(results any) error {
+		resultsValue := reflect.Indirect(reflect.ValueOf(results))
+		for i := 0; i < resultsValue.Len(); i++ {
+			record := reflect.Indirect(resultsValue.Index(i))
+			query := db.Limit(limit)
+			for _, condition := range conditions {
+				query = condition.(func(db *gorm.DB) *gorm.DB)(query)
+			}
+			related := relationship.Field.ReflectValueOf(db.Statement.Context, record)
+			err := query.Model(record.Addr().Interface()).Association(relationship.Name).Find(related.Addr().Interface())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+/*
+Apply filter of relation fields, e.g. {"category.name": "x"}, as EXISTS subqueries
+
+A relation field must be whitelisted by its full name in WhitelistedFields of the model class, e.g.
+"category.name": true, and the relation must be declared in Relations. Fields of the same relation must be
+matched by the same related record. A subquery is used instead of a join for all types of relation, so that
+records are not duplicated by has-many relations and unqualified columns of other filters are not ambiguous.
+*/
+func (mc *ModelClass) applyRelationFilter(qf *QueryFactory, filter skmap.Map) (hasFilter bool) {
+	relationFilters := map[string]map[string]any{}
+	for field := range mc.WhitelistedFields {
+		relationName, subField, ok := strings.Cut(field, ".")
+		if !ok {
+			continue
+		}
+		if _, ok := mc.Relations[relationName]; !ok {
+			continue
+		}
+		// the dotted key is a field name, not a path of filter
+		filterValue := filter[field]
+		if filterValue == nil {
+			continue
+		}
+		if relationFilters[relationName] == nil {
+			relationFilters[relationName] = map[string]any{}
+		}
+		relationFilters[relationName][subField] = filterValue
+	}
+	if len(relationFilters) == 0 {
+		return
+	}
+	modelSchema, err := schemaOf(qf.Query, mc.Model)
+	if err != nil {
+		return
+	}
+	for relationName, subFilter := range relationFilters {
+		relationship, ok := modelSchema.Relationships.Relations[mc.Relations[relationName].association(relationName)]
+		if !ok {
+			continue
+		}
+		alias := "relation_" + relationName
+		subQf := QueryFactory{Query: relationQuery(qf.Query.Session(&gorm.Session{NewDB: true}), modelSchema.Table, relationship, alias)}
+		for subField, filterValue := range subFilter {
+			field := relationship.FieldSchema.LookUpField(subField)
+			if field == nil || field.DBName == "" {
+				continue
+			}
+			subQf.ApplyQuery(fmt.Sprintf("%s.%s", alias, field.DBName), filterValue)
+		}
+		qf.Query = qf.Query.Where("EXISTS (?)", subQf.Query)
+		hasFilter = true
+	}
+	return
+}
+
+// records of related table (aliased by alias) of a record of table
+func relationQuery(db *gorm.DB, table string, relationship *schema.Relationship, alias string) *gorm.DB {
+	query := db.Table(fmt.Sprintf("%s AS %s", relationship.FieldSchema.Table, alias)).Select("1")
+	// table of foreign keys, which is the join table of many-to-many
+	foreignTable := alias
+	if relationship.JoinTable != nil {
+		foreignTable = alias + "_join"
+		joinConditions := []string{}
+		for _, reference := range relationship.References {
+			if reference.PrimaryKey != nil && !reference.OwnPrimaryKey {
+				joinConditions = append(joinConditions, fmt.Sprintf("%s.%s = %s.%s", foreignTable, reference.ForeignKey.DBName, alias, reference.PrimaryKey.DBName))
+			}
+		}
+		query = query.Joins(fmt.Sprintf("JOIN %s AS %s ON %s", relationship.JoinTable.Table, foreignTable, strings.Join(joinConditions, " AND ")))
+	}
+	for _, reference := range relationship.References {
+		switch {
+		// polymorphic type
+		case reference.PrimaryKey == nil:
+			query = query.Where(fmt.Sprintf("%s.%s = ?", foreignTable, reference.ForeignKey.DBName), reference.PrimaryValue)
+		// has one / has many / many to many
+		case reference.OwnPrimaryKey:
+			query = query.Where(fmt.Sprintf("%s.%s = %s.%s", foreignTable, reference.ForeignKey.DBName, table, reference.PrimaryKey.DBName))
+		// belongs to
+		case relationship.JoinTable == nil:
+			query = query.Where(fmt.Sprintf("%s.%s = %s.%s", alias, reference.PrimaryKey.DBName, table, reference.ForeignKey.DBName))
+		}
+	}
+	return query
+}
@@ -0,0 +1,159 @@
+package gormquery
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"gorm.io/gorm"
+)
+
+// server of items with relations "category" and "comments"
+func newTestRelationServer(db *gorm.DB, modelClass ModelClass) *QueryServiceServer {
+	modelClass.Relations = map[string]ModelRelation{
+		"category": {
+			Association:           "Category",
+			Dependencies:          []string{"category_id"},
+			QueryComplusoryFields: []string{"id"},
+		},
+		"comments": {
+			Association:           "Comments",
+			Dependencies:          []string{"id"},
+			WhitelistedFields:     skmap.Map{"body": true, "score": true},
+			QueryComplusoryFields: []string{"id", "item_id"},
+		},
+	}
+	return newTestServer(db, modelClass)
+}
+
+func testGetItems(t *testing.T, server *QueryServiceServer, options skmap.Map) []testItem {
+	t.Helper()
+	if options["sort"] == nil {
+		options["sort"] = skmap.Map{"id": "ASC"}
+	}
+	response, err := server.Get(testCtx, optionRequest(options))
+	expectNoError(t, err)
+	return decodeResults[testItem](t, response.Results)
+}
+
+func TestRelationPreload(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestRelationServer(db, ModelClass{})
+
+	items := testGetItems(t, server, skmap.Map{"fields": []string{"name", "category"}})
+	expectEqual(t, "items", 3, len(items))
+	expectEqual(t, "category of a", testCategory{ID: 1, Name: "x"}, *items[0].Category)
+	expectEqual(t, "id is not selected", uint(0), items[0].ID)
+
+	items = testGetItems(t, server, skmap.Map{"fields": []string{"name", "comments.body"}})
+	expectEqual(t, "comments of a", []testComment{{ID: 1, ItemID: 1, Body: "good"}, {ID: 2, ItemID: 1, Body: "bad"}}, items[0].Comments)
+	expectEqual(t, "comments of c", 0, len(items[2].Comments))
+
+	items = testGetItems(t, server, skmap.Map{"fields": []string{"name"}})
+	expect(t, "relation is not preloaded without field", items[0].Category == nil && items[0].Comments == nil)
+}
+
+func TestRelationPreloadWhitelist(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestRelationServer(db, ModelClass{})
+	// fields not in WhitelistedFields are dropped, while compulsory "id" and "item_id" are always selected
+	items := testGetItems(t, server, skmap.Map{"fields": []string{"name", "comments.body"}, "filter": skmap.Map{"name": "b"}})
+	expectEqual(t, "comments of b", []testComment{{ID: 3, ItemID: 2, Body: "fine"}}, items[0].Comments)
+	items = testGetItems(t, server, skmap.Map{"fields": []string{"name", "comments.secret"}, "filter": skmap.Map{"name": "b"}})
+	expectEqual(t, "comments of b", []testComment{{ID: 3, ItemID: 2}}, items[0].Comments)
+}
+
+func TestRelationFilter(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestRelationServer(db, ModelClass{WhitelistedFields: skmap.Map{
+		"id": true, "name": true, "price": true, "category_id": true,
+		"category.name": true, "comments.body": true, "comments.score": true,
+	}})
+
+	// belongs to, with a root column of the same name
+	expectEqual(t, "names of category x", []string{"a", "b"}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{"category.name": "x"}}))
+	expectEqual(t, "names of category x and name b", []string{"b"}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{"category.name": "x", "name": "b"}}))
+	// has many, without duplicated records
+	expectEqual(t, "names of comments above 0", []string{"a", "b"}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{"comments.score": skmap.Map{"gt": 0}}}))
+	expectEqual(t, "names of comments in", []string{"a"}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{"comments.body": []string{"good", "bad"}}}))
+	// fields of the same relation are matched by the same comment
+	expectEqual(t, "names of good comment of score 1", []string{}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{"comments.body": "good", "comments.score": 1}}))
+	expectEqual(t, "names of $or", []string{"a", "c"}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{FilterOr: []any{skmap.Map{"comments.body": "bad"}, skmap.Map{"category.name": "y"}}}}))
+
+	response, err := server.Get(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"category.name": "x"}}))
+	expectNoError(t, err)
+	expectEqual(t, "total count", uint64(2), response.TotalCount)
+
+	// writes are filtered by relations as well
+	_, err = server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"comments.body": "fine"}, "data": skmap.Map{"price": 10}}))
+	expectNoError(t, err)
+	expectEqual(t, "price of b", 10, testItemPrice(t, db, "b"))
+	expectEqual(t, "price of a", 1, testItemPrice(t, db, "a"))
+}
+
+func TestRelationFilterWhitelist(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestRelationServer(db, ModelClass{WhitelistedFields: skmap.Map{
+		"id": true, "name": true, "category.name": true, "tag.name": true,
+	}})
+	// fields not whitelisted, or of relations not declared, are ignored
+	expectEqual(t, "names of comment filter", []string{"a", "b", "c"}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{"comments.body": "fine"}}))
+	expectEqual(t, "names of undeclared relation", []string{"a", "b", "c"}, testItemNames(t, server, skmap.Map{"filter": skmap.Map{"tag.name": "x"}}))
+	// a relation filter alone is a filter of Delete
+	_, err := server.Delete(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"category.name": "y"}}))
+	expectNoError(t, err)
+	expectEqual(t, "names after Delete", []string{"a", "b"}, testItemNames(t, server, skmap.Map{}))
+}
+
+// bodies of comments of each item
+func testCommentBodies(items []testItem) (bodies [][]string) {
+	for _, item := range items {
+		itemBodies := []string{}
+		for _, comment := range item.Comments {
+			itemBodies = append(itemBodies, comment.Body)
+		}
+		bodies = append(bodies, itemBodies)
+	}
+	return
+}
+
+func TestRelationScopes(t *testing.T) {
+	for _, windowFunction := range []bool{true, false} {
+		t.Run(fmt.Sprintf("window function %v", windowFunction), func(t *testing.T) {
+			if !windowFunction {
+				WindowFunctionDialects["sqlite"] = false
+				t.Cleanup(func() { WindowFunctionDialects["sqlite"] = true })
+			}
+			db := newTestDb(t)
+			expectNoError(t, db.Create(&[]testComment{{ItemID: 1, Body: "ok", Score: 4}, {ItemID: 1, Body: "great", Score: 9}}).Error)
+			server := newTestRelationServer(db, ModelClass{})
+			fields := []string{"name", "comments.body", "comments.score"}
+
+			// latest 2 comments of each item
+			items := testGetItems(t, server, skmap.Map{"fields": fields, "relations": skmap.Map{"comments": skmap.Map{"limit": 2, "sort": skmap.Map{"score": "DESC"}}}})
+			expectEqual(t, "comments by score", [][]string{{"great", "good"}, {"fine"}, {}}, testCommentBodies(items))
+			items = testGetItems(t, server, skmap.Map{"fields": fields, "relations": skmap.Map{"comments": skmap.Map{"limit": 1, "filter": skmap.Map{"score": skmap.Map{"lt": 5}}}}})
+			expectEqual(t, "comments by filter", [][]string{{"bad"}, {"fine"}, {}}, testCommentBodies(items))
+			// fields not whitelisted by the relation are not sortable, and the primary key decides the order
+			items = testGetItems(t, server, skmap.Map{"fields": fields, "relations": skmap.Map{"comments": skmap.Map{"limit": 3, "sort": skmap.Map{"id": "DESC"}}}})
+			expectEqual(t, "comments by id", [][]string{{"good", "bad", "ok"}, {"fine"}, {}}, testCommentBodies(items))
+			// scope without limit
+			items = testGetItems(t, server, skmap.Map{"fields": fields, "relations": skmap.Map{"comments": skmap.Map{"sort": skmap.Map{"score": "ASC"}}}})
+			expectEqual(t, "all comments by score", [][]string{{"bad", "ok", "good", "great"}, {"fine"}, {}}, testCommentBodies(items))
+		})
+	}
+}
+
+func TestRelationScopesInvalid(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestRelationServer(db, ModelClass{})
+	for description, relations := range map[string]skmap.Map{
+		"unknown relation": {"tags": skmap.Map{"limit": 1}},
+		"scope of number":  {"comments": 1},
+		"negative limit":   {"comments": skmap.Map{"limit": -1}},
+	} {
+		_, err := server.Get(testCtx, optionRequest(skmap.Map{"fields": []string{"comments"}, "relations": relations}))
+		expectCode(t, description, codes.InvalidArgument, err)
+	}
+}
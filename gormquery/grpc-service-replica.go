@@ -0,0 +1,53 @@
+package gormquery
+
+import (
+	"context"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+)
+
+// gRPC metadata key to route reads of a request to the primary database
+const ReadYourWritesMetadataKey = "x-read-your-writes"
+
+// Route reads of QueryServiceModel calls to the primary database, e.g. right after a write
+func ContextWithReadYourWrites(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, ReadYourWritesMetadataKey, "true")
+}
+
+/*
+Check if a request requires the primary database
+
+It is flagged by option "readYourWrites" or gRPC metadata "x-read-your-writes".
+*/
+func isReadYourWrites(ctx context.Context, options skmap.Map) bool {
+	if options.GetBoolDefault("readYourWrites", false) {
+		return true
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md.Get(ReadYourWritesMetadataKey)
+	return len(values) > 0 && values[0] == "true"
+}
+
+/*
+Select database for reading
+
+Order: primary (read-your-writes) > ModelClass.ReadDb > QueryServiceServer.DefaultReadDb > primary
+*/
+func (q *QueryServiceServer) readDb(ctx context.Context, options skmap.Map, modelClass ModelClass, db *gorm.DB) *gorm.DB {
+	if isReadYourWrites(ctx, options) {
+		return db
+	}
+	if modelClass.ReadDb != nil {
+		return modelClass.ReadDb
+	}
+	// a model class with its own primary should not read from the default replica
+	if q.DefaultReadDb != nil && modelClass.Db == nil {
+		return q.DefaultReadDb
+	}
+	return db
+}
@@ -0,0 +1,51 @@
+package gormquery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestReadReplica(t *testing.T) {
+	primary := newTestDb(t)
+	replica := newTestDb(t)
+	// not replicated yet
+	expectNoError(t, primary.Create(&testItem{Name: "d", Price: 4}).Error)
+	server := newTestServer(primary, ModelClass{})
+	server.DefaultReadDb = replica
+	totalCount := func(ctx context.Context, options skmap.Map) uint64 {
+		response, err := server.Get(ctx, optionRequest(options))
+		expectNoError(t, err)
+		return response.TotalCount
+	}
+	expectEqual(t, "count of replica", uint64(3), totalCount(testCtx, skmap.Map{}))
+	expectEqual(t, "count of read-your-writes", uint64(4), totalCount(testCtx, skmap.Map{"readYourWrites": true}))
+	ctx := metadata.NewIncomingContext(testCtx, metadata.Pairs(ReadYourWritesMetadataKey, "true"))
+	expectEqual(t, "count of read-your-writes metadata", uint64(4), totalCount(ctx, skmap.Map{}))
+
+	_, err := server.GetOne(testCtx, optionRequest(skmap.Map{"id": 4}))
+	expectCode(t, "GetOne of replica", codes.NotFound, err)
+	_, err = server.GetOne(testCtx, optionRequest(skmap.Map{"id": 4, "readYourWrites": true}))
+	expectNoError(t, err)
+
+	// writes go to the primary
+	_, err = server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"name": "a"}, "data": skmap.Map{"price": 10}}))
+	expectNoError(t, err)
+	expectEqual(t, "price of primary", 10, testItemPrice(t, primary, "a"))
+	expectEqual(t, "price of replica", 1, testItemPrice(t, replica, "a"))
+}
+
+func TestReadDbSelection(t *testing.T) {
+	primary := newTestDb(t)
+	replica := newTestDb(t)
+	classReplica := newTestDb(t)
+	server := &QueryServiceServer{DefaultDb: primary, DefaultReadDb: replica}
+	expect(t, "db of class replica", server.readDb(testCtx, skmap.Map{}, ModelClass{ReadDb: classReplica}, primary) == classReplica)
+	expect(t, "db of default replica", server.readDb(testCtx, skmap.Map{}, ModelClass{}, primary) == replica)
+	// a model class with its own primary
+	expect(t, "db of class primary", server.readDb(testCtx, skmap.Map{}, ModelClass{Db: classReplica}, classReplica) == classReplica)
+	expect(t, "db of read-your-writes", server.readDb(testCtx, skmap.Map{"readYourWrites": true}, ModelClass{ReadDb: classReplica}, primary) == primary)
+}
@@ -0,0 +1,230 @@
+package gormquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/levav-enspiren/common-go/skmap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+/*
+Virtual field of a model class, backed by either a SQL expression or a Go function
+
+Example
+
+	"user": {
+		Model:  postgres.User{},
+		CanGet: true,
+		VirtualFields: map[string]gormquery.VirtualField{
+			// selectable, filterable and sortable
+			"display_name": {
+				Expression: "first_name || ' ' || last_name",
+			},
+			// evaluated on each result row, record keys are JSON names of the model
+			"is_expired": {
+				Dependencies: []string{"expired_at"},
+				Compute: func(record skmap.Map) any {
+					expiredAt, _ := time.Parse(time.RFC3339, record.GetStringDefault("expired_at", ""))
+					return expiredAt.Before(time.Now())
+				},
+			},
+		},
+	},
+*/
+type VirtualField struct {
+	// SQL expression of the field
+	Expression string
+	// function evaluated on each result row, used if Expression is not provided
+	Compute func(record skmap.Map) any
+	// columns required by Compute, selected whenever the field is selected
+	Dependencies []string
+}
+
+// dependencies of virtual fields, in the format of ApplyFields relations
+func (mc *ModelClass) virtualDependencies(primaryKey string) (dependencies map[string][]string) {
+	dependencies = map[string][]string{}
+	for name, virtualField := range mc.VirtualFields {
+		if virtualField.Expression != "" {
+			// expression values are fetched by primary key
+			dependencies[name] = []string{primaryKey}
+			continue
+		}
+		dependencies[name] = virtualField.Dependencies
+	}
+	return
+}
+
+// virtual fields selected by "fields". All virtual fields are selected if no field is selected
+func (mc *ModelClass) selectedVirtualFields(fields []string, relationFieldMap map[string][]string) (selected []string) {
+	for name := range mc.VirtualFields {
+		if _, ok := relationFieldMap[name]; ok || len(fields) == 0 {
+			selected = append(selected, name)
+		}
+	}
+	return
+}
+
+/*
+Apply filter of virtual fields with Expression
+
+Values are applied as they are to columns, with the parenthesized expression as the field,
+e.g. {"double_price": {"gte": 4}} applies "(price * 2) >= 4".
+*/
+func (mc *ModelClass) applyVirtualFilter(qf *QueryFactory, filter skmap.Map) (hasFilter bool) {
+	for name, virtualField := range mc.VirtualFields {
+		if virtualField.Expression == "" {
+			continue
+		}
+		filterValue := filter.GetDefault(name, nil)
+		if filterValue == nil {
+			continue
+		}
+		hasFilter = true
+		field := fmt.Sprintf("(%s)", virtualField.Expression)
+		switch filterValue.(type) {
+		case []any, map[string]any, skmap.Map:
+			qf.ApplyQuery(field, filterValue)
+		default:
+			// a bare expression is not a column of the primitive condition
+			qf.ApplyQuery(field, map[string]any{"eq": filterValue})
+		}
+	}
+	return
+}
+
+// replace virtual field of sort definition with its SQL expression
+func (mc *ModelClass) virtualSortDefs(sortDefs skmap.Map) skmap.Map {
+	if len(mc.VirtualFields) == 0 {
+		return sortDefs
+	}
+	resolved := skmap.Map{}
+	for field, sortDef := range sortDefs {
+		if virtualField, ok := mc.VirtualFields[field]; ok {
+			if virtualField.Expression == "" {
+				continue
+			}
+			field = fmt.Sprintf("(%s)", virtualField.Expression)
+		}
+		resolved[field] = sortDef
+	}
+	return resolved
+}
+
+/*
+Add selected virtual fields to JSON results
+
+Expression values are queried by primary key of the results, then Compute functions are evaluated on each row.
+*/
+func (mc *ModelClass) applyVirtualFields(ctx context.Context, db *gorm.DB, results []byte, selected []string) (applied []byte, err error) {
+	if len(selected) == 0 {
+		return results, nil
+	}
+	var rawRecords []map[string]json.RawMessage
+	err = json.Unmarshal(results, &rawRecords)
+	if err != nil {
+		return
+	}
+	var records []skmap.Map
+	err = json.Unmarshal(results, &records)
+	if err != nil || len(records) == 0 {
+		return results, err
+	}
+	expressionValues, err := mc.queryVirtualExpressions(ctx, db, rawRecords, selected)
+	if err != nil {
+		return
+	}
+	for i, record := range records {
+		for _, name := range selected {
+			virtualField := mc.VirtualFields[name]
+			var value any
+			if virtualField.Expression != "" {
+				value = expressionValues[i][name]
+			} else if virtualField.Compute != nil {
+				value = virtualField.Compute(record)
+			}
+			var valueBytes []byte
+			valueBytes, err = json.Marshal(value)
+			if err != nil {
+				return
+			}
+			rawRecords[i][name] = valueBytes
+		}
+	}
+	return json.Marshal(rawRecords)
+}
+
+// values of expression virtual fields, in the order of records
+func (mc *ModelClass) queryVirtualExpressions(ctx context.Context, db *gorm.DB, records []map[string]json.RawMessage, selected []string) (values []map[string]any, err error) {
+	values = make([]map[string]any, len(records))
+	selects := []string{}
+	for _, name := range selected {
+		virtualField := mc.VirtualFields[name]
+		if virtualField.Expression == "" {
+			continue
+		}
+		selects = append(selects, fmt.Sprintf("(%s) AS %s", virtualField.Expression, name))
+	}
+	if len(selects) == 0 {
+		return
+	}
+	primaryField, err := primaryFieldOf(db, mc.Model)
+	if err != nil {
+		return
+	}
+	jsonKey := jsonNameOf(primaryField)
+	recordKeys := make([]string, len(records))
+	keys := []any{}
+	for i, record := range records {
+		var key any
+		key, err = jsonPrimaryKeyOf(primaryField, record[jsonKey])
+		if err != nil {
+			return
+		}
+		recordKeys[i] = fmt.Sprint(key)
+		keys = append(keys, key)
+	}
+	rows := []map[string]any{}
+	err = db.WithContext(ctx).Model(mc.CreateModelRef()).
+		Select(append([]string{primaryField.DBName}, selects...)).
+		Where(fmt.Sprintf("%s in ?", primaryField.DBName), keys).
+		Find(&rows).Error
+	if err != nil {
+		return
+	}
+	normalizeSnapshots(rows)
+	rowMap := map[string]map[string]any{}
+	for _, row := range rows {
+		var key any
+		key, err = coerceValue(primaryField, row[primaryField.DBName])
+		if err != nil {
+			return
+		}
+		rowMap[fmt.Sprint(key)] = row
+	}
+	for i := range records {
+		values[i] = rowMap[recordKeys[i]]
+	}
+	return
+}
+
+/*
+Primary key of a JSON record in the type of the primary field
+
+Keys of records and rows are compared as typed values, as float64 of JSON numbers is not exact above 2^53.
+*/
+func jsonPrimaryKeyOf(primaryField *schema.Field, value json.RawMessage) (key any, err error) {
+	if len(value) == 0 {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	err = decoder.Decode(&key)
+	if err != nil {
+		return
+	}
+	return coerceValue(primaryField, key)
+}
@@ -0,0 +1,97 @@
+package gormquery
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+)
+
+type testBigRecord struct {
+	ID   int64  `gorm:"primaryKey;autoIncrement:false" json:"id"`
+	Name string `json:"name"`
+}
+
+var testVirtualFields = map[string]VirtualField{
+	"double_price": {
+		Expression: "price * 2",
+	},
+	"label": {
+		Dependencies: []string{"name", "price"},
+		Compute: func(record skmap.Map) any {
+			return fmt.Sprintf("%s$%v", record.GetStringDefault("name", ""), record["price"])
+		},
+	},
+}
+
+func TestVirtualFields(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{VirtualFields: testVirtualFields})
+	get := func(options skmap.Map) []map[string]any {
+		response, err := server.Get(testCtx, optionRequest(options))
+		expectNoError(t, err)
+		return decodeResults[map[string]any](t, response.Results)
+	}
+
+	results := get(skmap.Map{"fields": []string{"double_price", "label"}, "sort": skmap.Map{"double_price": "DESC"}})
+	expectEqual(t, "results", 3, len(results))
+	expectEqual[any](t, "double price", float64(6), results[0]["double_price"])
+	expectEqual[any](t, "label", "c$3", results[0]["label"])
+
+	results = get(skmap.Map{"fields": []string{"name"}, "filter": skmap.Map{"double_price": 4}})
+	expectEqual(t, "results of filter", 1, len(results))
+	expectEqual[any](t, "name", "b", results[0]["name"])
+	expect(t, "unselected virtual fields", results[0]["double_price"] == nil && results[0]["label"] == nil)
+
+	// all virtual fields without "fields"
+	results = get(skmap.Map{"filter": skmap.Map{"name": "a"}})
+	expectEqual[any](t, "double price", float64(2), results[0]["double_price"])
+	expectEqual[any](t, "label", "a$1", results[0]["label"])
+}
+
+func TestVirtualFieldsFilter(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{VirtualFields: testVirtualFields})
+	filterNames := func(filter skmap.Map) []string {
+		return testItemNames(t, server, skmap.Map{"filter": filter})
+	}
+
+	expectEqual(t, "operators", []string{"b", "c"}, filterNames(skmap.Map{"double_price": skmap.Map{"gte": 4}}))
+	expectEqual(t, "array", []string{"a", "c"}, filterNames(skmap.Map{"double_price": []any{2, 6}}))
+	expectEqual(t, "$or", []string{"a", "c"}, filterNames(skmap.Map{FilterOr: []any{
+		map[string]any{"double_price": map[string]any{"lt": 3}},
+		map[string]any{"name": "c"},
+	}}))
+
+	_, err := server.Update(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"double_price": 2}, "data": skmap.Map{"price": 10}}))
+	expectNoError(t, err)
+	expectEqual(t, "updated price", 10, testItemPrice(t, db, "a"))
+	expectEqual(t, "price of other item", 2, testItemPrice(t, db, "b"))
+
+	_, err = server.Delete(testCtx, optionRequest(skmap.Map{"filter": skmap.Map{"double_price": skmap.Map{"gt": 10}}}))
+	expectNoError(t, err)
+	expectEqual(t, "names after delete", []string{"b", "c"}, filterNames(skmap.Map{}))
+}
+
+func TestVirtualFieldsLargePrimaryKey(t *testing.T) {
+	db := newTestDb(t)
+	expectNoError(t, db.AutoMigrate(&testBigRecord{}))
+	// ids above 2^53 are not exact in float64, so 9007199254740993 would collide with 9007199254740992
+	expectNoError(t, db.Create(&[]testBigRecord{{ID: 9007199254740992, Name: "even"}, {ID: 9007199254740993, Name: "odd"}}).Error)
+	server := newTestServer(db, ModelClass{
+		Model:             testBigRecord{},
+		WhitelistedFields: skmap.Map{"id": true, "name": true},
+		VirtualFields:     map[string]VirtualField{"upper_name": {Expression: "UPPER(name)"}},
+	})
+	response, err := server.Get(testCtx, optionRequest(skmap.Map{"fields": []string{"upper_name"}, "sort": skmap.Map{"id": "ASC"}}))
+	expectNoError(t, err)
+	results := decodeResults[map[string]any](t, response.Results)
+	expectEqual(t, "results", 2, len(results))
+	expectEqual[any](t, "upper name of even", "EVEN", results[0]["upper_name"])
+	expectEqual[any](t, "upper name of odd", "ODD", results[1]["upper_name"])
+}
+
+func TestVirtualSortDefs(t *testing.T) {
+	modelClass := ModelClass{VirtualFields: testVirtualFields}
+	expectEqual(t, "sort definitions", skmap.Map{"(price * 2)": "ASC", "name": "DESC"}, modelClass.virtualSortDefs(skmap.Map{"double_price": "ASC", "label": "ASC", "name": "DESC"}))
+}
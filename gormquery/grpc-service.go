@@ -6,28 +6,55 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/levav-enspiren/common-go/gormquery/helper"
 	"github.com/levav-enspiren/common-go/gormquery/queryService"
 	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 type ModelClass struct {
 	Model any
 	Db    *gorm.DB
+	// read replica of Db, for Get / GetOne
+	ReadDb *gorm.DB
 	// Get Config
-	CanGet                bool
+	CanGet bool
+	// filterable fields, including relation fields such as "category.name"
 	WhitelistedFields     skmap.Map
 	QueryComplusoryFields []string
-	// TODO:
-	// queryRelations        []ModelRelation
+	Relations             map[string]ModelRelation
+	// API field name to column name, applied to fields, filter, sort, data and result keys (JSON names of the model fields)
+	FieldAliases map[string]string
+	// computed fields of results
+	VirtualFields map[string]VirtualField
 	// Create Config
 	CanCreate bool
+	// validation of record data, for Create and Import. Errors without gRPC status are InvalidArgument
+	ValidateData func(data skmap.Map) error
 	// Update Config
 	CanUpdate bool
 	// Delete Config
 	CanDelete bool
+	// Guardrails of page size, filter, relations and statement timeout
+	Limits QueryLimits
+	// TTL of cached Get results, caching is disabled if it is not provided.
+	// Results are dropped by writes through the server only, of the model class or a model class it reads (ref: QueryServiceServer.ReplicaLag)
+	CacheTTL time.Duration
+	// Audit Config
+	Audit *AuditConfig
+	// token bucket per caller of each operation (gormquery.OperationGet, ...), requires QueryServiceServer.RateLimiter
+	RateLimits map[string]RateLimit
+	// allow "explainPlan" option, which runs EXPLAIN on the database
+	CanExplainPlan bool
+
+	name string
 }
 
 func (mc *ModelClass) CreateModelRef() any {
@@ -38,12 +65,83 @@ func (mc *ModelClass) CreateModelArrayRef() any {
 	return reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(mc.Model)), 0, 0).Interface()
 }
 
+// Pointer to an empty model slice. Unlike a slice wrapped by "any", gORM could preload relations into it
+func (mc *ModelClass) CreateModelArrayPtr() any {
+	ptr := reflect.New(reflect.SliceOf(reflect.TypeOf(mc.Model)))
+	ptr.Elem().Set(reflect.MakeSlice(ptr.Elem().Type(), 0, 0))
+	return ptr.Interface()
+}
+
 type QueryServiceServer struct {
 	queryService.QueryServiceServer
 
 	ModelClasses      map[string]ModelClass
 	DefaultModelClass string
 	DefaultDb         *gorm.DB
+	// read replica of DefaultDb
+	DefaultReadDb *gorm.DB
+	// Result cache of Get, for model classes with CacheTTL
+	Cache ResultCache
+	// Upper bound of replication lag of read replicas. Get results read from a replica within it after a write
+	// of the model class are not cached, as they could miss the write. Disabled if it is not provided
+	ReplicaLag time.Duration
+	// Idempotency keys of Create, disabled if it is not provided
+	Idempotency *IdempotencyConfig
+	// Rate limiter of ModelClass.RateLimits, disabled if it is not provided
+	RateLimiter RateLimiter
+	// Caller identity of rate limits and idempotency keys. CallerFromContext would be used if it is not provided
+	GetCaller func(ctx context.Context) string
+	// Identify callers of rate limits and idempotency keys by gRPC metadata "x-actor" instead of the peer address,
+	// only if a trusted proxy sets it, since clients could set it freely
+	TrustActorMetadata bool
+}
+
+// validate record data of Create / Import
+func (mc *ModelClass) validateCreateData(data skmap.Map) error {
+	if data == nil {
+		return status.Error(codes.InvalidArgument, "missing data")
+	}
+	if mc.ValidateData == nil {
+		return nil
+	}
+	err := mc.ValidateData(data)
+	if _, ok := status.FromError(err); !ok {
+		err = status.Error(codes.InvalidArgument, err.Error())
+	}
+	return err
+}
+
+/*
+Fill auto time fields (autoCreateTime / autoUpdateTime, e.g. CreatedAt of gorm.Model) missing in record data
+
+gORM fills them for structs only, and a map record would store them as NULL or zero otherwise.
+*/
+func fillAutoTime(db *gorm.DB, modelClass ModelClass, data map[string]any) error {
+	modelSchema, err := schemaOf(db, modelClass.Model)
+	if err != nil {
+		return err
+	}
+	now := db.NowFunc()
+	for _, field := range modelSchema.Fields {
+		autoTime := field.AutoCreateTime
+		if autoTime == 0 {
+			autoTime = field.AutoUpdateTime
+		}
+		if autoTime == 0 || field.DBName == "" || data[field.DBName] != nil {
+			continue
+		}
+		switch autoTime {
+		case schema.UnixNanosecond:
+			data[field.DBName] = now.UnixNano()
+		case schema.UnixMillisecond:
+			data[field.DBName] = now.UnixNano() / 1e6
+		case schema.UnixSecond:
+			data[field.DBName] = now.Unix()
+		default:
+			data[field.DBName] = now
+		}
+	}
+	return nil
 }
 
 func (q *QueryServiceServer) parseOptionRequest(request *queryService.OptionRequest) (options skmap.Map, modelClass ModelClass, db *gorm.DB, err error) {
@@ -51,13 +149,28 @@ func (q *QueryServiceServer) parseOptionRequest(request *queryService.OptionRequ
 	if err != nil {
 		return
 	}
+	if filter, ok := numberFilterOf(request.Options); ok {
+		options["filter"] = filter
+	}
+	if id, ok := numberOptionOf(request.Options, "id"); ok {
+		options["id"] = id
+	}
 	//
 	modelClassName := options.GetStringDefault("modelClass", q.DefaultModelClass)
 	modelClass, ok := q.ModelClasses[modelClassName]
 	if !ok {
-		err = errors.New("invalid model class")
+		err = status.Error(codes.InvalidArgument, "invalid model class")
 		return
 	}
+	modelClass.name = modelClassName
+	modelClass.applyFieldAliases(options)
+	if filter := options.GetMapDefault("filter", nil); filter != nil {
+		err = ValidateFilter(filter)
+		if err != nil {
+			err = status.Error(codes.InvalidArgument, err.Error())
+			return
+		}
+	}
 	//
 	db = modelClass.Db
 	if db == nil {
@@ -67,15 +180,35 @@ func (q *QueryServiceServer) parseOptionRequest(request *queryService.OptionRequ
 		err = errors.New("missing db")
 		return
 	}
+	if filter := options.GetMapDefault("filter", nil); filter != nil {
+		var modelSchema *schema.Schema
+		modelSchema, err = schemaOf(db, modelClass.Model)
+		if err != nil {
+			return
+		}
+		options["filter"], err = modelClass.coerceFilter(modelSchema, filter)
+	}
 	return
 }
 
-func applyFilter(qf QueryFactory, filter skmap.Map, whitelistedFields skmap.Map) (hasFilter bool) {
+/*
+Apply filter of whitelisted fields
+
+Fields of relations, e.g. "category.name", are applied as EXISTS subqueries if they are whitelisted
+and the relation is declared in Relations (ref: gormquery.ModelClass.applyRelationFilter).
+Virtual fields with Expression are applied by their expression (ref: gormquery.ModelClass.applyVirtualFilter).
+*/
+func (mc *ModelClass) applyFilter(qf *QueryFactory, filter skmap.Map) (hasFilter bool) {
 	hasFilter = false
 	if filter == nil {
 		return
 	}
+	whitelistedFields := mc.WhitelistedFields
 	for field, _ := range whitelistedFields {
+		if strings.Contains(field, ".") {
+			// relation field, applied by applyRelationFilter
+			continue
+		}
 		isJsonField := whitelistedFields.GetBoolDefault(fmt.Sprintf("%s.isJsonField", field), false)
 		if isJsonField {
 			filterValue := filter.GetStringArraySafe(field)
@@ -93,10 +226,73 @@ func applyFilter(qf QueryFactory, filter skmap.Map, whitelistedFields skmap.Map)
 			qf.ApplyQuery(field, filterValue)
 		}
 	}
+	hasFilter = mc.applyVirtualFilter(qf, filter) || hasFilter
+	hasFilter = mc.applyRelationFilter(qf, filter) || hasFilter
+	hasFilter = mc.applyFilterOr(qf, filter) || hasFilter
+	return
+}
+
+// filter of whitelisted fields, without relations
+func applyFilter(qf *QueryFactory, filter skmap.Map, whitelistedFields skmap.Map) (hasFilter bool) {
+	modelClass := ModelClass{WhitelistedFields: whitelistedFields}
+	return modelClass.applyFilter(qf, filter)
+}
+
+/*
+Apply "$or" group of filter
+
+The group matches everything if any alternative has no applicable filter, so it is skipped in that case.
+*/
+func (mc *ModelClass) applyFilterOr(qf *QueryFactory, filter skmap.Map) (hasFilter bool) {
+	alternatives, ok := filter.GetDefault(FilterOr, nil).([]any)
+	if !ok || len(alternatives) == 0 {
+		return
+	}
+	var group *gorm.DB
+	for _, alternative := range alternatives {
+		alternativeFilter, ok := alternative.(map[string]any)
+		if !ok {
+			return
+		}
+		alternativeQf := QueryFactory{Query: qf.Query.Session(&gorm.Session{NewDB: true})}
+		if !mc.applyFilter(&alternativeQf, alternativeFilter) {
+			return
+		}
+		if group == nil {
+			group = alternativeQf.Query
+			continue
+		}
+		group = group.Or(alternativeQf.Query)
+	}
+	qf.Query = qf.Query.Where(group)
+	return true
+}
+
+/*
+Construct query of Get / GetOne
+
+Relations are returned to be preloaded after counting. Virtual fields are resolved as relations
+by ApplyFields, so that their dependencies are selected.
+*/
+func newReadQuery(ctx context.Context, db *gorm.DB, modelClass ModelClass, fields []string, filter skmap.Map) (qf QueryFactory, relationFieldMap map[string][]string, hasFilter bool, err error) {
+	qf = QueryFactory{Query: db.WithContext(ctx).Model(modelClass.CreateModelRef())}
+	dependencies := modelClass.relationDependencies()
+	if len(modelClass.VirtualFields) > 0 {
+		var primaryKey string
+		primaryKey, err = primaryKeyOf(db, modelClass.Model)
+		if err != nil {
+			return
+		}
+		for name, virtualDependencies := range modelClass.virtualDependencies(primaryKey) {
+			dependencies[name] = virtualDependencies
+		}
+	}
+	relationFieldMap = qf.ApplyFields(fields, modelClass.QueryComplusoryFields, dependencies)
+	hasFilter = modelClass.applyFilter(&qf, filter)
 	return
 }
 
-func applySortDefs(qf QueryFactory, sortDefs skmap.Map) {
+func applySortDefs(qf *QueryFactory, sortDefs skmap.Map) {
 	for sortField, _ := range sortDefs {
 		sortDef := sortDefs.GetStringDefault(sortField, "ASC")
 		qf.ApplySort(sortField, sortDef)
@@ -112,38 +308,20 @@ options: JSON string
   - fields []string : selected fields
   - page int : page number
   - limit int : page size
+  - cursor string : keyset pagination instead of page, "" for the first page. nextCursor is returned
+    for a full page. At most 1 sort field is supported, with primary key as tie-breaker
   - keyword string : keyword to search (not implemented)
-  - sorter map : sorter description
-  - filter map : filter query (ref: gormquery.applyFilter)
+  - sort map : sort definition, field to "ASC" or "DESC"
+  - filter map : filter query, with operator maps and "$or" alternatives (ref: gormquery.FilterOperators).
+    Values are converted to the types of the model fields (ref: gormquery.ModelClass.coerceFilter)
+  - relations map : limit, sort and filter of selected relations, e.g. {"comments": {"limit": 5, "sort": {"id": "DESC"}}}.
+    limit is per parent record, applied to has-many and many-to-many relations (ref: gormquery.WindowFunctionDialects)
+  - facets []string : whitelisted fields to count records by distinct values, returned in "facets" (ref: gormquery.FacetValue)
+  - format string : format of results, "json" (default), "ndjson" or "csv"
+  - explain bool : return the generated SQL in "explain" (gormquery.Explain) instead of results
+  - explainPlan bool : explain with database EXPLAIN plan, if ModelClass.CanExplainPlan
 
-# Example
-
-	// example of option extractor for GET call
-	func ExtractQueryOption(ctx *gin.Context) (options skmap.Map) {
-		fieldStr := ctx.Query("field")
-		var fields []string
-		if fieldStr != "" {
-			fields = strings.Split(fieldStr, ",")
-		}
-		page, _ := strconv.Atoi(ctx.DefaultQuery("page", "0"))
-		limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "0"))
-		keyword := ctx.DefaultQuery("keyword", "")
-		var sorter skmap.Map
-		sorterBytes := ctx.DefaultQuery("sorter", "{}")
-		json.Unmarshal([]byte(sorterBytes), &sorter)
-		var filter skmap.Map
-		filterBytes := ctx.DefaultQuery("filter", "{}")
-		json.Unmarshal([]byte(filterBytes), &filter)
-		options = skmap.Map{
-			"fields":  fields,
-			"page":    page,
-			"limit":   limit,
-			"keyword": keyword,
-			"sorter":  sorter,
-			"filter":  filter,
-		}
-		return
-	}
+Options could be extracted from query parameters of an HTTP request by gormqueryhttp.ExtractQueryOption
 */
 func (q *QueryServiceServer) Get(ctx context.Context, request *queryService.OptionRequest) (response *queryService.QueryResponse, err error) {
 	options, modelClass, db, err := q.parseOptionRequest(request)
@@ -151,7 +329,11 @@ func (q *QueryServiceServer) Get(ctx context.Context, request *queryService.Opti
 		return
 	}
 	if !modelClass.CanGet {
-		err = errors.New("permission denied")
+		err = status.Error(codes.PermissionDenied, "permission denied")
+		return
+	}
+	err = q.checkRateLimit(ctx, modelClass, OperationGet)
+	if err != nil {
 		return
 	}
 	// transform params
@@ -166,39 +348,290 @@ func (q *QueryServiceServer) Get(ctx context.Context, request *queryService.Opti
 	}
 	filter := options.GetMapDefault("filter", skmap.Map{})
 	sortDefs := options.GetMapDefault("sort", skmap.Map{})
+	modelSchema, err := schemaOf(db, modelClass.Model)
+	if err != nil {
+		return
+	}
+	encoder, err := modelClass.newResultEncoder(modelSchema, options)
+	if err != nil {
+		return
+	}
+	// guardrails
+	limit, err = modelClass.Limits.pageSize(limit)
+	if err != nil {
+		return
+	}
+	relationScopes, err := modelClass.parseRelationScopes(options)
+	if err != nil {
+		return
+	}
+	err = modelClass.Limits.checkRelations(modelClass.queryRelations(fields, filter, relationScopes))
+	if err != nil {
+		return
+	}
+	facets, err := modelClass.parseFacets(options)
+	if err != nil {
+		return
+	}
+	err = modelClass.Limits.checkFilter(filter)
+	if err != nil {
+		return
+	}
+	// read-your-writes requests read the primary and bypass cached results
+	readYourWrites := isReadYourWrites(ctx, options)
+	exportPage, exporting := exportPageOf(ctx)
+	readDb := db
+	if !exporting {
+		readDb = q.readDb(ctx, options, modelClass, db)
+	}
+	// a replica could be behind a recent write, which should not be cached until the cache is invalidated again
+	laggingReplica := readDb != db && q.withinReplicaLag(modelClass)
+	db = readDb
+	// cache
+	explain := isExplain(options)
+	useCache := q.Cache != nil && modelClass.CacheTTL > 0 && !explain && !exporting
+	var cacheKey string
+	if useCache {
+		cacheKey, err = resultCacheKey(modelClass.name, options)
+		if err != nil {
+			return
+		}
+		if cached, ok := q.Cache.Get(cacheKey); ok && !readYourWrites {
+			response = &queryService.QueryResponse{}
+			if proto.Unmarshal(cached, response) == nil {
+				return
+			}
+		}
+		defer func() {
+			if err != nil || laggingReplica {
+				return
+			}
+			if bytes, err := proto.Marshal(response); err == nil {
+				q.Cache.Set(cacheKey, modelClass.name, bytes, modelClass.CacheTTL)
+			}
+		}()
+	}
+	ctx, cancel := modelClass.Limits.withTimeout(ctx)
+	defer cancel()
+	defer func() { err = timeoutError(ctx, err) }()
+	// keyset pagination replaces page offset
+	cursor, cursorMode := options.GetDefault("cursor", nil).(string)
+	var cursorKeyset *keyset
+	readModelClass := modelClass
+	if cursorMode {
+		cursorKeyset, err = newKeyset(db, modelClass, sortDefs, cursor)
+		if err != nil {
+			return
+		}
+		// the next cursor is read from the last row, which requires the keyset columns
+		readModelClass.QueryComplusoryFields = append(cursorKeyset.columns(), modelClass.QueryComplusoryFields...)
+	}
 	// construct query
-	qf := QueryFactory{Query: db.WithContext(ctx).Model(modelClass.CreateModelRef())}
-	// apply fields
-	qf.ApplyFields(fields, modelClass.QueryComplusoryFields, map[string][]string{})
-	applyFilter(qf, filter, modelClass.WhitelistedFields)
-	applySortDefs(qf, sortDefs)
-	// get query
-	query := qf.Query
-	// count
-	var totalCountInt int64
-	err = query.Count(&totalCountInt).Error
+	qf, relationFieldMap, _, err := newReadQuery(ctx, db, readModelClass, fields, filter)
 	if err != nil {
 		return
 	}
-	totalCount := uint64(totalCountInt)
-	// pagination
-	if limit != 0 {
-		query = query.Limit(limit).Offset(limit * page)
+	applySortDefs(&qf, modelClass.virtualSortDefs(sortDefs))
+	paginate := func(query *gorm.DB) *gorm.DB {
+		if cursorKeyset != nil {
+			query = cursorKeyset.apply(query)
+			page = 0
+		}
+		if limit != 0 {
+			query = query.Limit(limit).Offset(limit * page)
+		}
+		return query
+	}
+	if explain {
+		var explainBytes []byte
+		explainBytes, err = modelClass.explain(qf.Query, options, func(tx *gorm.DB) *gorm.DB {
+			return paginate(tx).Find(modelClass.CreateModelArrayPtr())
+		})
+		response = &queryService.QueryResponse{Explain: explainBytes}
+		return
+	}
+	// count
+	var totalCount uint64
+	var facetsBytes []byte
+	if !exportPage.counted {
+		var totalCountInt int64
+		err = qf.Query.Count(&totalCountInt).Error
+		if err != nil {
+			return
+		}
+		totalCount = uint64(totalCountInt)
+		facetsBytes, err = modelClass.facetCounts(ctx, db, facets, filter)
+		if err != nil {
+			return
+		}
 	}
+	// relations
+	loadRelations := modelClass.applyRelations(&qf, relationFieldMap, relationScopes)
+	// get query
+	query := qf.Query
+	// pagination
+	query = paginate(query)
 	// var results []skmap.Hash
-	results := modelClass.CreateModelArrayRef()
-	err = query.Find(&results).Error
+	results := modelClass.CreateModelArrayPtr()
+	err = query.Find(results).Error
+	if err != nil {
+		return
+	}
+	err = loadRelations(results)
 	if err != nil {
 		return
 	}
+	// a full page may be followed by more rows
+	var nextCursor string
+	if cursorKeyset != nil && limit != 0 && reflect.ValueOf(results).Elem().Len() == limit {
+		nextCursor, err = cursorKeyset.next(ctx, results)
+		if err != nil {
+			return
+		}
+	}
 	resultsBytes, err := json.Marshal(results)
 	if err != nil {
 		return
 	}
+	resultsBytes, err = modelClass.applyVirtualFields(ctx, db, resultsBytes, modelClass.selectedVirtualFields(fields, relationFieldMap))
+	if err != nil {
+		return
+	}
+	resultsBytes, err = modelClass.aliasResult(modelSchema, resultsBytes)
+	if err != nil {
+		return
+	}
+	if encoder.format != ResultFormatJson {
+		resultsBytes, err = encoder.encode(resultsBytes)
+		if err != nil {
+			return
+		}
+		resultsBytes = append(resultsBytes, encoder.finish()...)
+	}
 	// return
 	response = &queryService.QueryResponse{
 		TotalCount: totalCount,
 		Results:    resultsBytes,
+		NextCursor: nextCursor,
+		Facets:     facetsBytes,
+	}
+	return
+}
+
+/*
+Perform "Read" operation of a single record
+
+# Input
+
+options: JSON string
+  - id any : primary key of the record, converted to the type of the primary field
+  - filter map : unique filter query, used if "id" is not provided (ref: gormquery.applyFilter)
+  - fields []string : selected fields, including relations
+  - relations map : limit, sort and filter of selected relations, as Get
+
+# Output
+
+NotFound if no record matches, FailedPrecondition if more than 1 record match
+*/
+func (q *QueryServiceServer) GetOne(ctx context.Context, request *queryService.OptionRequest) (response *queryService.GetOneResponse, err error) {
+	options, modelClass, db, err := q.parseOptionRequest(request)
+	if err != nil {
+		return
+	}
+	if !modelClass.CanGet {
+		err = status.Error(codes.PermissionDenied, "permission denied")
+		return
+	}
+	err = q.checkRateLimit(ctx, modelClass, OperationGetOne)
+	if err != nil {
+		return
+	}
+	// transform params
+	fields := options.GetStringArraySafe("fields")
+	id := options.GetDefault("id", nil)
+	filter := options.GetMapDefault("filter", nil)
+	// guardrails
+	relationScopes, err := modelClass.parseRelationScopes(options)
+	if err != nil {
+		return
+	}
+	err = modelClass.Limits.checkRelations(modelClass.queryRelations(fields, filter, relationScopes))
+	if err != nil {
+		return
+	}
+	err = modelClass.Limits.checkFilter(filter)
+	if err != nil {
+		return
+	}
+	db = q.readDb(ctx, options, modelClass, db)
+	ctx, cancel := modelClass.Limits.withTimeout(ctx)
+	defer cancel()
+	defer func() { err = timeoutError(ctx, err) }()
+	// construct query
+	qf, relationFieldMap, hasFilter, err := newReadQuery(ctx, db, modelClass, fields, filter)
+	if err != nil {
+		return
+	}
+	if id != nil {
+		var primaryField *schema.Field
+		primaryField, err = primaryFieldOf(db, modelClass.Model)
+		if err != nil {
+			return
+		}
+		id, err = coerceValue(primaryField, id)
+		if err != nil {
+			err = status.Errorf(codes.InvalidArgument, "invalid id: %v", err)
+			return
+		}
+		qf.ApplyQuery(primaryField.DBName, id)
+	} else if !hasFilter {
+		err = status.Error(codes.InvalidArgument, "missing id or filter")
+		return
+	}
+	loadRelations := modelClass.applyRelations(&qf, relationFieldMap, relationScopes)
+	// 2 records are enough to tell whether the filter is unique
+	results := modelClass.CreateModelArrayPtr()
+	err = qf.Query.Limit(2).Find(results).Error
+	if err != nil {
+		return
+	}
+	resultsValue := reflect.ValueOf(results).Elem()
+	switch resultsValue.Len() {
+	case 0:
+		err = status.Error(codes.NotFound, "record not found")
+		return
+	case 1:
+	default:
+		err = status.Error(codes.FailedPrecondition, "more than 1 record found")
+		return
+	}
+	err = loadRelations(results)
+	if err != nil {
+		return
+	}
+	resultsBytes, err := json.Marshal(results)
+	if err != nil {
+		return
+	}
+	resultsBytes, err = modelClass.applyVirtualFields(ctx, db, resultsBytes, modelClass.selectedVirtualFields(fields, relationFieldMap))
+	if err != nil {
+		return
+	}
+	var records []json.RawMessage
+	err = json.Unmarshal(resultsBytes, &records)
+	if err != nil {
+		return
+	}
+	modelSchema, err := schemaOf(db, modelClass.Model)
+	if err != nil {
+		return
+	}
+	resultBytes, err := modelClass.aliasResult(modelSchema, records[0])
+	if err != nil {
+		return
+	}
+	response = &queryService.GetOneResponse{
+		Result: resultBytes,
 	}
 	return
 }
@@ -210,6 +643,8 @@ Perform "Create" operation
 
 options: JSON string
   - data map : record data
+  - idempotencyKey string : replay the response of a previous request with the same key,
+    if QueryServiceServer.Idempotency is set. gRPC metadata "x-idempotency-key" could be used as well
 */
 func (q *QueryServiceServer) Create(ctx context.Context, request *queryService.OptionRequest) (response *queryService.CreateResponse, err error) {
 	options, modelClass, db, err := q.parseOptionRequest(request)
@@ -217,22 +652,85 @@ func (q *QueryServiceServer) Create(ctx context.Context, request *queryService.O
 		return
 	}
 	if !modelClass.CanCreate {
-		err = errors.New("permission denied")
+		err = status.Error(codes.PermissionDenied, "permission denied")
+		return
+	}
+	err = q.checkRateLimit(ctx, modelClass, OperationCreate)
+	if err != nil {
 		return
 	}
 	data := options.GetMapDefault("data", nil)
-	if data == nil {
-		err = errors.New("missing data")
+	err = modelClass.validateCreateData(data)
+	if err != nil {
 		return
 	}
 	dataHash := helper.CastDataMap(data)
-	err = db.WithContext(ctx).Model(modelClass.CreateModelRef()).Create(&dataHash).Error
+	err = fillAutoTime(db, modelClass, dataHash)
 	if err != nil {
 		return
 	}
-	dataBytes, err := json.Marshal(dataHash)
-	response = &queryService.CreateResponse{
-		Result: dataBytes,
+	idempotent, err := q.newIdempotency(ctx, modelClass, options)
+	if err != nil {
+		return
+	}
+	ctx, cancel := modelClass.Limits.withTimeout(ctx)
+	defer cancel()
+	defer func() { err = timeoutError(ctx, err) }()
+	replayed := false
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// response of a repeated idempotency key
+		replayBytes, ok, err := idempotent.replay(tx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			replayed = true
+			response = &queryService.CreateResponse{}
+			return proto.Unmarshal(replayBytes, response)
+		}
+		auditor := newAuditor(ctx, tx, modelClass, AuditOperationCreate, nil)
+		err = tx.Model(modelClass.CreateModelRef()).Create(&dataHash).Error
+		if err != nil {
+			return err
+		}
+		after, err := auditor.snapshotCreated([]map[string]any{dataHash})
+		if err != nil {
+			return err
+		}
+		err = auditor.record(after)
+		if err != nil {
+			return err
+		}
+		dataBytes, err := json.Marshal(dataHash)
+		if err != nil {
+			return err
+		}
+		dataBytes, err = modelClass.aliasData(dataBytes)
+		if err != nil {
+			return err
+		}
+		response = &queryService.CreateResponse{
+			Result: dataBytes,
+		}
+		responseBytes, err := proto.Marshal(response)
+		if err != nil {
+			return err
+		}
+		return idempotent.record(tx, responseBytes)
+	})
+	if err != nil {
+		response = nil
+		var replayBytes []byte
+		replayBytes, err = idempotent.replayConflict(db.WithContext(ctx), err)
+		if err != nil {
+			return
+		}
+		response = &queryService.CreateResponse{}
+		err = proto.Unmarshal(replayBytes, response)
+		return
+	}
+	if !replayed {
+		q.invalidateCache(db, modelClass)
 	}
 	return
 }
@@ -245,40 +743,124 @@ Perform "Update" operation
 options: JSON string
   - data map : record data
   - filter map : filter query (ref: gormquery.applyFilter)
+  - jsonMerge bool : objects of JSON fields in data are merge patches updated in place (ref: gormquery.ModelClass.applyJsonMerge)
+  - idempotencyKey string : replay the response of a previous request with the same key, as Create does.
+    A merge patch is not idempotent itself, e.g. "$append", so a retried jsonMerge update should carry a key
+  - explain bool : return the generated SQL without executing the update
+  - explainPlan bool : explain with database EXPLAIN plan, if ModelClass.CanExplainPlan
 */
-func (q *QueryServiceServer) Update(ctx context.Context, request *queryService.OptionRequest) (response *queryService.Empty, err error) {
+func (q *QueryServiceServer) Update(ctx context.Context, request *queryService.OptionRequest) (response *queryService.WriteResponse, err error) {
 	options, modelClass, db, err := q.parseOptionRequest(request)
 	if err != nil {
 		return
 	}
 	if !modelClass.CanUpdate {
-		err = errors.New("permission denied")
+		err = status.Error(codes.PermissionDenied, "permission denied")
+		return
+	}
+	err = q.checkRateLimit(ctx, modelClass, OperationUpdate)
+	if err != nil {
 		return
 	}
 	filter := options.GetMapDefault("filter", nil)
 	if filter == nil {
-		err = errors.New("missing filter")
+		err = status.Error(codes.InvalidArgument, "missing filter")
 		return
 	}
 	data := options.GetMapDefault("data", nil)
 	if data == nil {
-		err = errors.New("missing data")
+		err = status.Error(codes.InvalidArgument, "missing data")
 		return
 	}
 	dataHash := helper.CastDataMap(data)
-	// construct query
-	qf := QueryFactory{Query: db.WithContext(ctx).Model(modelClass.CreateModelRef())}
-	// apply filter
-	hasFilter := applyFilter(qf, filter, modelClass.WhitelistedFields)
-	if !hasFilter {
-		err = errors.New("missing filter")
+	err = modelClass.Limits.checkFilter(filter)
+	if err != nil {
 		return
 	}
-	// get query
-	query := qf.Query
-	// update
-	err = query.Updates(dataHash).Error
-	response = &queryService.Empty{}
+	if options.GetBoolDefault("jsonMerge", false) {
+		err = modelClass.applyJsonMerge(db.Dialector.Name(), dataHash)
+		if err != nil {
+			return
+		}
+	}
+	ctx, cancel := modelClass.Limits.withTimeout(ctx)
+	defer cancel()
+	defer func() { err = timeoutError(ctx, err) }()
+	if isExplain(options) {
+		qf := QueryFactory{Query: db.WithContext(ctx).Model(modelClass.CreateModelRef())}
+		if !modelClass.applyFilter(&qf, filter) {
+			err = status.Error(codes.InvalidArgument, "missing filter")
+			return
+		}
+		var explainBytes []byte
+		explainBytes, err = modelClass.explain(qf.Query, options, func(tx *gorm.DB) *gorm.DB {
+			return tx.Updates(dataHash)
+		})
+		response = &queryService.WriteResponse{Explain: explainBytes}
+		return
+	}
+	idempotent, err := q.newIdempotency(ctx, modelClass, options)
+	if err != nil {
+		return
+	}
+	replayed := false
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// response of a repeated idempotency key
+		replayBytes, ok, err := idempotent.replay(tx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			replayed = true
+			response = &queryService.WriteResponse{}
+			return proto.Unmarshal(replayBytes, response)
+		}
+		// construct query
+		qf := QueryFactory{Query: tx.Model(modelClass.CreateModelRef())}
+		// apply filter
+		hasFilter := modelClass.applyFilter(&qf, filter)
+		if !hasFilter {
+			return status.Error(codes.InvalidArgument, "missing filter")
+		}
+		auditor := newAuditor(ctx, tx, modelClass, AuditOperationUpdate, filter)
+		err = auditor.snapshotBefore()
+		if err != nil {
+			return err
+		}
+		// update
+		err = qf.Query.Updates(dataHash).Error
+		if err != nil {
+			return err
+		}
+		after, err := auditor.snapshotAfter()
+		if err != nil {
+			return err
+		}
+		err = auditor.record(after)
+		if err != nil {
+			return err
+		}
+		response = &queryService.WriteResponse{}
+		responseBytes, err := proto.Marshal(response)
+		if err != nil {
+			return err
+		}
+		return idempotent.record(tx, responseBytes)
+	})
+	if err != nil {
+		response = nil
+		var replayBytes []byte
+		replayBytes, err = idempotent.replayConflict(db.WithContext(ctx), err)
+		if err != nil {
+			return
+		}
+		response = &queryService.WriteResponse{}
+		err = proto.Unmarshal(replayBytes, response)
+		return
+	}
+	if !replayed {
+		q.invalidateCache(db, modelClass)
+	}
 	return
 }
 
@@ -289,33 +871,70 @@ Perform "Delete" operation
 
 options: JSON string
   - filter map : filter query (ref: gormquery.applyFilter)
+  - explain bool : return the generated SQL without executing the delete
+  - explainPlan bool : explain with database EXPLAIN plan, if ModelClass.CanExplainPlan
 */
-func (q *QueryServiceServer) Delete(ctx context.Context, request *queryService.OptionRequest) (response *queryService.Empty, err error) {
+func (q *QueryServiceServer) Delete(ctx context.Context, request *queryService.OptionRequest) (response *queryService.WriteResponse, err error) {
 	options, modelClass, db, err := q.parseOptionRequest(request)
 	if err != nil {
 		return
 	}
 	if !modelClass.CanDelete {
-		err = errors.New("permission denied")
+		err = status.Error(codes.PermissionDenied, "permission denied")
+		return
+	}
+	err = q.checkRateLimit(ctx, modelClass, OperationDelete)
+	if err != nil {
 		return
 	}
 	filter := options.GetMapDefault("filter", nil)
 	if filter == nil {
-		err = errors.New("missing filter")
+		err = status.Error(codes.InvalidArgument, "missing filter")
 		return
 	}
-	// construct query
-	qf := QueryFactory{Query: db.WithContext(ctx)}
-	// apply filter
-	hasFilter := applyFilter(qf, filter, modelClass.WhitelistedFields)
-	if !hasFilter {
-		err = errors.New("missing filter")
+	err = modelClass.Limits.checkFilter(filter)
+	if err != nil {
 		return
 	}
-	//
-	query := qf.Query
-	//
-	err = query.Delete(modelClass.CreateModelRef()).Error
-	response = &queryService.Empty{}
+	ctx, cancel := modelClass.Limits.withTimeout(ctx)
+	defer cancel()
+	defer func() { err = timeoutError(ctx, err) }()
+	if isExplain(options) {
+		qf := QueryFactory{Query: db.WithContext(ctx).Model(modelClass.CreateModelRef())}
+		if !modelClass.applyFilter(&qf, filter) {
+			err = status.Error(codes.InvalidArgument, "missing filter")
+			return
+		}
+		var explainBytes []byte
+		explainBytes, err = modelClass.explain(qf.Query, options, func(tx *gorm.DB) *gorm.DB {
+			return tx.Delete(modelClass.CreateModelRef())
+		})
+		response = &queryService.WriteResponse{Explain: explainBytes}
+		return
+	}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// construct query
+		qf := QueryFactory{Query: tx.Model(modelClass.CreateModelRef())}
+		// apply filter
+		hasFilter := modelClass.applyFilter(&qf, filter)
+		if !hasFilter {
+			return status.Error(codes.InvalidArgument, "missing filter")
+		}
+		auditor := newAuditor(ctx, tx, modelClass, AuditOperationDelete, filter)
+		err := auditor.snapshotBefore()
+		if err != nil {
+			return err
+		}
+		//
+		err = qf.Query.Delete(modelClass.CreateModelRef()).Error
+		if err != nil {
+			return err
+		}
+		return auditor.record(nil)
+	})
+	if err == nil {
+		q.invalidateCache(db, modelClass)
+	}
+	response = &queryService.WriteResponse{}
 	return
 }
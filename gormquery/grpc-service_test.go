@@ -0,0 +1,72 @@
+package gormquery
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/levav-enspiren/common-go/gormquery/queryService"
+	"github.com/levav-enspiren/common-go/skmap"
+	"google.golang.org/grpc/codes"
+)
+
+func TestGetOne(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{})
+	getOne := func(options skmap.Map) (item testItem, err error) {
+		response, err := server.GetOne(testCtx, optionRequest(options))
+		if err != nil {
+			return
+		}
+		expectNoError(t, json.Unmarshal(response.Result, &item))
+		return
+	}
+
+	item, err := getOne(skmap.Map{"id": 2})
+	expectNoError(t, err)
+	expectEqual(t, "name of id 2", "b", item.Name)
+	item, err = getOne(skmap.Map{"id": "2"})
+	expectNoError(t, err)
+	expectEqual(t, "name of id \"2\"", "b", item.Name)
+	item, err = getOne(skmap.Map{"filter": skmap.Map{"name": "c"}})
+	expectNoError(t, err)
+	expectEqual(t, "price of name c", 3, item.Price)
+
+	_, err = getOne(skmap.Map{"id": 10})
+	expectCode(t, "missing id", codes.NotFound, err)
+	_, err = getOne(skmap.Map{"filter": skmap.Map{"category_id": 1}})
+	expectCode(t, "filter of 2 records", codes.FailedPrecondition, err)
+	_, err = getOne(skmap.Map{})
+	expectCode(t, "without id or filter", codes.InvalidArgument, err)
+	_, err = getOne(skmap.Map{"id": "abc"})
+	expectCode(t, "id of other type", codes.InvalidArgument, err)
+
+	server.ModelClasses["item"] = ModelClass{Model: testItem{}}
+	_, err = getOne(skmap.Map{"id": 1})
+	expectCode(t, "without CanGet", codes.PermissionDenied, err)
+}
+
+func TestGetOneLargeId(t *testing.T) {
+	db := newTestDb(t)
+	expectNoError(t, db.AutoMigrate(&testBigRecord{}))
+	// ids above 2^53 are not exact in float64
+	expectNoError(t, db.Create(&[]testBigRecord{{ID: 9007199254740993, Name: "odd"}, {ID: 9007199254740992, Name: "even"}}).Error)
+	server := newTestServer(db, ModelClass{Model: testBigRecord{}, WhitelistedFields: skmap.Map{"id": true, "name": true}})
+	response, err := server.GetOne(testCtx, &queryService.OptionRequest{Options: []byte(`{"id": 9007199254740993}`)})
+	expectNoError(t, err)
+	record := testBigRecord{}
+	expectNoError(t, json.Unmarshal(response.Result, &record))
+	expectEqual(t, "name", "odd", record.Name)
+}
+
+func TestGetOneRelations(t *testing.T) {
+	db := newTestDb(t)
+	server := newTestServer(db, ModelClass{Relations: map[string]ModelRelation{
+		"category": {Association: "Category", Dependencies: []string{"category_id"}, QueryComplusoryFields: []string{"id"}},
+	}})
+	response, err := server.GetOne(testCtx, optionRequest(skmap.Map{"id": 3, "fields": []string{"id", "category.name"}}))
+	expectNoError(t, err)
+	item := testItem{}
+	expectNoError(t, json.Unmarshal(response.Result, &item))
+	expect(t, "category is preloaded", item.Category != nil)
+	expectEqual(t, "category name", "y", item.Category.Name)
+}
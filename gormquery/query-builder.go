@@ -0,0 +1,306 @@
+package gormquery
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/levav-enspiren/common-go/skmap"
+)
+
+/*
+Builder of query options, for QueryServiceModel or a local QueryFactory
+
+The first error of the chain, e.g. unknown operator, is reported by Options / Apply.
+
+Example
+
+	options, err := gormquery.NewQueryBuilder().
+		Fields("id", "name", "item.item_name").
+		Where("price", ">=", 10).
+		Where("tags", "in", []string{"a", "b"}).
+		Or(
+			gormquery.NewQueryBuilder().Where("name", "like", "a%"),
+			gormquery.NewQueryBuilder().Where("obsoleted", "=", false),
+		).
+		OrderBy("price", "desc").
+		Limit(20).
+		Options()
+	results, totalCount, err := QueryServiceModel.Get(ctx, options)
+*/
+type QueryBuilder struct {
+	fields       []string
+	filter       map[string]any
+	alternatives []any
+	sort         skmap.Map
+	page         int
+	limit        int
+	cursor       *string
+	firstErr     error
+}
+
+// operator of Where to operator of filter (ref: gormquery.FilterOperators)
+var builderOperators = map[string]string{
+	"=":        "eq",
+	"!=":       "ne",
+	"<>":       "ne",
+	">":        "gt",
+	">=":       "gte",
+	"<":        "lt",
+	"<=":       "lte",
+	"in":       "in",
+	"not in":   "nin",
+	"like":     "like",
+	"is null":  "null",
+	"not null": "null",
+}
+
+func NewQueryBuilder() *QueryBuilder {
+	return &QueryBuilder{
+		filter: map[string]any{},
+		sort:   skmap.Map{},
+	}
+}
+
+// selected fields, including "relation" or "relation.subField"
+func (b *QueryBuilder) Fields(fields ...string) *QueryBuilder {
+	b.fields = append(b.fields, fields...)
+	return b
+}
+
+/*
+Add filter condition. Conditions are combined with AND
+
+op: "=", "!=", ">", ">=", "<", "<=", "in", "not in", "like", "is null", "not null",
+or an operator of gormquery.FilterOperators. value is ignored for "is null" / "not null".
+*/
+func (b *QueryBuilder) Where(field string, op string, value any) *QueryBuilder {
+	if field == "" || field == FilterOr {
+		b.fail(fmt.Errorf("invalid filter field %q", field))
+		return b
+	}
+	normalizedOp := strings.ToLower(strings.TrimSpace(op))
+	operator, ok := builderOperators[normalizedOp]
+	if !ok {
+		if _, ok = FilterOperators[normalizedOp]; !ok {
+			b.fail(fmt.Errorf("unknown operator %q of %s", op, field))
+			return b
+		}
+		operator = normalizedOp
+	}
+	switch normalizedOp {
+	case "is null":
+		value = true
+	case "not null":
+		value = false
+	}
+	value = builderValue(value)
+	operators := map[string]any{}
+	switch existing := b.filter[field].(type) {
+	case nil:
+	case map[string]any:
+		operators = existing
+	default:
+		// plain value of a previous condition
+		operators["eq"] = existing
+		if _, ok := existing.([]any); ok {
+			operators = map[string]any{"in": existing}
+		}
+	}
+	if _, ok := operators[operator]; ok {
+		b.fail(fmt.Errorf("duplicated operator %q of %s", op, field))
+		return b
+	}
+	operators[operator] = value
+	// single equality is kept as plain value, the original filter format
+	if len(operators) == 1 && operator == "eq" {
+		b.filter[field] = value
+		return b
+	}
+	b.filter[field] = operators
+	return b
+}
+
+/*
+Add alternatives of filter, each built by Where of another builder
+
+Alternatives of all Or calls form a single OR group, which is combined with other conditions with AND.
+*/
+func (b *QueryBuilder) Or(alternatives ...*QueryBuilder) *QueryBuilder {
+	for _, alternative := range alternatives {
+		if alternative == nil {
+			continue
+		}
+		if alternative.firstErr != nil {
+			b.fail(alternative.firstErr)
+		}
+		alternativeFilter := alternative.buildFilter()
+		if len(alternativeFilter) == 0 {
+			b.fail(errors.New("empty alternative of Or"))
+			continue
+		}
+		b.alternatives = append(b.alternatives, alternativeFilter)
+	}
+	return b
+}
+
+/*
+Sort by the field. direction: "asc" or "desc", case-insensitive
+
+Only 1 sort field is supported, since "sort" is a map of options, which does not keep the order
+of fields. OrderBy of another field is an error, while OrderBy of the same field replaces its direction.
+*/
+func (b *QueryBuilder) OrderBy(field string, direction string) *QueryBuilder {
+	sortDef := strings.ToUpper(strings.TrimSpace(direction))
+	if sortDef != "ASC" && sortDef != "DESC" {
+		b.fail(fmt.Errorf("unknown sort direction %q of %s", direction, field))
+		return b
+	}
+	if _, ok := b.sort[field]; !ok && len(b.sort) > 0 {
+		b.fail(fmt.Errorf("sort of %s after another field, only 1 sort field is supported", field))
+		return b
+	}
+	b.sort[field] = sortDef
+	return b
+}
+
+// page index, from 0
+func (b *QueryBuilder) Page(page int) *QueryBuilder {
+	if page < 0 {
+		b.fail(fmt.Errorf("invalid page %d", page))
+		return b
+	}
+	b.page = page
+	return b
+}
+
+// page size
+func (b *QueryBuilder) Limit(limit int) *QueryBuilder {
+	if limit < 0 {
+		b.fail(fmt.Errorf("invalid limit %d", limit))
+		return b
+	}
+	b.limit = limit
+	return b
+}
+
+// keyset pagination from nextCursor of previous page, "" for the first page
+func (b *QueryBuilder) Cursor(cursor string) *QueryBuilder {
+	b.cursor = &cursor
+	return b
+}
+
+// keep the first error of the chain
+func (b *QueryBuilder) fail(err error) {
+	if b.firstErr == nil {
+		b.firstErr = err
+	}
+}
+
+func (b *QueryBuilder) err() error {
+	if b.firstErr != nil {
+		return b.firstErr
+	}
+	if b.cursor != nil {
+		if b.page > 0 {
+			return errors.New("cursor and page are exclusive")
+		}
+	}
+	return ValidateFilter(b.buildFilter())
+}
+
+func (b *QueryBuilder) buildFilter() map[string]any {
+	filter := map[string]any{}
+	for field, value := range b.filter {
+		filter[field] = value
+	}
+	if len(b.alternatives) > 0 {
+		filter[FilterOr] = b.alternatives
+	}
+	return filter
+}
+
+// options of QueryServiceModel.Get / GetOne / Update / Delete / Export
+func (b *QueryBuilder) Options() (options skmap.Map, err error) {
+	err = b.err()
+	if err != nil {
+		return
+	}
+	options = skmap.Map{}
+	if len(b.fields) > 0 {
+		options["fields"] = b.fields
+	}
+	if filter := b.buildFilter(); len(filter) > 0 {
+		options["filter"] = filter
+	}
+	if len(b.sort) > 0 {
+		options["sort"] = b.sort
+	}
+	if b.page > 0 {
+		options["page"] = b.page
+	}
+	if b.limit > 0 {
+		options["limit"] = b.limit
+	}
+	if b.cursor != nil {
+		options["cursor"] = *b.cursor
+	}
+	return
+}
+
+/*
+Apply fields, filter, sort and pagination to a local query factory
+
+Fields are selected as is, without relations, and cursor is not supported locally.
+*/
+func (b *QueryBuilder) Apply(qf *QueryFactory) (err error) {
+	err = b.err()
+	if err != nil {
+		return
+	}
+	if b.cursor != nil {
+		return errors.New("cursor is not supported by QueryFactory")
+	}
+	qf.ApplyFields(b.fields, nil, nil)
+	filter := b.buildFilter()
+	applyFilter(qf, filter, filterFieldsOf(filter))
+	applySortDefs(qf, b.sort)
+	if b.limit > 0 {
+		qf.Query = qf.Query.Limit(b.limit).Offset(b.limit * b.page)
+	}
+	return
+}
+
+// all fields of filter, including those of "$or" alternatives, as whitelisted fields
+func filterFieldsOf(filter map[string]any) skmap.Map {
+	fields := skmap.Map{}
+	for field, value := range filter {
+		if field != FilterOr {
+			fields[field] = true
+			continue
+		}
+		alternatives, _ := value.([]any)
+		for _, alternative := range alternatives {
+			if alternativeFilter, ok := alternative.(map[string]any); ok {
+				for alternativeField := range filterFieldsOf(alternativeFilter) {
+					fields[alternativeField] = true
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// slices of any element type are converted to []any, the type of decoded JSON arrays
+func builderValue(value any) any {
+	reflectValue := reflect.ValueOf(value)
+	if reflectValue.Kind() != reflect.Slice || reflectValue.Type().Elem().Kind() == reflect.Uint8 {
+		return value
+	}
+	values := make([]any, reflectValue.Len())
+	for i := range values {
+		values[i] = reflectValue.Index(i).Interface()
+	}
+	return values
+}
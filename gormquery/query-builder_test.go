@@ -0,0 +1,82 @@
+package gormquery
+
+import (
+	"testing"
+
+	"github.com/levav-enspiren/common-go/skmap"
+)
+
+func TestQueryBuilderOptions(t *testing.T) {
+	options, err := NewQueryBuilder().
+		Fields("id", "name").
+		Where("name", "=", "a").
+		Where("price", ">=", 1).
+		Where("price", "<", 10).
+		Where("category_id", "in", []uint{1, 2}).
+		Where("deleted_at", "is null", nil).
+		Or(
+			NewQueryBuilder().Where("name", "like", "a%"),
+			NewQueryBuilder().Where("price", "!=", 0),
+		).
+		OrderBy("price", "desc").
+		Page(1).
+		Limit(20).
+		Options()
+	expectNoError(t, err)
+	expectEqual(t, "options", skmap.Map{
+		"fields": []string{"id", "name"},
+		"filter": map[string]any{
+			"name":        "a",
+			"price":       map[string]any{"gte": 1, "lt": 10},
+			"category_id": map[string]any{"in": []any{uint(1), uint(2)}},
+			"deleted_at":  map[string]any{"null": true},
+			FilterOr:      []any{map[string]any{"name": map[string]any{"like": "a%"}}, map[string]any{"price": map[string]any{"ne": 0}}},
+		},
+		"sort":  skmap.Map{"price": "DESC"},
+		"page":  1,
+		"limit": 20,
+	}, options)
+
+	options, err = NewQueryBuilder().Where("price", "=", 1).Where("price", "lt", 10).Cursor("").Options()
+	expectNoError(t, err)
+	expectEqual(t, "options of cursor", skmap.Map{"filter": map[string]any{"price": map[string]any{"eq": 1, "lt": 10}}, "cursor": ""}, options)
+}
+
+func TestQueryBuilderErrors(t *testing.T) {
+	builders := map[string]*QueryBuilder{
+		"unknown operator":     NewQueryBuilder().Where("price", "between", 1),
+		"duplicated operator":  NewQueryBuilder().Where("price", ">", 1).Where("price", ">", 2),
+		"$or field":            NewQueryBuilder().Where(FilterOr, "=", 1),
+		"unknown sort":         NewQueryBuilder().OrderBy("price", "up"),
+		"negative page":        NewQueryBuilder().Page(-1),
+		"negative limit":       NewQueryBuilder().Limit(-1),
+		"empty alternative":    NewQueryBuilder().Or(NewQueryBuilder()),
+		"error of alternative": NewQueryBuilder().Or(NewQueryBuilder().Where("price", "between", 1)),
+		"cursor and page":      NewQueryBuilder().Page(1).Cursor(""),
+		"2 sort fields":        NewQueryBuilder().OrderBy("price", "asc").OrderBy("name", "asc"),
+		"in without array":     NewQueryBuilder().Where("price", "in", 1),
+	}
+	for description, builder := range builders {
+		_, err := builder.Options()
+		expect(t, description, err != nil)
+	}
+}
+
+func TestQueryBuilderApply(t *testing.T) {
+	db := newTestDb(t)
+	names := func(builder *QueryBuilder) (names []string) {
+		qf := QueryFactory{Query: db.Model(&testItem{})}
+		expectNoError(t, builder.Apply(&qf))
+		expectNoError(t, qf.Query.Pluck("name", &names).Error)
+		return
+	}
+	expectEqual(t, "names", []string{"c", "b"}, names(NewQueryBuilder().Where("price", ">", 1).OrderBy("price", "desc")))
+	expectEqual(t, "names of replaced direction", []string{"a", "b", "c"}, names(NewQueryBuilder().OrderBy("price", "desc").OrderBy("price", "asc")))
+	expectEqual(t, "names of Or", []string{"a", "c"}, names(NewQueryBuilder().
+		Or(NewQueryBuilder().Where("name", "=", "a"), NewQueryBuilder().Where("price", ">=", 3)).
+		OrderBy("name", "asc")))
+	expectEqual(t, "names of page", []string{"b"}, names(NewQueryBuilder().OrderBy("name", "asc").Limit(1).Page(1)))
+
+	qf := QueryFactory{Query: db.Model(&testItem{})}
+	expect(t, "cursor of Apply", NewQueryBuilder().Cursor("").Apply(&qf) != nil)
+}
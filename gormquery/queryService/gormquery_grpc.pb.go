@@ -23,9 +23,12 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type QueryServiceClient interface {
 	Get(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+	GetOne(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*GetOneResponse, error)
 	Create(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*CreateResponse, error)
-	Update(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*Empty, error)
-	Delete(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*Empty, error)
+	Update(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*WriteResponse, error)
+	Delete(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*WriteResponse, error)
+	Import(ctx context.Context, opts ...grpc.CallOption) (QueryService_ImportClient, error)
+	Export(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (QueryService_ExportClient, error)
 }
 
 type queryServiceClient struct {
@@ -45,6 +48,15 @@ func (c *queryServiceClient) Get(ctx context.Context, in *OptionRequest, opts ..
 	return out, nil
 }
 
+func (c *queryServiceClient) GetOne(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*GetOneResponse, error) {
+	out := new(GetOneResponse)
+	err := c.cc.Invoke(ctx, "/gormquery.QueryService/GetOne", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *queryServiceClient) Create(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*CreateResponse, error) {
 	out := new(CreateResponse)
 	err := c.cc.Invoke(ctx, "/gormquery.QueryService/Create", in, out, opts...)
@@ -54,8 +66,8 @@ func (c *queryServiceClient) Create(ctx context.Context, in *OptionRequest, opts
 	return out, nil
 }
 
-func (c *queryServiceClient) Update(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*Empty, error) {
-	out := new(Empty)
+func (c *queryServiceClient) Update(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*WriteResponse, error) {
+	out := new(WriteResponse)
 	err := c.cc.Invoke(ctx, "/gormquery.QueryService/Update", in, out, opts...)
 	if err != nil {
 		return nil, err
@@ -63,8 +75,8 @@ func (c *queryServiceClient) Update(ctx context.Context, in *OptionRequest, opts
 	return out, nil
 }
 
-func (c *queryServiceClient) Delete(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*Empty, error) {
-	out := new(Empty)
+func (c *queryServiceClient) Delete(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (*WriteResponse, error) {
+	out := new(WriteResponse)
 	err := c.cc.Invoke(ctx, "/gormquery.QueryService/Delete", in, out, opts...)
 	if err != nil {
 		return nil, err
@@ -72,14 +84,83 @@ func (c *queryServiceClient) Delete(ctx context.Context, in *OptionRequest, opts
 	return out, nil
 }
 
+func (c *queryServiceClient) Import(ctx context.Context, opts ...grpc.CallOption) (QueryService_ImportClient, error) {
+	stream, err := c.cc.NewStream(ctx, &QueryService_ServiceDesc.Streams[0], "/gormquery.QueryService/Import", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &queryServiceImportClient{stream}
+	return x, nil
+}
+
+type QueryService_ImportClient interface {
+	Send(*ImportRequest) error
+	CloseAndRecv() (*ImportResponse, error)
+	grpc.ClientStream
+}
+
+type queryServiceImportClient struct {
+	grpc.ClientStream
+}
+
+func (x *queryServiceImportClient) Send(m *ImportRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *queryServiceImportClient) CloseAndRecv() (*ImportResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *queryServiceClient) Export(ctx context.Context, in *OptionRequest, opts ...grpc.CallOption) (QueryService_ExportClient, error) {
+	stream, err := c.cc.NewStream(ctx, &QueryService_ServiceDesc.Streams[1], "/gormquery.QueryService/Export", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &queryServiceExportClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type QueryService_ExportClient interface {
+	Recv() (*ExportChunk, error)
+	grpc.ClientStream
+}
+
+type queryServiceExportClient struct {
+	grpc.ClientStream
+}
+
+func (x *queryServiceExportClient) Recv() (*ExportChunk, error) {
+	m := new(ExportChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // QueryServiceServer is the server API for QueryService service.
 // All implementations must embed UnimplementedQueryServiceServer
 // for forward compatibility
 type QueryServiceServer interface {
 	Get(context.Context, *OptionRequest) (*QueryResponse, error)
+	GetOne(context.Context, *OptionRequest) (*GetOneResponse, error)
 	Create(context.Context, *OptionRequest) (*CreateResponse, error)
-	Update(context.Context, *OptionRequest) (*Empty, error)
-	Delete(context.Context, *OptionRequest) (*Empty, error)
+	Update(context.Context, *OptionRequest) (*WriteResponse, error)
+	Delete(context.Context, *OptionRequest) (*WriteResponse, error)
+	Import(QueryService_ImportServer) error
+	Export(*OptionRequest, QueryService_ExportServer) error
 	mustEmbedUnimplementedQueryServiceServer()
 }
 
@@ -90,15 +171,24 @@ type UnimplementedQueryServiceServer struct {
 func (UnimplementedQueryServiceServer) Get(context.Context, *OptionRequest) (*QueryResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
+func (UnimplementedQueryServiceServer) GetOne(context.Context, *OptionRequest) (*GetOneResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOne not implemented")
+}
 func (UnimplementedQueryServiceServer) Create(context.Context, *OptionRequest) (*CreateResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
 }
-func (UnimplementedQueryServiceServer) Update(context.Context, *OptionRequest) (*Empty, error) {
+func (UnimplementedQueryServiceServer) Update(context.Context, *OptionRequest) (*WriteResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
 }
-func (UnimplementedQueryServiceServer) Delete(context.Context, *OptionRequest) (*Empty, error) {
+func (UnimplementedQueryServiceServer) Delete(context.Context, *OptionRequest) (*WriteResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
 }
+func (UnimplementedQueryServiceServer) Import(QueryService_ImportServer) error {
+	return status.Errorf(codes.Unimplemented, "method Import not implemented")
+}
+func (UnimplementedQueryServiceServer) Export(*OptionRequest, QueryService_ExportServer) error {
+	return status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
 func (UnimplementedQueryServiceServer) mustEmbedUnimplementedQueryServiceServer() {}
 
 // UnsafeQueryServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -130,6 +220,24 @@ func _QueryService_Get_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _QueryService_GetOne_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OptionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServiceServer).GetOne(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gormquery.QueryService/GetOne",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServiceServer).GetOne(ctx, req.(*OptionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _QueryService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(OptionRequest)
 	if err := dec(in); err != nil {
@@ -184,6 +292,53 @@ func _QueryService_Delete_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _QueryService_Import_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(QueryServiceServer).Import(&queryServiceImportServer{stream})
+}
+
+type QueryService_ImportServer interface {
+	SendAndClose(*ImportResponse) error
+	Recv() (*ImportRequest, error)
+	grpc.ServerStream
+}
+
+type queryServiceImportServer struct {
+	grpc.ServerStream
+}
+
+func (x *queryServiceImportServer) SendAndClose(m *ImportResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *queryServiceImportServer) Recv() (*ImportRequest, error) {
+	m := new(ImportRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _QueryService_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(OptionRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueryServiceServer).Export(m, &queryServiceExportServer{stream})
+}
+
+type QueryService_ExportServer interface {
+	Send(*ExportChunk) error
+	grpc.ServerStream
+}
+
+type queryServiceExportServer struct {
+	grpc.ServerStream
+}
+
+func (x *queryServiceExportServer) Send(m *ExportChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // QueryService_ServiceDesc is the grpc.ServiceDesc for QueryService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -195,6 +350,10 @@ var QueryService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Get",
 			Handler:    _QueryService_Get_Handler,
 		},
+		{
+			MethodName: "GetOne",
+			Handler:    _QueryService_GetOne_Handler,
+		},
 		{
 			MethodName: "Create",
 			Handler:    _QueryService_Create_Handler,
@@ -208,6 +367,17 @@ var QueryService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _QueryService_Delete_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Import",
+			Handler:       _QueryService_Import_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Export",
+			Handler:       _QueryService_Export_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "gormquery.proto",
 }